@@ -0,0 +1,55 @@
+// Command rotate-keys re-encrypts all secrets stored in the database with the current master key
+//
+// To rotate the master key:
+//
+//  1. Generate a new key:          go run ./cmd/rotate-keys -generate
+//  2. Set ENCRYPTION_KEY to the new key and add the old key to ENCRYPTION_PREVIOUS_KEYS
+//  3. Re-encrypt everything:       go run ./cmd/rotate-keys
+//  4. Restart the panel, then remove the old key from ENCRYPTION_PREVIOUS_KEYS
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/joho/godotenv"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/database"
+	"github.com/vps-panel/backend/internal/secrets"
+)
+
+func main() {
+	generate := flag.Bool("generate", false, "print a new random master key and exit")
+	flag.Parse()
+
+	if *generate {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using system environment variables")
+	}
+
+	cfg := config.Load()
+
+	// Initialize also encrypts any remaining plaintext values
+	db, err := database.Initialize(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	count, err := database.EncryptSecrets(db, true)
+	if err != nil {
+		log.Fatalf("Key rotation failed after %d value(s): %v", count, err)
+	}
+
+	log.Printf("✓ Re-encrypted %d value(s) with the current master key", count)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// accessUserRequest is a basic auth login; an empty password keeps the
+// current password of an existing user with the same name
+type accessUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+const minAccessPasswordLength = 8
+
+func (h *ProjectHandler) GetAccessPolicies(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var policies []models.AccessPolicy
+	h.db.Where("project_id = ?", projectID).Preload("Users").Order("id ASC").Find(&policies)
+
+	return c.JSON(fiber.Map{
+		"policies": policies,
+	})
+}
+
+func (h *ProjectHandler) AddAccessPolicy(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var req struct {
+		DomainID   *uint               `json:"domain_id"`
+		AllowCIDRs []string            `json:"allow_cidrs"`
+		DenyCIDRs  []string            `json:"deny_cidrs"`
+		Users      []accessUserRequest `json:"users"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// The domain must belong to the project
+	if req.DomainID != nil {
+		var count int64
+		h.db.Model(&models.Domain{}).Where("id = ? AND project_id = ?", *req.DomainID, projectID).Count(&count)
+		if count == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Domain not found",
+			})
+		}
+	}
+
+	// One policy per project and per domain
+	existing := h.db.Model(&models.AccessPolicy{}).Where("project_id = ?", projectID)
+	if req.DomainID != nil {
+		existing = existing.Where("domain_id = ?", *req.DomainID)
+	} else {
+		existing = existing.Where("domain_id IS NULL")
+	}
+	var count int64
+	existing.Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An access policy already exists for this scope, update it instead",
+		})
+	}
+
+	policy := models.AccessPolicy{
+		ProjectID: uint(projectID),
+		DomainID:  req.DomainID,
+	}
+
+	var err error
+	if policy.AllowCIDRs, err = normalizeCIDRs(req.AllowCIDRs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if policy.DenyCIDRs, err = normalizeCIDRs(req.DenyCIDRs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if policy.Users, err = accessUsers(req.Users, nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if msg := validateAccessPolicy(&policy); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.db.Create(&policy).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create access policy",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(&project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(policy)
+}
+
+func (h *ProjectHandler) UpdateAccessPolicy(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	policyID, _ := strconv.ParseUint(c.Params("policyId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var policy models.AccessPolicy
+	if err := h.db.Where("id = ? AND project_id = ?", policyID, projectID).Preload("Users").First(&policy).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Access policy not found",
+		})
+	}
+
+	var req struct {
+		AllowCIDRs *[]string            `json:"allow_cidrs"`
+		DenyCIDRs  *[]string            `json:"deny_cidrs"`
+		Users      *[]accessUserRequest `json:"users"` // Replaces all users
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var err error
+	if req.AllowCIDRs != nil {
+		if policy.AllowCIDRs, err = normalizeCIDRs(*req.AllowCIDRs); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+	if req.DenyCIDRs != nil {
+		if policy.DenyCIDRs, err = normalizeCIDRs(*req.DenyCIDRs); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+	if req.Users != nil {
+		if policy.Users, err = accessUsers(*req.Users, policy.Users); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if msg := validateAccessPolicy(&policy); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Users").Save(&policy).Error; err != nil {
+			return err
+		}
+		if req.Users == nil {
+			return nil
+		}
+
+		if err := tx.Where("policy_id = ?", policy.ID).Delete(&models.AccessUser{}).Error; err != nil {
+			return err
+		}
+		for i := range policy.Users {
+			policy.Users[i].ID = 0
+			policy.Users[i].PolicyID = policy.ID
+		}
+		if len(policy.Users) > 0 {
+			return tx.Create(&policy.Users).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update access policy",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(&project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+
+	return c.JSON(policy)
+}
+
+func (h *ProjectHandler) DeleteAccessPolicy(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	policyID, _ := strconv.ParseUint(c.Params("policyId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND project_id = ?", policyID, projectID).Delete(&models.AccessPolicy{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("policy_id = ?", policyID).Delete(&models.AccessUser{}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Access policy not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete access policy",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(&project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// validateAccessPolicy returns an error message for a policy that would not restrict anything, or ""
+func validateAccessPolicy(policy *models.AccessPolicy) string {
+	if len(policy.AllowCIDRs) == 0 && len(policy.DenyCIDRs) == 0 && len(policy.Users) == 0 {
+		return "An access policy needs at least one user, allowed or denied address"
+	}
+	return ""
+}
+
+// normalizeCIDRs checks a list of IP addresses and CIDR ranges and returns them in canonical form
+func normalizeCIDRs(values []string) ([]string, error) {
+	var cidrs []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(value); ip != nil {
+			cidrs = append(cidrs, ip.String())
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid IP address or CIDR range: %s", value)
+		}
+		cidrs = append(cidrs, network.String())
+	}
+	return cidrs, nil
+}
+
+// accessUsers validates basic auth logins and hashes their passwords
+// Users without a password keep their hash from current
+func accessUsers(users []accessUserRequest, current []models.AccessUser) ([]models.AccessUser, error) {
+	hashes := make(map[string]string, len(current))
+	for _, user := range current {
+		hashes[user.Username] = user.PasswordHash
+	}
+
+	seen := make(map[string]bool, len(users))
+	result := make([]models.AccessUser, 0, len(users))
+	for _, user := range users {
+		// Usernames end up in the Caddyfile and in the basic auth header
+		if !isCaddyToken(user.Username) || strings.ContainsAny(user.Username, ":{}") {
+			return nil, fmt.Errorf("Invalid username: %q", user.Username)
+		}
+		if seen[user.Username] {
+			return nil, fmt.Errorf("Duplicate username: %s", user.Username)
+		}
+		seen[user.Username] = true
+
+		hash := hashes[user.Username]
+		if user.Password != "" || hash == "" {
+			if len(user.Password) < minAccessPasswordLength {
+				return nil, fmt.Errorf("Password for %s must be at least %d characters", user.Username, minAccessPasswordLength)
+			}
+			hashed, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to hash password")
+			}
+			hash = string(hashed)
+		}
+
+		result = append(result, models.AccessUser{
+			Username:     user.Username,
+			PasswordHash: hash,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vps-panel/backend/internal/services/caddy"
+)
+
+type AdminHandler struct {
+	reconciler *caddy.Reconciler
+}
+
+func NewAdminHandler(reconciler *caddy.Reconciler) *AdminHandler {
+	return &AdminHandler{reconciler: reconciler}
+}
+
+// ReconcileReport shows how the Caddy sites differ from the database without changing anything
+func (h *AdminHandler) ReconcileReport(c *fiber.Ctx) error {
+	report, err := h.reconciler.Run(true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compare Caddy sites: " + err.Error(),
+		})
+	}
+
+	return c.JSON(report)
+}
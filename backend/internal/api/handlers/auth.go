@@ -3,7 +3,9 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -17,15 +19,21 @@ import (
 	"github.com/vps-panel/backend/internal/config"
 	"github.com/vps-panel/backend/internal/models"
 	"github.com/vps-panel/backend/internal/services/oauth"
+	"github.com/vps-panel/backend/internal/services/session"
 )
 
 type AuthHandler struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db       *gorm.DB
+	cfg      *config.Config
+	sessions *session.Service
 }
 
 func NewAuthHandler(db *gorm.DB, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{db: db, cfg: cfg}
+	return &AuthHandler{
+		db:       db,
+		cfg:      cfg,
+		sessions: session.NewService(db, time.Duration(cfg.RefreshTokenTTL)*time.Second),
+	}
 }
 
 type RegisterRequest struct {
@@ -39,6 +47,10 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type AuthResponse struct {
 	Token        string       `json:"token"`
 	RefreshToken string       `json:"refresh_token"`
@@ -98,7 +110,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	// Generate tokens
-	token, refreshToken, err := h.generateTokens(&user)
+	token, refreshToken, err := h.generateTokens(c, &user)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate tokens",
@@ -136,7 +148,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	// Generate tokens
-	token, refreshToken, err := h.generateTokens(&user)
+	token, refreshToken, err := h.generateTokens(c, &user)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate tokens",
@@ -150,9 +162,90 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	})
 }
 
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token
+// Refresh tokens are single use; presenting one twice revokes the whole session
 func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
-	// TODO: Implement refresh token logic
-	return c.SendStatus(fiber.StatusNotImplemented)
+	var req RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Refresh token is required",
+		})
+	}
+
+	current, refreshToken, err := h.sessions.Rotate(req.RefreshToken, requestDevice(c))
+	if err != nil {
+		if errors.Is(err, session.ErrRefreshTokenReused) {
+			log.Printf("Refresh token reuse detected, session revoked (ip: %s)", c.IP())
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Refresh token has already been used. Please log in again.",
+			})
+		}
+		if errors.Is(err, session.ErrInvalidRefreshToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired refresh token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh token",
+		})
+	}
+
+	var user models.User
+	if err := h.db.First(&user, current.UserID).Error; err != nil {
+		h.sessions.RevokeSession(current.UserID, current.FamilyID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	token, err := h.generateAccessToken(&user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate tokens",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         &user,
+	})
+}
+
+// Logout revokes the session the given refresh token belongs to
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Refresh token is required",
+		})
+	}
+
+	// Unknown tokens are ignored so logging out twice doesn't fail
+	if err := h.sessions.Revoke(req.RefreshToken); err != nil && !errors.Is(err, session.ErrInvalidRefreshToken) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out successfully",
+	})
+}
+
+// LogoutAll revokes every session of the current user
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+
+	if err := h.sessions.RevokeAll(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log out",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out of all sessions",
+	})
 }
 
 func (h *AuthHandler) GetCurrentUser(c *fiber.Ctx) error {
@@ -225,42 +318,45 @@ func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
-func (h *AuthHandler) generateTokens(user *models.User) (string, string, error) {
-	// Access token (short-lived)
-	claims := &middleware.Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// generateTokens creates an access token and starts a new refresh token session for the requesting device
+func (h *AuthHandler) generateTokens(c *fiber.Ctx, user *models.User) (string, string, error) {
+	accessToken, err := h.generateAccessToken(user)
+	if err != nil {
+		return "", "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	accessToken, err := token.SignedString([]byte(h.cfg.JWTSecret))
+	// Refresh token (long-lived, opaque, stored hashed)
+	refreshToken, err := h.sessions.Start(user.ID, requestDevice(c))
 	if err != nil {
 		return "", "", err
 	}
 
-	// Refresh token (long-lived)
-	refreshClaims := &middleware.Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+	return accessToken, refreshToken, nil
+}
+
+func (h *AuthHandler) generateAccessToken(user *models.User) (string, error) {
+	// Access token (short-lived)
+	claims := &middleware.Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		TokenType: middleware.TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(h.cfg.AccessTokenTTL) * time.Second)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	refreshTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshToken, err := refreshTokenJWT.SignedString([]byte(h.cfg.JWTSecret))
-	if err != nil {
-		return "", "", err
-	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(h.cfg.JWTSecret))
+}
 
-	return accessToken, refreshToken, nil
+// requestDevice describes the client making the request, recorded with its session
+func requestDevice(c *fiber.Ctx) session.Device {
+	return session.Device{
+		UserAgent: c.Get("User-Agent"),
+		IPAddress: c.IP(),
+	}
 }
 
 // OAuth handlers
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/caddy"
+)
+
+// certificateRequest is an uploaded certificate chain (leaf first) and its
+// unencrypted private key, both PEM encoded
+type certificateRequest struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+func (h *ProjectHandler) GetCertificates(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var certificates []models.Certificate
+	h.db.Where("project_id = ?", projectID).Order("id ASC").Find(&certificates)
+
+	return c.JSON(fiber.Map{
+		"certificates": certificates,
+	})
+}
+
+// UploadCertificate adds a certificate for one domain, or shared by the
+// project's domains it covers when no domain is given
+func (h *ProjectHandler) UploadCertificate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var req struct {
+		certificateRequest
+		DomainID *uint `json:"domain_id"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	certificate, msg := parseCertificate(req.Certificate, req.PrivateKey)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := h.validateCertificateNames(certificate, uint(projectID)); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	certificate.ProjectID = uint(projectID)
+	certificate.DomainID = req.DomainID
+
+	if req.DomainID != nil {
+		var domain models.Domain
+		if err := h.db.Where("id = ? AND project_id = ?", *req.DomainID, projectID).First(&domain).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Domain not found",
+			})
+		}
+		if msg := validateDomainCertificate(certificate, &domain); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+
+		// One certificate per domain
+		var count int64
+		h.db.Model(&models.Certificate{}).Where("project_id = ? AND domain_id = ?", projectID, *req.DomainID).Count(&count)
+		if count > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "This domain already has a certificate, replace it instead",
+			})
+		}
+	}
+
+	if err := h.db.Create(certificate).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save certificate",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(&project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+	h.certMonitor.CheckProject(project.ID)
+
+	return c.Status(fiber.StatusCreated).JSON(certificate)
+}
+
+// ReplaceCertificate swaps in a renewed certificate and key, keeping its scope
+func (h *ProjectHandler) ReplaceCertificate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	certificateID, _ := strconv.ParseUint(c.Params("certificateId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var certificate models.Certificate
+	if err := h.db.Where("id = ? AND project_id = ?", certificateID, projectID).First(&certificate).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Certificate not found",
+		})
+	}
+
+	var req certificateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	replacement, msg := parseCertificate(req.Certificate, req.PrivateKey)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if msg := h.validateCertificateNames(replacement, uint(projectID)); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if certificate.DomainID != nil {
+		var domain models.Domain
+		if err := h.db.Where("id = ? AND project_id = ?", *certificate.DomainID, projectID).First(&domain).Error; err == nil {
+			if msg := validateDomainCertificate(replacement, &domain); msg != "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": msg,
+				})
+			}
+		}
+	}
+
+	replacement.ID = certificate.ID
+	replacement.CreatedAt = certificate.CreatedAt
+	replacement.ProjectID = certificate.ProjectID
+	replacement.DomainID = certificate.DomainID
+	if err := h.db.Save(replacement).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update certificate",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(&project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+	h.certMonitor.CheckProject(project.ID)
+
+	return c.JSON(replacement)
+}
+
+// DeleteCertificate removes an uploaded certificate; the domains that used it
+// go back to automatic certificates
+func (h *ProjectHandler) DeleteCertificate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	certificateID, _ := strconv.ParseUint(c.Params("certificateId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	result := h.db.Where("id = ? AND project_id = ?", certificateID, projectID).Delete(&models.Certificate{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete certificate",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Certificate not found",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(&project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+	h.removeCertificateFiles(uint(certificateID))
+	h.certMonitor.CheckProject(project.ID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// removeCertificateFiles removes a deleted certificate from Caddy, once the
+// project's site no longer uses it
+func (h *ProjectHandler) removeCertificateFiles(certificateID uint) {
+	if err := h.caddyService.RemoveCertificate(certificateID); err != nil {
+		println("Warning: Failed to remove certificate files:", err.Error())
+	}
+}
+
+// parseCertificate checks that a certificate chain and key belong together and
+// that the certificate is currently valid. Returns the certificate to store,
+// or an error message
+func parseCertificate(certPEM, keyPEM string) (*models.Certificate, string) {
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Sprintf("Invalid certificate or private key: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Sprintf("Invalid certificate: %v", err)
+	}
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Sprintf("Certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Sprintf("Certificate expired on %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if len(leaf.DNSNames) == 0 {
+		return nil, "Certificate has no DNS names (subject alternative names)"
+	}
+
+	// Certificates from an internal CA are allowed, so trust in a root isn't
+	// required; the chain must still be signed in order and not by the leaf itself
+	if bytes.Equal(leaf.RawIssuer, leaf.RawSubject) && leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature) == nil {
+		return nil, "Self-signed certificates aren't accepted, upload one issued by a CA"
+	}
+	child := leaf
+	for i, der := range pair.Certificate[1:] {
+		issuer, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Sprintf("Invalid certificate in chain: %v", err)
+		}
+		if err := child.CheckSignatureFrom(issuer); err != nil {
+			return nil, fmt.Sprintf("Certificate %d of the chain is not signed by the next one (leaf first, then intermediates): %v", i+1, err)
+		}
+		child = issuer
+	}
+
+	// Keep only the parsed chain and the key block, without comments or other blocks
+	var chain bytes.Buffer
+	for _, der := range pair.Certificate {
+		pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	var key []byte
+	for rest := []byte(keyPEM); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			key = pem.EncodeToMemory(block)
+			break
+		}
+	}
+
+	issuer := leaf.Issuer.CommonName
+	if len(leaf.Issuer.Organization) > 0 {
+		issuer = fmt.Sprintf("%s (%s)", leaf.Issuer.Organization[0], leaf.Issuer.CommonName)
+	}
+	fingerprint := sha256.Sum256(leaf.Raw)
+
+	return &models.Certificate{
+		CertificatePEM: chain.String(),
+		PrivateKeyPEM:  string(key),
+		Names:          leaf.DNSNames,
+		Issuer:         issuer,
+		NotBefore:      leaf.NotBefore,
+		NotAfter:       leaf.NotAfter,
+		Fingerprint:    hex.EncodeToString(fingerprint[:]),
+	}, ""
+}
+
+// validateCertificateNames returns an error message unless every name of a
+// certificate is a verified domain of the project (or its www/apex
+// counterpart), or a wildcard domain of the project covers it. Caddy takes
+// over TLS for every name an uploaded certificate covers, so certificates
+// also covering domains of other projects, or the panel domain and all its
+// subdomains, are refused
+func (h *ProjectHandler) validateCertificateNames(certificate *models.Certificate, projectID uint) string {
+	var domains []models.Domain
+	h.db.Where("project_id = ? AND verification_status = ?", projectID, models.DomainVerified).Find(&domains)
+
+	owned := make(map[string]bool)
+	for _, domain := range domains {
+		for _, host := range caddy.ServedHosts(domain) {
+			owned[host] = true
+		}
+	}
+
+	for _, name := range certificate.Names {
+		name = strings.ToLower(name)
+		if h.dnsVerifier.CoversPanel(name) {
+			return fmt.Sprintf("Certificate covers %s, which is reserved for the panel", name)
+		}
+
+		_, parent, _ := strings.Cut(name, ".")
+		if !owned[name] && !owned["*."+parent] {
+			return fmt.Sprintf("Certificate covers %s, which is not a verified domain of this project", name)
+		}
+	}
+
+	var others []models.Domain
+	h.db.Select("domain", "canonical").
+		Where("project_id <> ? AND verification_status = ?", projectID, models.DomainVerified).
+		Find(&others)
+	for _, domain := range others {
+		for _, host := range caddy.ServedHosts(domain) {
+			if certificate.Covers(host) {
+				return fmt.Sprintf("Certificate covers %s, a domain of another project", host)
+			}
+		}
+	}
+
+	return ""
+}
+
+// validateDomainCertificate returns an error message if a certificate can't be
+// served for a domain, or ""
+func validateDomainCertificate(certificate *models.Certificate, domain *models.Domain) string {
+	if !domain.SSLEnabled {
+		return "SSL is disabled for this domain"
+	}
+	if host := caddy.ServedHost(*domain); !certificate.Covers(host) {
+		return fmt.Sprintf("Certificate is not valid for %s (it covers %s)", host, strings.Join(certificate.Names, ", "))
+	}
+	return ""
+}
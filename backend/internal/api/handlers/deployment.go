@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"strconv"
 	"time"
@@ -11,7 +12,6 @@ import (
 	"github.com/vps-panel/backend/internal/config"
 	"github.com/vps-panel/backend/internal/models"
 	"github.com/vps-panel/backend/internal/services/deployment"
-	"github.com/vps-panel/backend/internal/services/websocket"
 )
 
 type DeploymentHandler struct {
@@ -20,13 +20,7 @@ type DeploymentHandler struct {
 	deploymentService *deployment.DeploymentService
 }
 
-func NewDeploymentHandler(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub) *DeploymentHandler {
-	deploymentService, err := deployment.NewDeploymentService(db, cfg, wsHub)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize deployment service: %v", err)
-		log.Println("Deployments will be queued but not executed")
-	}
-
+func NewDeploymentHandler(db *gorm.DB, cfg *config.Config, deploymentService *deployment.DeploymentService) *DeploymentHandler {
 	return &DeploymentHandler{
 		db:                db,
 		cfg:               cfg,
@@ -46,8 +40,14 @@ func (h *DeploymentHandler) GetAll(c *fiber.Ctx) error {
 		})
 	}
 
+	// The history of one environment (0 for production) when asked for, of all of them otherwise
+	query := h.db.Where("project_id = ?", projectID)
+	if c.Query("project_environment_id") != "" {
+		query = query.Where("preview_id IS NULL").Scopes(inEnvironment(queryEnvironmentID(c)))
+	}
+
 	var deployments []models.Deployment
-	if err := h.db.Where("project_id = ?", projectID).
+	if err := query.
 		Order("created_at DESC").
 		Find(&deployments).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -55,6 +55,12 @@ func (h *DeploymentHandler) GetAll(c *fiber.Ctx) error {
 		})
 	}
 
+	if h.deploymentService != nil {
+		for i := range deployments {
+			deployments[i].QueuePosition = h.deploymentService.QueuePosition(deployments[i].ID)
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"deployments": deployments,
 		"total":       len(deployments),
@@ -83,6 +89,10 @@ func (h *DeploymentHandler) GetByID(c *fiber.Ctx) error {
 		})
 	}
 
+	if h.deploymentService != nil {
+		deployment.QueuePosition = h.deploymentService.QueuePosition(deployment.ID)
+	}
+
 	return c.JSON(deployment)
 }
 
@@ -98,6 +108,25 @@ func (h *DeploymentHandler) Create(c *fiber.Ctx) error {
 		})
 	}
 
+	// Production unless another environment is given
+	var req struct {
+		ProjectEnvironmentID *uint `json:"project_environment_id"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	environment, ok := findProjectEnvironment(h.db, projectID, req.ProjectEnvironmentID)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
 	// Create deployment record
 	now := time.Now()
 	deployment := models.Deployment{
@@ -108,6 +137,10 @@ func (h *DeploymentHandler) Create(c *fiber.Ctx) error {
 		TriggeredByID: userID,
 		StartedAt:     &now,
 	}
+	if environment != nil {
+		deployment.ProjectEnvironmentID = &environment.ID
+		deployment.Branch = environment.GitBranch
+	}
 
 	if err := h.db.Create(&deployment).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -115,13 +148,10 @@ func (h *DeploymentHandler) Create(c *fiber.Ctx) error {
 		})
 	}
 
-	// Execute deployment asynchronously
+	// Queue deployment for execution
 	if h.deploymentService != nil {
-		go func() {
-			if err := h.deploymentService.Deploy(deployment.ID); err != nil {
-				log.Printf("Deployment %d failed: %v", deployment.ID, err)
-			}
-		}()
+		h.deploymentService.Enqueue(deployment.ID, deployment.ProjectID)
+		deployment.QueuePosition = h.deploymentService.QueuePosition(deployment.ID)
 	} else {
 		log.Printf("Warning: Deployment %d created but deployment service not available", deployment.ID)
 	}
@@ -142,33 +172,163 @@ func (h *DeploymentHandler) Cancel(c *fiber.Ctx) error {
 		})
 	}
 
-	var deployment models.Deployment
-	if err := h.db.Where("id = ? AND project_id = ?", deploymentID, projectID).First(&deployment).Error; err != nil {
+	var target models.Deployment
+	if err := h.db.Where("id = ? AND project_id = ?", deploymentID, projectID).First(&target).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Deployment not found",
 		})
 	}
 
-	// Can only cancel pending or building deployments
-	if deployment.Status != models.DeploymentPending && deployment.Status != models.DeploymentBuilding {
+	// Can only cancel deployments that haven't finished yet
+	if target.Status != models.DeploymentPending && target.Status != models.DeploymentBuilding &&
+		target.Status != models.DeploymentDeploying {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot cancel deployment in current state",
 		})
 	}
 
-	deployment.Status = models.DeploymentCancelled
-	now := time.Now()
-	deployment.CompletedAt = &now
+	if h.deploymentService == nil {
+		// Nothing can be running without the deployment service, just mark it cancelled
+		target.Status = models.DeploymentCancelled
+		now := time.Now()
+		target.CompletedAt = &now
+
+		if err := h.db.Save(&target).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to cancel deployment",
+			})
+		}
+
+		return c.JSON(target)
+	}
 
-	if err := h.db.Save(&deployment).Error; err != nil {
+	// Abort the running deployment (clone, build, container start)
+	err := h.deploymentService.Cancel(target.ID)
+	switch {
+	case errors.Is(err, deployment.ErrDeploymentNotCancellable): // Finished since the check above
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot cancel deployment in current state",
+		})
+	case err != nil:
+		log.Printf("Failed to cancel deployment %d: %v", target.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to cancel deployment",
 		})
 	}
 
-	// TODO: Cancel the actual deployment process
+	h.db.First(&target, target.ID)
+	return c.JSON(target)
+}
 
-	return c.JSON(deployment)
+// Rollback redeploys the image of a previous successful deployment without rebuilding
+func (h *DeploymentHandler) Rollback(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	deploymentID, _ := strconv.ParseUint(c.Params("deploymentId"), 10, 32)
+
+	// Verify project ownership
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var target models.Deployment
+	if err := h.db.Where("id = ? AND project_id = ?", deploymentID, projectID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Deployment not found",
+		})
+	}
+
+	// Only successful deployments whose image is still retained can be rolled back to
+	if target.Status != models.DeploymentSuccess || target.ImageTag == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Deployment has no image available for rollback",
+		})
+	}
+
+	if h.deploymentService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Deployment service not available",
+		})
+	}
+
+	rollback, err := h.deploymentService.Rollback(target.ProjectID, target.ID, userID)
+	if err != nil {
+		log.Printf("Failed to roll back to deployment %d: %v", target.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create rollback deployment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rollback)
+}
+
+// Promote deploys the image of a successful deployment to another environment
+// of the project without rebuilding it
+func (h *DeploymentHandler) Promote(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	deploymentID, _ := strconv.ParseUint(c.Params("deploymentId"), 10, 32)
+
+	// Verify project ownership
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var source models.Deployment
+	if err := h.db.Where("id = ? AND project_id = ?", deploymentID, projectID).First(&source).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Deployment not found",
+		})
+	}
+
+	// Production unless another environment is given
+	var req struct {
+		ProjectEnvironmentID *uint `json:"project_environment_id"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	if _, ok := findProjectEnvironment(h.db, projectID, req.ProjectEnvironmentID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
+	if h.deploymentService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Deployment service not available",
+		})
+	}
+
+	promotion, err := h.deploymentService.Promote(source.ProjectID, source.ID, req.ProjectEnvironmentID, userID)
+	switch {
+	case errors.Is(err, deployment.ErrRollbackUnavailable):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Deployment has no image available for promotion",
+		})
+	case errors.Is(err, deployment.ErrPromoteSameEnvironment), errors.Is(err, deployment.ErrPromotePreview),
+		errors.Is(err, deployment.ErrPromoteUnsupported):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Failed to promote deployment %d: %v", source.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create promotion deployment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(promotion)
 }
 
 func (h *DeploymentHandler) GetLogs(c *fiber.Ctx) error {
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/dnscheck"
+)
+
+// startVerification marks a new or renamed domain as pending with a fresh token
+// Subdomains of the panel domain belong to the panel and are verified right away
+func (h *ProjectHandler) startVerification(domain *models.Domain) error {
+	domain.VerificationError = ""
+
+	if h.dnsVerifier.IsPanelSubdomain(domain.Domain) {
+		now := time.Now()
+		domain.VerificationStatus = models.DomainVerified
+		domain.VerificationToken = ""
+		domain.VerifiedAt = &now
+		return nil
+	}
+
+	token, err := dnscheck.NewToken()
+	if err != nil {
+		return err
+	}
+	domain.VerificationStatus = models.DomainPending
+	domain.VerificationToken = token
+	domain.VerifiedAt = nil
+	return nil
+}
+
+// errVerifiedElsewhere is why a domain claimed by several projects failed for
+// all but the one that verified it first
+const errVerifiedElsewhere = "Domain is already verified by another project"
+
+// domainTaken reports whether a domain name can't be added to or renamed in its
+// project: another domain of the project has it, or another project verified it.
+// Unverified claims of other projects don't count, the first to verify wins
+func (h *ProjectHandler) domainTaken(domain *models.Domain) bool {
+	var count int64
+	h.db.Model(&models.Domain{}).
+		Where("domain = ? AND id <> ? AND (project_id = ? OR verification_status = ?)",
+			domain.Domain, domain.ID, domain.ProjectID, models.DomainVerified).
+		Count(&count)
+	return count > 0
+}
+
+// verifiedElsewhere reports whether another domain with the same name is verified
+func (h *ProjectHandler) verifiedElsewhere(domain *models.Domain) bool {
+	var count int64
+	h.db.Model(&models.Domain{}).
+		Where("domain = ? AND id <> ? AND verification_status = ?", domain.Domain, domain.ID, models.DomainVerified).
+		Count(&count)
+	return count > 0
+}
+
+// GetDomainVerification returns the DNS records a domain needs to be verified
+func (h *ProjectHandler) GetDomainVerification(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	domainID, _ := strconv.ParseUint(c.Params("domainId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var domain models.Domain
+	if err := h.db.Where("id = ? AND project_id = ?", domainID, projectID).First(&domain).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Domain not found",
+		})
+	}
+
+	response := fiber.Map{
+		"domain": domain,
+	}
+	if domain.VerificationToken != "" {
+		name, value := dnscheck.Record(domain.Domain, domain.VerificationToken)
+		response["txt_record"] = fiber.Map{
+			"name":  name,
+			"value": value,
+		}
+	}
+
+	// Current state of the records, without changing the domain's status
+	if domain.VerificationToken != "" {
+		response["check"] = h.dnsVerifier.Check(c.Context(), domain.Domain, domain.VerificationToken)
+	} else {
+		response["check"] = h.dnsVerifier.CheckDNS(c.Context(), domain.Domain)
+	}
+
+	return c.JSON(response)
+}
+
+// VerifyDomain checks a domain's DNS records and marks it verified once they match
+// A newly verified domain is added to the project's Caddy site right away
+func (h *ProjectHandler) VerifyDomain(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	domainID, _ := strconv.ParseUint(c.Params("domainId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var domain models.Domain
+	if err := h.db.Where("id = ? AND project_id = ?", domainID, projectID).First(&domain).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Domain not found",
+		})
+	}
+
+	if domain.Verified() {
+		return c.JSON(fiber.Map{
+			"domain": domain,
+		})
+	}
+
+	result := h.dnsVerifier.Check(c.Context(), domain.Domain, domain.VerificationToken)
+	switch {
+	case result.Verified() && h.verifiedElsewhere(&domain):
+		domain.VerificationStatus = models.DomainFailed
+		domain.VerificationError = errVerifiedElsewhere
+	case result.Verified():
+		now := time.Now()
+		domain.VerificationStatus = models.DomainVerified
+		domain.VerificationError = ""
+		domain.VerifiedAt = &now
+	default:
+		domain.VerificationStatus = models.DomainFailed
+		domain.VerificationError = result.Error()
+	}
+
+	if err := h.db.Save(&domain).Error; err != nil {
+		// Another project verified the name since the check above
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": errVerifiedElsewhere,
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update domain",
+		})
+	}
+
+	if domain.Verified() {
+		// The name is ours now; other projects' claims on it can't succeed anymore
+		h.db.Model(&models.Domain{}).
+			Where("domain = ? AND id <> ? AND verification_status <> ?", domain.Domain, domain.ID, models.DomainVerified).
+			Updates(map[string]interface{}{
+				"verification_status": models.DomainFailed,
+				"verification_error":  errVerifiedElsewhere,
+			})
+
+		// Update Caddy configuration
+		if err := h.updateCaddyForProject(&project); err != nil {
+			println("Warning: Failed to update Caddy configuration:", err.Error())
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"domain": domain,
+		"check":  result,
+	})
+}
+
+// CheckDomainCertificate checks the certificate a domain serves now, without
+// waiting for the monitor's next run
+func (h *ProjectHandler) CheckDomainCertificate(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	domainID, _ := strconv.ParseUint(c.Params("domainId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var domain models.Domain
+	if err := h.db.Where("id = ? AND project_id = ?", domainID, projectID).First(&domain).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Domain not found",
+		})
+	}
+
+	if !domain.SSLEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SSL is disabled for this domain",
+		})
+	}
+
+	h.certMonitor.Check(c.Context(), &domain)
+
+	return c.JSON(domain)
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/caddy"
+)
+
+const (
+	maxMaintenanceMessageLength = 1000
+	maxMaintenancePageSize      = 64 * 1024
+	maxMaintenanceRetryAfter    = 7 * 24 * 3600
+)
+
+// GetMaintenance returns the maintenance settings, whether maintenance mode is
+// on right now, and the upcoming windows
+func (h *ProjectHandler) GetMaintenance(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	return c.JSON(h.maintenanceStatus(&project))
+}
+
+// UpdateMaintenance changes the maintenance settings; omitted fields are kept
+func (h *ProjectHandler) UpdateMaintenance(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var req struct {
+		Enabled    *bool     `json:"enabled"`
+		Message    *string   `json:"message"`
+		Page       *string   `json:"page"` // Custom HTML, "" restores the built-in page
+		RetryAfter *int      `json:"retry_after"`
+		AllowCIDRs *[]string `json:"allow_cidrs"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Enabled != nil {
+		project.MaintenanceEnabled = *req.Enabled
+	}
+	if req.Message != nil {
+		project.MaintenanceMessage = strings.TrimSpace(*req.Message)
+	}
+	if req.Page != nil {
+		project.MaintenancePage = strings.TrimSpace(*req.Page)
+	}
+	if req.RetryAfter != nil {
+		project.MaintenanceRetryAfter = *req.RetryAfter
+	}
+	if req.AllowCIDRs != nil {
+		cidrs, err := normalizeCIDRs(*req.AllowCIDRs)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		project.MaintenanceAllowCIDRs = cidrs
+	}
+
+	if msg := validateMaintenance(&project); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	return h.saveMaintenance(c, &project)
+}
+
+// EnableMaintenance turns maintenance mode on until it's disabled
+func (h *ProjectHandler) EnableMaintenance(c *fiber.Ctx) error {
+	return h.setMaintenance(c, true)
+}
+
+// DisableMaintenance turns manual maintenance mode off; scheduled windows still apply
+func (h *ProjectHandler) DisableMaintenance(c *fiber.Ctx) error {
+	return h.setMaintenance(c, false)
+}
+
+func (h *ProjectHandler) setMaintenance(c *fiber.Ctx, enabled bool) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	project.MaintenanceEnabled = enabled
+	return h.saveMaintenance(c, &project)
+}
+
+func (h *ProjectHandler) saveMaintenance(c *fiber.Ctx, project *models.Project) error {
+	if err := h.db.Model(project).Select(
+		"MaintenanceEnabled", "MaintenanceMessage", "MaintenancePage", "MaintenanceRetryAfter", "MaintenanceAllowCIDRs",
+	).Updates(project).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update maintenance settings",
+		})
+	}
+
+	// Update Caddy configuration
+	if err := h.updateCaddyForProject(project); err != nil {
+		println("Warning: Failed to update Caddy configuration:", err.Error())
+	}
+
+	return c.JSON(h.maintenanceStatus(project))
+}
+
+// AddMaintenanceWindow schedules maintenance mode for a period of time
+func (h *ProjectHandler) AddMaintenanceWindow(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var req struct {
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+		Message  string    `json:"message"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body (times must be RFC 3339)",
+		})
+	}
+
+	window := models.MaintenanceWindow{
+		ProjectID: uint(projectID),
+		StartsAt:  req.StartsAt.UTC(),
+		EndsAt:    req.EndsAt.UTC(),
+		Message:   strings.TrimSpace(req.Message),
+	}
+
+	if window.StartsAt.IsZero() || !window.EndsAt.After(window.StartsAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A maintenance window needs a start and an end after it",
+		})
+	}
+	if !window.EndsAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The maintenance window has already ended",
+		})
+	}
+	if msg := validateMaintenanceText("Message", window.Message, maxMaintenanceMessageLength); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.db.Create(&window).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create maintenance window",
+		})
+	}
+
+	// Windows starting later are applied by the maintenance scheduler
+	if window.Active(time.Now()) {
+		if err := h.updateCaddyForProject(&project); err != nil {
+			println("Warning: Failed to update Caddy configuration:", err.Error())
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(window)
+}
+
+func (h *ProjectHandler) DeleteMaintenanceWindow(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	windowID, _ := strconv.ParseUint(c.Params("windowId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var window models.MaintenanceWindow
+	if err := h.db.Where("id = ? AND project_id = ?", windowID, projectID).First(&window).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Maintenance window not found",
+		})
+	}
+
+	if err := h.db.Delete(&window).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete maintenance window",
+		})
+	}
+
+	// Deleting a running window ends it right away
+	if window.Active(time.Now()) {
+		if err := h.updateCaddyForProject(&project); err != nil {
+			println("Warning: Failed to update Caddy configuration:", err.Error())
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// maintenanceStatus describes a project's maintenance settings and state
+func (h *ProjectHandler) maintenanceStatus(project *models.Project) fiber.Map {
+	now := time.Now()
+	h.db.Where("project_id = ? AND ends_at > ?", project.ID, now).Order("starts_at ASC").Find(&project.MaintenanceWindows)
+	active, window := project.InMaintenance(now)
+
+	return fiber.Map{
+		"active":         active,
+		"current_window": window,
+		"enabled":        project.MaintenanceEnabled,
+		"message":        project.MaintenanceMessage,
+		"page":           project.MaintenancePage,
+		"retry_after":    project.MaintenanceRetryAfter,
+		"allow_cidrs":    project.MaintenanceAllowCIDRs,
+		"windows":        project.MaintenanceWindows,
+	}
+}
+
+// validateMaintenance returns an error message for invalid maintenance settings, or ""
+func validateMaintenance(project *models.Project) string {
+	if project.MaintenanceRetryAfter < 0 || project.MaintenanceRetryAfter > maxMaintenanceRetryAfter {
+		return fmt.Sprintf("Retry-After must be between 0 and %d seconds", maxMaintenanceRetryAfter)
+	}
+	if msg := validateMaintenanceText("Message", project.MaintenanceMessage, maxMaintenanceMessageLength); msg != "" {
+		return msg
+	}
+	return validateMaintenanceText("Page", project.MaintenancePage, maxMaintenancePageSize)
+}
+
+// validateMaintenanceText checks text that ends up in the Caddy site block
+// The page is written as a heredoc, which its closing marker would end, and
+// Caddy substitutes {$VAR} environment variables anywhere in the Caddyfile
+func validateMaintenanceText(field, text string, maxLength int) string {
+	if len(text) > maxLength {
+		return fmt.Sprintf("%s must be at most %d characters", field, maxLength)
+	}
+	if strings.Contains(text, "{$") || strings.Contains(text, caddy.MaintenancePageMarker) {
+		return fmt.Sprintf("%s must not contain '{$' or '%s'", field, caddy.MaintenancePageMarker)
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// GetPreviews lists the pull request previews of a project with their subdomains
+func (h *ProjectHandler) GetPreviews(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var previews []models.Preview
+	h.db.Where("project_id = ?", projectID).Preload("Domains").Order("number DESC").Find(&previews)
+
+	return c.JSON(fiber.Map{
+		"previews": previews,
+	})
+}
+
+// ClosePreview takes a preview down before its pull request is closed; the
+// next push to the pull request deploys it again
+func (h *ProjectHandler) ClosePreview(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	previewID, _ := strconv.ParseUint(c.Params("previewId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var preview models.Preview
+	if err := h.db.Where("id = ? AND project_id = ?", previewID, projectID).First(&preview).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Preview not found",
+		})
+	}
+
+	if preview.Status == models.PreviewClosed {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Preview is already closed",
+		})
+	}
+
+	if h.deploymentService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Deployment service not available",
+		})
+	}
+
+	if err := h.deploymentService.ClosePreview(&preview); err != nil {
+		log.Printf("Failed to close preview %d: %v", preview.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to close preview",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -6,8 +6,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -15,24 +18,37 @@ import (
 	"github.com/vps-panel/backend/internal/config"
 	"github.com/vps-panel/backend/internal/models"
 	"github.com/vps-panel/backend/internal/services/caddy"
+	"github.com/vps-panel/backend/internal/services/certs"
 	"github.com/vps-panel/backend/internal/services/deployment"
 	"github.com/vps-panel/backend/internal/services/detector"
+	"github.com/vps-panel/backend/internal/services/dnscheck"
 	"github.com/vps-panel/backend/internal/services/docker"
 	"github.com/vps-panel/backend/internal/services/git"
 	"github.com/vps-panel/backend/internal/services/webhook"
+	"github.com/vps-panel/backend/internal/services/websocket"
 )
 
 type ProjectHandler struct {
-	db             *gorm.DB
-	cfg            *config.Config
-	webhookService *webhook.Service
+	db                *gorm.DB
+	cfg               *config.Config
+	webhookService    *webhook.Service
+	deploymentService *deployment.DeploymentService
+	dnsVerifier       *dnscheck.Verifier
+	certMonitor       *certs.Monitor
+	caddyService      *caddy.CaddyService
+	wsHub             *websocket.Hub
 }
 
-func NewProjectHandler(db *gorm.DB, cfg *config.Config) *ProjectHandler {
+func NewProjectHandler(db *gorm.DB, cfg *config.Config, deploymentService *deployment.DeploymentService, certMonitor *certs.Monitor, caddyService *caddy.CaddyService, wsHub *websocket.Hub) *ProjectHandler {
 	return &ProjectHandler{
-		db:             db,
-		cfg:            cfg,
-		webhookService: webhook.NewService(),
+		db:                db,
+		cfg:               cfg,
+		webhookService:    webhook.NewService(),
+		deploymentService: deploymentService,
+		dnsVerifier:       dnscheck.NewVerifier(cfg),
+		certMonitor:       certMonitor,
+		caddyService:      caddyService,
+		wsHub:             wsHub,
 	}
 }
 
@@ -94,6 +110,27 @@ type CreateProjectRequest struct {
 	BackendPort    int                   `json:"backend_port"`
 	AutoDeploy     bool                  `json:"auto_deploy"`
 	CustomDomain   string                `json:"custom_domain"`
+	// How concurrent deployments are handled: "queue" (default) or "supersede"
+	DeploymentPolicy models.DeploymentPolicy `json:"deployment_policy"`
+	// Deploy pull/merge requests to previews on subdomains of their own (needs auto-deploy)
+	PreviewDeployments bool `json:"preview_deployments"`
+	// Tags deployed when pushed or released, by glob or semver range (needs auto-deploy)
+	TriggerRules []models.TriggerRule `json:"trigger_rules"`
+	// Path globs a push must (include) or must only (exclude) change to be deployed
+	IncludePaths []string `json:"include_paths"`
+	ExcludePaths []string `json:"exclude_paths"`
+	// Health check run before a deployment is marked successful (zero values use defaults)
+	HealthCheckPath           string `json:"health_check_path"`
+	HealthCheckExpectedStatus int    `json:"health_check_expected_status"`
+	HealthCheckTimeout        int    `json:"health_check_timeout"`
+	HealthCheckRetries        int    `json:"health_check_retries"`
+	HealthCheckStartPeriod    int    `json:"health_check_start_period"`
+	HealthCheckRollback       bool   `json:"health_check_rollback"`
+	// Response headers: "" (default), "strict", "relaxed" or "custom", plus custom headers and a CSP
+	HeaderProfile models.HeaderProfile  `json:"header_profile"`
+	CustomHeaders []models.CustomHeader `json:"custom_headers"`
+	CSPDirectives []models.CSPDirective `json:"csp_directives"`
+	CSPReportOnly bool                  `json:"csp_report_only"`
 }
 
 func (h *ProjectHandler) GetAll(c *fiber.Ctx) error {
@@ -170,6 +207,34 @@ func (h *ProjectHandler) Create(c *fiber.Ctx) error {
 	if req.BuildCommand == "" {
 		req.BuildCommand = "npm run build"
 	}
+	if req.DeploymentPolicy == "" {
+		req.DeploymentPolicy = models.DeploymentPolicyQueue
+	}
+	if !isValidDeploymentPolicy(req.DeploymentPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid deployment policy. Use 'queue' or 'supersede'",
+		})
+	}
+	if msg := validateHealthCheck(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := validateHeaders(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := validateTriggerRules(req.TriggerRules); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := validatePathFilters(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
 
 	// Resolve OAuth placeholder tokens to actual credentials
 	gitUsername, gitToken, err := h.resolveGitCredentials(userID, req.GitUsername, req.GitToken)
@@ -180,24 +245,41 @@ func (h *ProjectHandler) Create(c *fiber.Ctx) error {
 	}
 
 	project := models.Project{
-		UserID:         userID,
-		Name:           req.Name,
-		Description:    req.Description,
-		GitURL:         req.GitURL,
-		GitBranch:      req.GitBranch,
-		GitUsername:    gitUsername,
-		GitToken:       gitToken,
-		RootDirectory:  req.RootDirectory,
-		Framework:      req.Framework,
-		BaaSType:       req.BaaSType,
-		BuildCommand:   req.BuildCommand,
-		OutputDir:      req.OutputDir,
-		InstallCommand: req.InstallCommand,
-		NodeVersion:    req.NodeVersion,
-		FrontendPort:   req.FrontendPort,
-		BackendPort:    req.BackendPort,
-		AutoDeploy:     req.AutoDeploy,
-		Status:         "pending",
+		UserID:           userID,
+		Name:             req.Name,
+		Description:      req.Description,
+		GitURL:           req.GitURL,
+		GitBranch:        req.GitBranch,
+		GitUsername:      gitUsername,
+		GitToken:         gitToken,
+		RootDirectory:    req.RootDirectory,
+		Framework:        req.Framework,
+		BaaSType:         req.BaaSType,
+		BuildCommand:     req.BuildCommand,
+		OutputDir:        req.OutputDir,
+		InstallCommand:   req.InstallCommand,
+		NodeVersion:      req.NodeVersion,
+		FrontendPort:     req.FrontendPort,
+		BackendPort:      req.BackendPort,
+		AutoDeploy:       req.AutoDeploy,
+		Status:           "pending",
+		DeploymentPolicy: req.DeploymentPolicy,
+
+		PreviewDeployments: req.PreviewDeployments,
+		TriggerRules:       req.TriggerRules,
+		IncludePaths:       req.IncludePaths,
+		ExcludePaths:       req.ExcludePaths,
+
+		HealthCheckPath:           req.HealthCheckPath,
+		HealthCheckExpectedStatus: req.HealthCheckExpectedStatus,
+		HealthCheckTimeout:        req.HealthCheckTimeout,
+		HealthCheckRetries:        req.HealthCheckRetries,
+		HealthCheckStartPeriod:    req.HealthCheckStartPeriod,
+		HealthCheckRollback:       req.HealthCheckRollback,
+		HeaderProfile:             req.HeaderProfile,
+		CustomHeaders:             req.CustomHeaders,
+		CSPDirectives:             req.CSPDirectives,
+		CSPReportOnly:             req.CSPReportOnly,
 	}
 
 	// Generate webhook secret if auto-deploy is enabled
@@ -222,7 +304,9 @@ func (h *ProjectHandler) Create(c *fiber.Ctx) error {
 			IsActive:   true,
 			SSLEnabled: true,
 		}
-		if err := h.db.Create(&domain).Error; err != nil {
+		if err := h.startVerification(&domain); err != nil {
+			println("Warning: failed to create custom domain:", err.Error())
+		} else if err := h.db.Create(&domain).Error; err != nil {
 			// Don't fail project creation if domain creation fails, just log it
 			// The user can add the domain later
 			println("Warning: failed to create custom domain:", err.Error())
@@ -301,6 +385,50 @@ func (h *ProjectHandler) Update(c *fiber.Ctx) error {
 	project.FrontendPort = req.FrontendPort
 	project.BackendPort = req.BackendPort
 	project.AutoDeploy = req.AutoDeploy
+	project.PreviewDeployments = req.PreviewDeployments
+	project.TriggerRules = req.TriggerRules
+	project.IncludePaths = req.IncludePaths
+	project.ExcludePaths = req.ExcludePaths
+	if req.DeploymentPolicy != "" {
+		if !isValidDeploymentPolicy(req.DeploymentPolicy) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid deployment policy. Use 'queue' or 'supersede'",
+			})
+		}
+		project.DeploymentPolicy = req.DeploymentPolicy
+	}
+	if msg := validateHealthCheck(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := validateHeaders(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := validateTriggerRules(req.TriggerRules); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if msg := validatePathFilters(&req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	project.HealthCheckPath = req.HealthCheckPath
+	project.HealthCheckExpectedStatus = req.HealthCheckExpectedStatus
+	project.HealthCheckTimeout = req.HealthCheckTimeout
+	project.HealthCheckRetries = req.HealthCheckRetries
+	project.HealthCheckStartPeriod = req.HealthCheckStartPeriod
+	project.HealthCheckRollback = req.HealthCheckRollback
+
+	headersBefore := projectHeaders(&project)
+	project.HeaderProfile = req.HeaderProfile
+	project.CustomHeaders = req.CustomHeaders
+	project.CSPDirectives = req.CSPDirectives
+	project.CSPReportOnly = req.CSPReportOnly
 
 	if err := h.db.Save(&project).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -308,6 +436,13 @@ func (h *ProjectHandler) Update(c *fiber.Ctx) error {
 		})
 	}
 
+	// Header changes take effect without a redeploy
+	if !reflect.DeepEqual(headersBefore, projectHeaders(&project)) && project.FrontendPort != 0 {
+		if err := h.updateCaddyForProject(&project); err != nil {
+			println("Warning: Failed to update Caddy configuration:", err.Error())
+		}
+	}
+
 	return c.JSON(project)
 }
 
@@ -344,12 +479,32 @@ func (h *ProjectHandler) Delete(c *fiber.Ctx) error {
 		}
 
 		// Also try to stop individual container (for non-compose deployments)
-		containerName := fmt.Sprintf("vps-panel-%s-%d", project.Name, project.ID)
+		containerName := docker.ContainerName(&project)
 		if err := dockerService.RemoveContainer(ctx, containerName); err != nil {
 			log.Printf("Note: individual container cleanup for project %d: %v", project.ID, err)
 		}
 	}
 
+	// Previews and environments are taken down in the background, see
+	// ClosePreview and DeleteEnvironment
+	if h.deploymentService != nil {
+		var previews []models.Preview
+		h.db.Where("project_id = ? AND status <> ?", project.ID, models.PreviewClosed).Find(&previews)
+		for i := range previews {
+			if err := h.deploymentService.ClosePreview(&previews[i]); err != nil {
+				log.Printf("Warning: failed to close preview %d: %v", previews[i].ID, err)
+			}
+		}
+
+		var environments []models.ProjectEnvironment
+		h.db.Where("project_id = ?", project.ID).Find(&environments)
+		for i := range environments {
+			if err := h.deploymentService.DeleteEnvironment(&environments[i]); err != nil {
+				log.Printf("Warning: failed to delete environment %d: %v", environments[i].ID, err)
+			}
+		}
+	}
+
 	// Step 2: Delete project directory
 	projectDir := filepath.Join(h.cfg.ProjectsDir, fmt.Sprintf("project-%d", project.ID))
 	if err := os.RemoveAll(projectDir); err != nil {
@@ -359,20 +514,26 @@ func (h *ProjectHandler) Delete(c *fiber.Ctx) error {
 	}
 
 	// Step 3: Remove Caddy configuration
-	caddyService := caddy.NewCaddyService(h.cfg.CaddyConfigPath, h.cfg.CaddyReloadCmd)
-	caddyConfigFile := filepath.Join(h.cfg.CaddyConfigPath, fmt.Sprintf("project-%d.caddy", project.ID))
-	if err := os.Remove(caddyConfigFile); err != nil {
-		if !os.IsNotExist(err) {
-			log.Printf("Warning: failed to delete Caddy config: %v", err)
-		}
+	if err := h.caddyService.RemoveProject(&project); err != nil {
+		log.Printf("Warning: failed to delete Caddy config: %v", err)
 	} else {
 		log.Printf("✓ Deleted Caddy configuration")
 		// Reload Caddy to apply changes
-		if err := caddyService.Reload(); err != nil {
+		if err := h.caddyService.Reload(); err != nil {
 			log.Printf("Warning: failed to reload Caddy: %v", err)
 		}
 	}
 
+	// Uploaded certificates are no longer used by any site
+	var certificateIDs []uint
+	h.db.Model(&models.Certificate{}).Where("project_id = ?", project.ID).Pluck("id", &certificateIDs)
+	for _, id := range certificateIDs {
+		if err := h.caddyService.RemoveCertificate(id); err != nil {
+			log.Printf("Warning: failed to remove certificate %d: %v", id, err)
+		}
+	}
+	h.db.Where("project_id = ?", project.ID).Delete(&models.Certificate{})
+
 	// Step 4: Delete webhook from Git provider if auto-deploy was enabled
 	if project.AutoDeploy && project.WebhookSecret != "" {
 		// Find the connected Git provider
@@ -403,6 +564,9 @@ func (h *ProjectHandler) Delete(c *fiber.Ctx) error {
 		})
 	}
 
+	// Its owner is no longer needed to route websocket events
+	h.wsHub.ForgetProject(project.ID)
+
 	log.Printf("✓ Successfully deleted project %d: %s", project.ID, project.Name)
 	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -420,8 +584,16 @@ func (h *ProjectHandler) GetEnvironments(c *fiber.Ctx) error {
 		})
 	}
 
+	// Production's variables, or those of the environment asked for
+	environmentID := queryEnvironmentID(c)
+	if _, ok := findProjectEnvironment(h.db, projectID, environmentID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
 	var envs []models.Environment
-	h.db.Where("project_id = ?", projectID).Find(&envs)
+	h.db.Where("project_id = ?", projectID).Scopes(inEnvironment(environmentID)).Find(&envs)
 
 	return c.JSON(fiber.Map{
 		"environments": envs,
@@ -440,9 +612,10 @@ func (h *ProjectHandler) AddEnvironment(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Key      string `json:"key" validate:"required"`
-		Value    string `json:"value" validate:"required"`
-		IsSecret bool   `json:"is_secret"`
+		Key                  string `json:"key" validate:"required"`
+		Value                string `json:"value" validate:"required"`
+		IsSecret             bool   `json:"is_secret"`
+		ProjectEnvironmentID *uint  `json:"project_environment_id"` // Omitted for production
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -451,11 +624,18 @@ func (h *ProjectHandler) AddEnvironment(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, ok := findProjectEnvironment(h.db, projectID, req.ProjectEnvironmentID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
 	env := models.Environment{
-		ProjectID: uint(projectID),
-		Key:       req.Key,
-		Value:     req.Value,
-		IsSecret:  req.IsSecret,
+		ProjectID:            uint(projectID),
+		ProjectEnvironmentID: req.ProjectEnvironmentID,
+		Key:                  req.Key,
+		Value:                req.Value,
+		IsSecret:             req.IsSecret,
 	}
 
 	if err := h.db.Create(&env).Error; err != nil {
@@ -537,8 +717,17 @@ func (h *ProjectHandler) GetDomains(c *fiber.Ctx) error {
 		})
 	}
 
+	// Preview subdomains are listed with their previews; other environments'
+	// domains are listed when asked for
+	environmentID := queryEnvironmentID(c)
+	if _, ok := findProjectEnvironment(h.db, projectID, environmentID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
 	var domains []models.Domain
-	h.db.Where("project_id = ?", projectID).Find(&domains)
+	h.db.Where("project_id = ? AND preview_id IS NULL", projectID).Scopes(inEnvironment(environmentID)).Find(&domains)
 
 	return c.JSON(fiber.Map{
 		"domains": domains,
@@ -559,8 +748,10 @@ func (h *ProjectHandler) AddDomain(c *fiber.Ctx) error {
 	}
 
 	var req struct {
-		Domain     string `json:"domain" validate:"required"`
-		SSLEnabled bool   `json:"ssl_enabled"`
+		Domain               string `json:"domain" validate:"required"`
+		SSLEnabled           bool   `json:"ssl_enabled"`
+		ProjectEnvironmentID *uint  `json:"project_environment_id"` // Omitted for production
+		domainRoutingRequest
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -576,11 +767,37 @@ func (h *ProjectHandler) AddDomain(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, ok := findProjectEnvironment(h.db, projectID, req.ProjectEnvironmentID); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
 	domain := models.Domain{
-		ProjectID:  uint(projectID),
-		Domain:     req.Domain,
-		IsActive:   true,
-		SSLEnabled: req.SSLEnabled,
+		ProjectID:            uint(projectID),
+		ProjectEnvironmentID: req.ProjectEnvironmentID,
+		Domain:               req.Domain,
+		IsActive:             true,
+		SSLEnabled:           req.SSLEnabled,
+	}
+	req.domainRoutingRequest.apply(&domain)
+
+	if msg := validateDomain(&domain); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if h.domainTaken(&domain) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Domain already exists",
+		})
+	}
+
+	if err := h.startVerification(&domain); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create domain",
+		})
 	}
 
 	if err := h.db.Create(&domain).Error; err != nil {
@@ -595,6 +812,8 @@ func (h *ProjectHandler) AddDomain(c *fiber.Ctx) error {
 		})
 	}
 
+	h.ensureSinglePrimary(&domain)
+
 	// Update Caddy configuration
 	if err := h.updateCaddyForProject(&project); err != nil {
 		// Log error but don't fail the request
@@ -630,6 +849,7 @@ func (h *ProjectHandler) UpdateDomain(c *fiber.Ctx) error {
 		Domain     *string `json:"domain"`
 		IsActive   *bool   `json:"is_active"`
 		SSLEnabled *bool   `json:"ssl_enabled"`
+		domainRoutingRequest
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -639,8 +859,15 @@ func (h *ProjectHandler) UpdateDomain(c *fiber.Ctx) error {
 	}
 
 	// Update fields if provided
-	if req.Domain != nil {
+	renamed := req.Domain != nil && *req.Domain != domain.Domain
+	if renamed {
+		// A new hostname has to be verified again
 		domain.Domain = *req.Domain
+		if err := h.startVerification(&domain); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update domain",
+			})
+		}
 	}
 	if req.IsActive != nil {
 		domain.IsActive = *req.IsActive
@@ -648,6 +875,19 @@ func (h *ProjectHandler) UpdateDomain(c *fiber.Ctx) error {
 	if req.SSLEnabled != nil {
 		domain.SSLEnabled = *req.SSLEnabled
 	}
+	req.domainRoutingRequest.apply(&domain)
+
+	if msg := validateDomain(&domain); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if renamed && h.domainTaken(&domain) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Domain already exists",
+		})
+	}
 
 	if err := h.db.Save(&domain).Error; err != nil {
 		// Check for duplicate domain error
@@ -661,6 +901,8 @@ func (h *ProjectHandler) UpdateDomain(c *fiber.Ctx) error {
 		})
 	}
 
+	h.ensureSinglePrimary(&domain)
+
 	// Update Caddy configuration
 	if err := h.updateCaddyForProject(&project); err != nil {
 		println("Warning: Failed to update Caddy configuration:", err.Error())
@@ -683,9 +925,17 @@ func (h *ProjectHandler) DeleteDomain(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check that we're not deleting the last domain
+	var domain models.Domain
+	if err := h.db.Where("id = ? AND project_id = ?", domainID, projectID).First(&domain).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Domain not found",
+		})
+	}
+
+	// Check that we're not deleting the last domain (of its environment)
 	var domainCount int64
-	h.db.Model(&models.Domain{}).Where("project_id = ?", projectID).Count(&domainCount)
+	h.db.Model(&models.Domain{}).Where("project_id = ? AND preview_id IS NULL", projectID).
+		Scopes(inEnvironment(domain.ProjectEnvironmentID)).Count(&domainCount)
 	if domainCount <= 1 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot delete the last domain. Projects must have at least one domain.",
@@ -698,10 +948,20 @@ func (h *ProjectHandler) DeleteDomain(c *fiber.Ctx) error {
 		})
 	}
 
+	// A domain's access policy and certificate go with it
+	h.db.Where("project_id = ? AND domain_id = ?", projectID, domainID).Delete(&models.AccessPolicy{})
+	var certificate models.Certificate
+	if h.db.Where("project_id = ? AND domain_id = ?", projectID, domainID).First(&certificate).Error == nil {
+		h.db.Delete(&certificate)
+	}
+
 	// Update Caddy configuration
 	if err := h.updateCaddyForProject(&project); err != nil {
 		println("Warning: Failed to update Caddy configuration:", err.Error())
 	}
+	if certificate.ID != 0 {
+		h.removeCertificateFiles(certificate.ID)
+	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -984,30 +1244,38 @@ func (h *ProjectHandler) UpdatePocketBase(c *fiber.Ctx) error {
 	}
 
 	// Create a new deployment to update PocketBase
-	deployment := models.Deployment{
+	newDeployment := models.Deployment{
 		ProjectID:     uint(projectID),
 		Status:        models.DeploymentPending,
 		CommitHash:    "pocketbase-update-" + latestVersion,
 		Branch:        project.GitBranch,
 		CommitMessage: fmt.Sprintf("Update PocketBase from %s to %s", project.PocketBaseVersion, latestVersion),
+		TriggeredBy:   "manual",
+		TriggeredByID: userID,
 	}
 
-	if err := h.db.Create(&deployment).Error; err != nil {
+	if err := h.db.Create(&newDeployment).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create deployment",
 		})
 	}
 
+	// Queue deployment for execution
+	if h.deploymentService != nil {
+		h.deploymentService.Enqueue(newDeployment.ID, newDeployment.ProjectID)
+		newDeployment.QueuePosition = h.deploymentService.QueuePosition(newDeployment.ID)
+	}
+
 	// Log the update request
 	log.Printf("PocketBase update requested for project %d: %s → %s",
 		project.ID, project.PocketBaseVersion, latestVersion)
 
 	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
 		"message":          "PocketBase update initiated",
-		"deployment_id":    deployment.ID,
+		"deployment_id":    newDeployment.ID,
 		"current_version":  project.PocketBaseVersion,
 		"target_version":   latestVersion,
-		"deployment":       deployment,
+		"deployment":       newDeployment,
 	})
 }
 
@@ -1059,8 +1327,8 @@ func (h *ProjectHandler) CreatePocketBaseAdmin(c *fiber.Ctx) error {
 
 	// Get PocketBase URL from project domains
 	var pocketbaseURL string
-	for _, domain := range project.Domains {
-		if domain.IsActive {
+	for _, domain := range project.SiteDomains() {
+		if domain.IsActive && domain.Verified() {
 			protocol := "https"
 			if !domain.SSLEnabled {
 				protocol = "http"
@@ -1240,12 +1508,14 @@ func (h *ProjectHandler) listSubdirectories(rootPath string) ([]string, error) {
 // updateCaddyForProject regenerates Caddy configuration for a project
 func (h *ProjectHandler) updateCaddyForProject(project *models.Project) error {
 	// Import caddy service
-	caddyService := caddy.NewCaddyService(h.cfg.CaddyConfigPath, h.cfg.CaddyReloadCmd)
 
 	// Reload domains for the project
 	var updatedProject models.Project
 	if err := h.db.Where("id = ?", project.ID).
 		Preload("Domains").
+		Preload("AccessPolicies.Users").
+		Preload("Certificates").
+		Preload("MaintenanceWindows", "ends_at > ?", time.Now()).
 		First(&updatedProject).Error; err != nil {
 		return err
 	}
@@ -1253,18 +1523,253 @@ func (h *ProjectHandler) updateCaddyForProject(project *models.Project) error {
 	// Check if project uses PocketBase
 	if updatedProject.BaaSType == models.BaaSPocketBase {
 		// Use PocketBase-specific config
-		if err := caddyService.GenerateConfigWithPocketBase(&updatedProject); err != nil {
+		if err := h.caddyService.GenerateConfigWithPocketBase(&updatedProject); err != nil {
 			return err
 		}
 	} else {
 		// Generate standard Caddy config
-		if err := caddyService.GenerateConfig(&updatedProject); err != nil {
+		if err := h.caddyService.GenerateConfig(&updatedProject); err != nil {
 			return err
 		}
+
+		// The project's other environments share its settings and domain list
+		var environments []models.ProjectEnvironment
+		h.db.Where("project_id = ? AND frontend_port <> 0", project.ID).Find(&environments)
+		for i := range environments {
+			environment := updatedProject.ForEnvironment(&environments[i])
+			if err := h.caddyService.GenerateConfig(&environment); err != nil {
+				log.Printf("Warning: failed to update Caddy configuration of environment %s: %v", environments[i].Name, err)
+			}
+		}
 	}
 
 	// Reload Caddy to apply changes
-	return caddyService.Reload()
+	return h.caddyService.Reload()
+}
+
+// isValidDeploymentPolicy checks a deployment policy against the supported values
+func isValidDeploymentPolicy(policy models.DeploymentPolicy) bool {
+	return policy == models.DeploymentPolicyQueue || policy == models.DeploymentPolicySupersede
+}
+
+// validateHealthCheck returns an error message for invalid health check settings, or "" if they are valid
+func validateHealthCheck(req *CreateProjectRequest) string {
+	if req.HealthCheckPath != "" && !strings.HasPrefix(req.HealthCheckPath, "/") {
+		return "Health check path must start with '/'"
+	}
+	if req.HealthCheckExpectedStatus != 0 && (req.HealthCheckExpectedStatus < 100 || req.HealthCheckExpectedStatus > 599) {
+		return "Health check expected status must be a valid HTTP status code"
+	}
+	if req.HealthCheckTimeout < 0 || req.HealthCheckRetries < 0 || req.HealthCheckStartPeriod < 0 {
+		return "Health check timeout, retries and start period cannot be negative"
+	}
+	return ""
+}
+
+const maxCustomHeaders = 50
+
+var (
+	headerNamePattern   = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	cspDirectivePattern = regexp.MustCompile(`^[a-z][a-z-]*$`)
+)
+
+// validateHeaders returns an error message for invalid header settings, or "" if they are valid
+// Values are written into the Caddyfile in double quotes, so quotes,
+// backslashes and control characters are rejected
+func validateHeaders(req *CreateProjectRequest) string {
+	switch req.HeaderProfile {
+	case models.HeaderProfileDefault, models.HeaderProfileStrict, models.HeaderProfileRelaxed, models.HeaderProfileCustom:
+	default:
+		return "Invalid header profile. Use 'strict', 'relaxed', 'custom' or leave empty"
+	}
+
+	if len(req.CustomHeaders) > maxCustomHeaders {
+		return fmt.Sprintf("A project can have at most %d custom headers", maxCustomHeaders)
+	}
+	for _, header := range req.CustomHeaders {
+		if !headerNamePattern.MatchString(header.Name) {
+			return fmt.Sprintf("Invalid header name: %q", header.Name)
+		}
+		if !isHeaderValue(header.Value) {
+			return fmt.Sprintf("Invalid value for header %s", header.Name)
+		}
+	}
+
+	for _, directive := range req.CSPDirectives {
+		if !cspDirectivePattern.MatchString(directive.Name) {
+			return fmt.Sprintf("Invalid CSP directive: %q", directive.Name)
+		}
+		for _, source := range directive.Sources {
+			if source == "" || !isHeaderValue(source) || strings.ContainsAny(source, " ;,") {
+				return fmt.Sprintf("Invalid source for CSP directive %s: %q", directive.Name, source)
+			}
+		}
+	}
+
+	return ""
+}
+
+// isHeaderValue reports whether s is printable ASCII that can be written in a quoted Caddyfile token
+// Braces are refused too, as Caddy would fill in placeholders like {env.SECRET}
+func isHeaderValue(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '{' || r == '}' {
+			return false
+		}
+	}
+	return true
+}
+
+const maxTriggerRules = 20
+
+// validateTriggerRules returns an error message for invalid trigger rules, or "" if they are valid
+func validateTriggerRules(rules []models.TriggerRule) string {
+	if len(rules) > maxTriggerRules {
+		return fmt.Sprintf("A project can have at most %d trigger rules", maxTriggerRules)
+	}
+	for _, rule := range rules {
+		if !rule.Valid() {
+			return fmt.Sprintf("Invalid trigger rule: %s %q. Use event 'tag' or 'release' with a glob such as v* or a range such as semver:>=1.4.0 <2.0.0", rule.Event, rule.Pattern)
+		}
+	}
+	return ""
+}
+
+const maxPathFilters = 50
+
+// validatePathFilters returns an error message for invalid path filters, or "" if they are valid
+func validatePathFilters(req *CreateProjectRequest) string {
+	if len(req.IncludePaths) > maxPathFilters || len(req.ExcludePaths) > maxPathFilters {
+		return fmt.Sprintf("A project can have at most %d include and %d exclude paths", maxPathFilters, maxPathFilters)
+	}
+	for _, pattern := range append(append([]string{}, req.IncludePaths...), req.ExcludePaths...) {
+		if !models.ValidPathPattern(pattern) {
+			return fmt.Sprintf("Invalid path filter: %q. Use globs relative to the repository root, such as frontend/** or **/*.md", pattern)
+		}
+	}
+	return ""
+}
+
+// projectHeaders returns the header settings of a project, to detect changes
+func projectHeaders(project *models.Project) []interface{} {
+	return []interface{}{project.HeaderProfile, project.CustomHeaders, project.CSPDirectives, project.CSPReportOnly}
+}
+
+// domainRoutingRequest holds the routing settings accepted when adding or updating a domain
+// Omitted fields are left unchanged
+type domainRoutingRequest struct {
+	IsPrimary         *bool                 `json:"is_primary"`
+	RedirectToPrimary *bool                 `json:"redirect_to_primary"`
+	RedirectCode      *int                  `json:"redirect_code"`
+	Canonical         *models.CanonicalHost `json:"canonical"`
+	Rules             *[]models.DomainRule  `json:"rules"`
+}
+
+func (r *domainRoutingRequest) apply(domain *models.Domain) {
+	if r.IsPrimary != nil {
+		domain.IsPrimary = *r.IsPrimary
+	}
+	if r.RedirectToPrimary != nil {
+		domain.RedirectToPrimary = *r.RedirectToPrimary
+	}
+	if r.RedirectCode != nil {
+		domain.RedirectCode = *r.RedirectCode
+	}
+	if r.Canonical != nil {
+		domain.Canonical = *r.Canonical
+	}
+	if r.Rules != nil {
+		domain.Rules = *r.Rules
+	}
+}
+
+// ensureSinglePrimary unsets the primary flag on the other domains of the project (or environment)
+func (h *ProjectHandler) ensureSinglePrimary(domain *models.Domain) {
+	if !domain.IsPrimary {
+		return
+	}
+	if err := h.db.Model(&models.Domain{}).
+		Where("project_id = ? AND id <> ?", domain.ProjectID, domain.ID).
+		Scopes(inEnvironment(domain.ProjectEnvironmentID)).
+		Update("is_primary", false).Error; err != nil {
+		log.Printf("Warning: failed to unset previous primary domain of project %d: %v", domain.ProjectID, err)
+	}
+}
+
+const maxDomainRules = 50
+
+var domainNamePattern = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+[a-zA-Z0-9-]+$`)
+
+// validateDomain returns an error message for an invalid domain or routing settings, or "" if they are valid
+// Values end up in the Caddyfile, so anything that could break out of a directive is rejected
+func validateDomain(domain *models.Domain) string {
+	if !domainNamePattern.MatchString(domain.Domain) {
+		return "Invalid domain name"
+	}
+	if domain.IsPrimary && domain.RedirectToPrimary {
+		return "The primary domain cannot redirect to itself"
+	}
+	if domain.RedirectCode != 0 && domain.RedirectCode != 301 && domain.RedirectCode != 308 {
+		return "Redirect code must be 301 or 308"
+	}
+	switch domain.Canonical {
+	case models.CanonicalNone, models.CanonicalWWW, models.CanonicalApex:
+	default:
+		return "Canonical host must be 'www', 'apex' or empty"
+	}
+
+	if len(domain.Rules) > maxDomainRules {
+		return fmt.Sprintf("A domain can have at most %d rules", maxDomainRules)
+	}
+	for i, rule := range domain.Rules {
+		n := i + 1
+		switch rule.Type {
+		case models.DomainRuleRedirect:
+			switch rule.Code {
+			case 0, 301, 302, 307, 308:
+			default:
+				return fmt.Sprintf("Rule %d: redirect code must be 301, 302, 307 or 308", n)
+			}
+		case models.DomainRuleRewrite:
+			if rule.Code != 0 {
+				return fmt.Sprintf("Rule %d: rewrites don't take a status code", n)
+			}
+		default:
+			return fmt.Sprintf("Rule %d: type must be 'redirect' or 'rewrite'", n)
+		}
+		if !strings.HasPrefix(rule.Path, "/") || !isCaddyToken(rule.Path) || strings.ContainsAny(rule.Path, "{}") {
+			return fmt.Sprintf("Rule %d: path must start with '/' and cannot contain spaces, quotes or braces", n)
+		}
+		if rule.To == "" || !isCaddyToken(rule.To) {
+			return fmt.Sprintf("Rule %d: target is required and cannot contain spaces or quotes", n)
+		}
+		if !hasRulePlaceholdersOnly(rule.To) {
+			return fmt.Sprintf("Rule %d: target can only use the placeholders {uri}, {path} and {query}", n)
+		}
+	}
+
+	return ""
+}
+
+// isCaddyToken reports whether s is a single Caddyfile token that can't start a comment or block
+func isCaddyToken(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " \t\r\n\"'`#") && s != "{" && s != "}"
+}
+
+// rulePlaceholders are the request placeholders rule targets may use; others
+// like {env.*} and {$VAR} would expose the server's environment
+var rulePlaceholders = map[string]bool{"{uri}": true, "{path}": true, "{query}": true}
+
+var bracePattern = regexp.MustCompile(`\{[^{}]*\}|[{}]`)
+
+// hasRulePlaceholdersOnly reports whether every brace in s is part of an allowed placeholder
+func hasRulePlaceholdersOnly(s string) bool {
+	for _, match := range bracePattern.FindAllString(s, -1) {
+		if !rulePlaceholders[match] {
+			return false
+		}
+	}
+	return true
 }
 
 func randomString(length int) string {
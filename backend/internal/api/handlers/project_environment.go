@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// environmentNamePattern keeps names usable in container names and subdomains
+var environmentNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+// GetProjectEnvironments lists the environments of a project besides
+// production, which is the project itself
+func (h *ProjectHandler) GetProjectEnvironments(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var environments []models.ProjectEnvironment
+	h.db.Where("project_id = ?", projectID).Preload("Domains").Order("name ASC").Find(&environments)
+
+	return c.JSON(fiber.Map{
+		"environments": environments,
+	})
+}
+
+// AddProjectEnvironment creates an environment; it's deployed like the
+// project, from its own branch, once a deployment to it is triggered
+func (h *ProjectHandler) AddProjectEnvironment(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var req struct {
+		Name       string `json:"name"`
+		GitBranch  string `json:"git_branch"`
+		AutoDeploy *bool  `json:"auto_deploy"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	environment := models.ProjectEnvironment{
+		ProjectID:  uint(projectID),
+		Name:       strings.ToLower(strings.TrimSpace(req.Name)),
+		GitBranch:  strings.TrimSpace(req.GitBranch),
+		AutoDeploy: true,
+	}
+	if req.AutoDeploy != nil {
+		environment.AutoDeploy = *req.AutoDeploy
+	}
+
+	if project.BaaSType == models.BaaSPocketBase {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Environments aren't supported for PocketBase projects",
+		})
+	}
+	if !environmentNamePattern.MatchString(environment.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Environment names are 1-32 lowercase letters, digits and hyphens",
+		})
+	}
+	if environment.Name == models.ProductionEnvironment {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The project itself is the production environment",
+		})
+	}
+	if environment.GitBranch == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Git branch is required",
+		})
+	}
+
+	var count int64
+	h.db.Model(&models.ProjectEnvironment{}).Where("project_id = ? AND name = ?", projectID, environment.Name).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Environment already exists",
+		})
+	}
+
+	if err := h.db.Create(&environment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create environment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(environment)
+}
+
+// UpdateProjectEnvironment changes the branch of an environment or whether
+// pushes to it are deployed; the next deployment picks up a new branch
+func (h *ProjectHandler) UpdateProjectEnvironment(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	environmentID, _ := strconv.ParseUint(c.Params("environmentId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var environment models.ProjectEnvironment
+	if err := h.db.Where("id = ? AND project_id = ?", environmentID, projectID).First(&environment).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
+	var req struct {
+		GitBranch  *string `json:"git_branch"`
+		AutoDeploy *bool   `json:"auto_deploy"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.GitBranch != nil {
+		environment.GitBranch = strings.TrimSpace(*req.GitBranch)
+		if environment.GitBranch == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Git branch is required",
+			})
+		}
+	}
+	if req.AutoDeploy != nil {
+		environment.AutoDeploy = *req.AutoDeploy
+	}
+
+	if err := h.db.Model(&environment).Select("GitBranch", "AutoDeploy").Updates(&environment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update environment",
+		})
+	}
+
+	return c.JSON(environment)
+}
+
+// DeleteProjectEnvironment deletes an environment with its container,
+// domains and variables; its deployment history is kept
+func (h *ProjectHandler) DeleteProjectEnvironment(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(uint)
+	projectID, _ := strconv.ParseUint(c.Params("id"), 10, 32)
+	environmentID, _ := strconv.ParseUint(c.Params("environmentId"), 10, 32)
+
+	var project models.Project
+	if err := h.db.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	var environment models.ProjectEnvironment
+	if err := h.db.Where("id = ? AND project_id = ?", environmentID, projectID).First(&environment).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Environment not found",
+		})
+	}
+
+	if h.deploymentService == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Deployment service not available",
+		})
+	}
+
+	if err := h.deploymentService.DeleteEnvironment(&environment); err != nil {
+		log.Printf("Failed to delete environment %d: %v", environment.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete environment",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// findProjectEnvironment loads an environment of a project; a nil ID stands
+// for production and returns nil. ok is false when the environment doesn't
+// exist or belongs to another project
+func findProjectEnvironment(db *gorm.DB, projectID uint64, environmentID *uint) (environment *models.ProjectEnvironment, ok bool) {
+	if environmentID == nil {
+		return nil, true
+	}
+
+	environment = &models.ProjectEnvironment{}
+	if err := db.Where("id = ? AND project_id = ?", *environmentID, projectID).First(environment).Error; err != nil {
+		return nil, false
+	}
+	return environment, true
+}
+
+// queryEnvironmentID reads the project_environment_id query parameter; nil
+// (production) when it's missing or 0
+func queryEnvironmentID(c *fiber.Ctx) *uint {
+	id, err := strconv.ParseUint(c.Query("project_environment_id"), 10, 32)
+	if err != nil || id == 0 {
+		return nil
+	}
+	environmentID := uint(id)
+	return &environmentID
+}
+
+// inEnvironment scopes a query on domains, environment variables or
+// deployments to one environment, or production for a nil ID
+func inEnvironment(environmentID *uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if environmentID == nil {
+			return db.Where("project_environment_id IS NULL")
+		}
+		return db.Where("project_environment_id = ?", *environmentID)
+	}
+}
@@ -17,7 +17,6 @@ import (
 	"github.com/vps-panel/backend/internal/models"
 	"github.com/vps-panel/backend/internal/services/deployment"
 	"github.com/vps-panel/backend/internal/services/webhook"
-	"github.com/vps-panel/backend/internal/services/websocket"
 )
 
 type WebhookHandler struct {
@@ -27,10 +26,9 @@ type WebhookHandler struct {
 	webhookService    *webhook.Service
 }
 
-func NewWebhookHandler(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub) (*WebhookHandler, error) {
-	deploymentService, err := deployment.NewDeploymentService(db, cfg, wsHub)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create deployment service: %w", err)
+func NewWebhookHandler(db *gorm.DB, cfg *config.Config, deploymentService *deployment.DeploymentService) (*WebhookHandler, error) {
+	if deploymentService == nil {
+		return nil, fmt.Errorf("failed to create deployment service: Docker is unavailable")
 	}
 
 	webhookService := webhook.NewService()
@@ -43,9 +41,26 @@ func NewWebhookHandler(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub) (*
 	}, nil
 }
 
+// PushCommit is a commit of a GitHub, GitLab or Gitea push payload
+type PushCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Author  struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// githubMaxPushCommits is the most commits GitHub lists in a push payload
+const githubMaxPushCommits = 2048
+
 // GitHub webhook payload structures
 type GitHubPushPayload struct {
 	Ref        string `json:"ref"`
+	Deleted    bool   `json:"deleted"` // The branch or tag was deleted
 	Repository struct {
 		CloneURL string `json:"clone_url"`
 		HTMLURL  string `json:"html_url"`
@@ -59,6 +74,7 @@ type GitHubPushPayload struct {
 			Email string `json:"email"`
 		} `json:"author"`
 	} `json:"head_commit"`
+	Commits []PushCommit `json:"commits"`
 }
 
 // GitLab webhook payload structures
@@ -68,14 +84,8 @@ type GitLabPushPayload struct {
 		HTTPUrl string `json:"http_url"`
 		SSHUrl  string `json:"ssh_url"`
 	} `json:"project"`
-	Commits []struct {
-		ID      string `json:"id"`
-		Message string `json:"message"`
-		Author  struct {
-			Name  string `json:"name"`
-			Email string `json:"email"`
-		} `json:"author"`
-	} `json:"commits"`
+	Commits           []PushCommit `json:"commits"`             // At most 20
+	TotalCommitsCount int          `json:"total_commits_count"` // Commits pushed
 }
 
 // Gitea webhook payload structures (similar to GitHub)
@@ -94,6 +104,140 @@ type GiteaPushPayload struct {
 			Email string `json:"email"`
 		} `json:"author"`
 	} `json:"head_commit"`
+	Commits      []PushCommit `json:"commits"`       // As many as Gitea's FEED_MAX_COMMIT_NUM
+	TotalCommits int          `json:"total_commits"` // Commits pushed
+}
+
+// GitLab tag push event payload
+type GitLabTagPushPayload struct {
+	Ref         string `json:"ref"`
+	CheckoutSHA string `json:"checkout_sha"` // Empty when the tag was deleted
+	Message     string `json:"message"`      // Message of an annotated tag
+	UserName    string `json:"user_name"`
+}
+
+// GitHub release event payload
+type GitHubReleasePayload struct {
+	Action  string `json:"action"` // published, created, edited, deleted, ...
+	Release struct {
+		TagName string `json:"tag_name"`
+		Name    string `json:"name"`
+		Author  struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	} `json:"release"`
+}
+
+// Gitea release event payload (similar to GitHub)
+type GiteaReleasePayload struct {
+	Action  string `json:"action"` // published, updated, deleted
+	Release struct {
+		TagName string `json:"tag_name"`
+		Name    string `json:"name"`
+		Author  struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	} `json:"release"`
+}
+
+// GitHub pull_request event payload
+type GitHubPullRequestPayload struct {
+	Action      string `json:"action"` // opened, reopened, synchronize, closed, ...
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		User    struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Head struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo struct {
+				ID int64 `json:"id"`
+			} `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Repo struct {
+				ID int64 `json:"id"`
+			} `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// GitLab merge request event payload
+type GitLabMergeRequestPayload struct {
+	User struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	ObjectAttributes struct {
+		IID             int    `json:"iid"`
+		Title           string `json:"title"`
+		URL             string `json:"url"`
+		Action          string `json:"action"` // open, reopen, update, close, merge, ...
+		OldRev          string `json:"oldrev"` // Set on updates that pushed commits
+		SourceBranch    string `json:"source_branch"`
+		SourceProjectID int64  `json:"source_project_id"`
+		TargetProjectID int64  `json:"target_project_id"`
+		LastCommit      struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
+
+// Gitea pull_request event payload (similar to GitHub)
+type GiteaPullRequestPayload struct {
+	Action      string `json:"action"` // opened, reopened, synchronized, closed, ...
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		User    struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Head struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo struct {
+				ID int64 `json:"id"`
+			} `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Repo struct {
+				ID int64 `json:"id"`
+			} `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// pullRequestEvent is what a pull/merge request event means for its preview
+type pullRequestEvent struct {
+	action      string // previewDeploy, previewClose, or "" to ignore the event
+	pullRequest deployment.PullRequest
+	fork        bool // Opened from another repository
+}
+
+const (
+	previewDeploy = "deploy"
+	previewClose  = "close"
+)
+
+// pushEvent is a push to a branch of the project's repository
+type pushEvent struct {
+	branch        string
+	commitHash    string
+	commitMessage string
+	commitAuthor  string
+	changedFiles  []string // nil when the payload doesn't list every changed file
+}
+
+// tagEvent is a tag pushed to the project's repository, or a release published for one
+type tagEvent struct {
+	event         string // models.TriggerEventTag or models.TriggerEventRelease
+	tag           string
+	commitHash    string // Unknown for releases; the deployment records it once cloned
+	commitMessage string
+	commitAuthor  string
 }
 
 // HandleGitHub processes GitHub webhook events
@@ -131,64 +275,90 @@ func (h *WebhookHandler) HandleGitHub(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse payload
-	var payload GitHubPushPayload
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid payload",
-		})
-	}
+	// Pull requests are deployed to previews
+	if c.Get("X-GitHub-Event") == "pull_request" {
+		var payload GitHubPullRequestPayload
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid payload",
+			})
+		}
 
-	// Extract branch from ref (refs/heads/main -> main)
-	branch := strings.TrimPrefix(payload.Ref, "refs/heads/")
+		event := pullRequestEvent{
+			pullRequest: deployment.PullRequest{
+				Number:     payload.Number,
+				Title:      payload.PullRequest.Title,
+				URL:        payload.PullRequest.HTMLURL,
+				Branch:     payload.PullRequest.Head.Ref,
+				CommitHash: payload.PullRequest.Head.SHA,
+				Author:     payload.PullRequest.User.Login,
+			},
+			fork: payload.PullRequest.Head.Repo.ID != payload.PullRequest.Base.Repo.ID,
+		}
+		switch payload.Action {
+		case "opened", "reopened", "synchronize":
+			event.action = previewDeploy
+		case "closed":
+			event.action = previewClose
+		}
 
-	// Check if this is the branch we should auto-deploy
-	targetBranch := project.AutoDeployBranch
-	if targetBranch == "" {
-		targetBranch = project.GitBranch // Default to project's main branch
+		return h.handlePullRequest(c, &project, event, "webhook-github")
 	}
 
-	if branch != targetBranch {
-		return c.JSON(fiber.Map{
-			"message": fmt.Sprintf("Push to %s ignored. Auto-deploy configured for %s", branch, targetBranch),
-		})
-	}
+	// Published releases are deployed by trigger rules
+	if c.Get("X-GitHub-Event") == "release" {
+		var payload GitHubReleasePayload
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid payload",
+			})
+		}
 
-	// Create deployment
-	now := time.Now()
-	newDeployment := models.Deployment{
-		ProjectID:     project.ID,
-		CommitHash:    payload.HeadCommit.ID,
-		CommitMessage: payload.HeadCommit.Message,
-		CommitAuthor:  payload.HeadCommit.Author.Name,
-		Branch:        branch,
-		Status:        models.DeploymentPending,
-		TriggeredBy:   "webhook-github",
-		StartedAt:     &now,
+		if payload.Action != "published" {
+			return c.JSON(fiber.Map{
+				"message": fmt.Sprintf("Release event %q ignored", payload.Action),
+			})
+		}
+
+		return h.handleTag(c, &project, tagEvent{
+			event:         models.TriggerEventRelease,
+			tag:           payload.Release.TagName,
+			commitMessage: releaseMessage(payload.Release.Name, payload.Release.TagName),
+			commitAuthor:  payload.Release.Author.Login,
+		}, "webhook-github")
 	}
 
-	if err := h.db.Create(&newDeployment).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create deployment",
+	// Parse payload
+	var payload GitHubPushPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid payload",
 		})
 	}
 
-	// Trigger deployment asynchronously
-	go func() {
-		if err := h.deploymentService.Deploy(newDeployment.ID); err != nil {
-			log.Printf("Webhook deployment failed for project %d: %v", project.ID, err)
-		} else {
-			log.Printf("Webhook deployment successful for project %d (deployment %d)", project.ID, newDeployment.ID)
+	if tag, ok := strings.CutPrefix(payload.Ref, "refs/tags/"); ok {
+		if payload.Deleted {
+			return c.JSON(fiber.Map{
+				"message": fmt.Sprintf("Deletion of tag %s ignored", tag),
+			})
 		}
-	}()
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":       "Deployment triggered successfully",
-		"deployment_id": newDeployment.ID,
-		"project_id":    project.ID,
-		"branch":        branch,
-		"commit":        payload.HeadCommit.ID[:7],
-	})
+		return h.handleTag(c, &project, tagEvent{
+			event:         models.TriggerEventTag,
+			tag:           tag,
+			commitHash:    payload.HeadCommit.ID,
+			commitMessage: payload.HeadCommit.Message,
+			commitAuthor:  payload.HeadCommit.Author.Name,
+		}, "webhook-github")
+	}
+
+	return h.handlePush(c, &project, pushEvent{
+		branch:        strings.TrimPrefix(payload.Ref, "refs/heads/"), // refs/heads/main -> main
+		commitHash:    payload.HeadCommit.ID,
+		commitMessage: payload.HeadCommit.Message,
+		commitAuthor:  payload.HeadCommit.Author.Name,
+		changedFiles:  changedFiles(payload.Commits, len(payload.Commits) < githubMaxPushCommits),
+	}, "webhook-github")
 }
 
 // HandleGitLab processes GitLab webhook events
@@ -226,73 +396,85 @@ func (h *WebhookHandler) HandleGitLab(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse payload
-	var payload GitLabPushPayload
-	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid payload",
-		})
+	// Merge requests are deployed to previews
+	if c.Get("X-Gitlab-Event") == "Merge Request Hook" {
+		var payload GitLabMergeRequestPayload
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid payload",
+			})
+		}
+
+		attrs := payload.ObjectAttributes
+		event := pullRequestEvent{
+			pullRequest: deployment.PullRequest{
+				Number:     attrs.IID,
+				Title:      attrs.Title,
+				URL:        attrs.URL,
+				Branch:     attrs.SourceBranch,
+				CommitHash: attrs.LastCommit.ID,
+				Author:     payload.User.Name,
+			},
+			fork: attrs.SourceProjectID != attrs.TargetProjectID,
+		}
+		switch {
+		case attrs.Action == "open" || attrs.Action == "reopen":
+			event.action = previewDeploy
+		case attrs.Action == "update" && attrs.OldRev != "": // Title and label edits are updates too
+			event.action = previewDeploy
+		case attrs.Action == "close" || attrs.Action == "merge":
+			event.action = previewClose
+		}
+
+		return h.handlePullRequest(c, &project, event, "webhook-gitlab")
 	}
 
-	// Extract branch from ref (refs/heads/main -> main)
-	branch := strings.TrimPrefix(payload.Ref, "refs/heads/")
+	// Tags are deployed by trigger rules
+	if c.Get("X-Gitlab-Event") == "Tag Push Hook" {
+		var payload GitLabTagPushPayload
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid payload",
+			})
+		}
 
-	// Check if this is the branch we should auto-deploy
-	targetBranch := project.AutoDeployBranch
-	if targetBranch == "" {
-		targetBranch = project.GitBranch
+		tag := strings.TrimPrefix(payload.Ref, "refs/tags/")
+		if payload.CheckoutSHA == "" {
+			return c.JSON(fiber.Map{
+				"message": fmt.Sprintf("Deletion of tag %s ignored", tag),
+			})
+		}
+
+		return h.handleTag(c, &project, tagEvent{
+			event:         models.TriggerEventTag,
+			tag:           tag,
+			commitHash:    payload.CheckoutSHA,
+			commitMessage: payload.Message,
+			commitAuthor:  payload.UserName,
+		}, "webhook-gitlab")
 	}
 
-	if branch != targetBranch {
-		return c.JSON(fiber.Map{
-			"message": fmt.Sprintf("Push to %s ignored. Auto-deploy configured for %s", branch, targetBranch),
+	// Parse payload
+	var payload GitLabPushPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid payload",
 		})
 	}
 
 	// Get latest commit info
-	var commitID, commitMessage, commitAuthor string
+	push := pushEvent{
+		branch:       strings.TrimPrefix(payload.Ref, "refs/heads/"), // refs/heads/main -> main
+		changedFiles: changedFiles(payload.Commits, len(payload.Commits) == payload.TotalCommitsCount),
+	}
 	if len(payload.Commits) > 0 {
 		lastCommit := payload.Commits[len(payload.Commits)-1]
-		commitID = lastCommit.ID
-		commitMessage = lastCommit.Message
-		commitAuthor = lastCommit.Author.Name
+		push.commitHash = lastCommit.ID
+		push.commitMessage = lastCommit.Message
+		push.commitAuthor = lastCommit.Author.Name
 	}
 
-	// Create deployment
-	now := time.Now()
-	newDeployment := models.Deployment{
-		ProjectID:     project.ID,
-		CommitHash:    commitID,
-		CommitMessage: commitMessage,
-		CommitAuthor:  commitAuthor,
-		Branch:        branch,
-		Status:        models.DeploymentPending,
-		TriggeredBy:   "webhook-gitlab",
-		StartedAt:     &now,
-	}
-
-	if err := h.db.Create(&newDeployment).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create deployment",
-		})
-	}
-
-	// Trigger deployment asynchronously
-	go func() {
-		if err := h.deploymentService.Deploy(newDeployment.ID); err != nil {
-			log.Printf("Webhook deployment failed for project %d: %v", project.ID, err)
-		} else {
-			log.Printf("Webhook deployment successful for project %d (deployment %d)", project.ID, newDeployment.ID)
-		}
-	}()
-
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":       "Deployment triggered successfully",
-		"deployment_id": newDeployment.ID,
-		"project_id":    project.ID,
-		"branch":        branch,
-		"commit":        commitID[:7],
-	})
+	return h.handlePush(c, &project, push, "webhook-gitlab")
 }
 
 // HandleGitea processes Gitea webhook events
@@ -330,6 +512,59 @@ func (h *WebhookHandler) HandleGitea(c *fiber.Ctx) error {
 		})
 	}
 
+	// Pull requests are deployed to previews
+	if c.Get("X-Gitea-Event") == "pull_request" {
+		var payload GiteaPullRequestPayload
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid payload",
+			})
+		}
+
+		event := pullRequestEvent{
+			pullRequest: deployment.PullRequest{
+				Number:     payload.Number,
+				Title:      payload.PullRequest.Title,
+				URL:        payload.PullRequest.HTMLURL,
+				Branch:     payload.PullRequest.Head.Ref,
+				CommitHash: payload.PullRequest.Head.SHA,
+				Author:     payload.PullRequest.User.Login,
+			},
+			fork: payload.PullRequest.Head.Repo.ID != payload.PullRequest.Base.Repo.ID,
+		}
+		switch payload.Action {
+		case "opened", "reopened", "synchronized":
+			event.action = previewDeploy
+		case "closed":
+			event.action = previewClose
+		}
+
+		return h.handlePullRequest(c, &project, event, "webhook-gitea")
+	}
+
+	// Published releases are deployed by trigger rules
+	if c.Get("X-Gitea-Event") == "release" {
+		var payload GiteaReleasePayload
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid payload",
+			})
+		}
+
+		if payload.Action != "published" {
+			return c.JSON(fiber.Map{
+				"message": fmt.Sprintf("Release event %q ignored", payload.Action),
+			})
+		}
+
+		return h.handleTag(c, &project, tagEvent{
+			event:         models.TriggerEventRelease,
+			tag:           payload.Release.TagName,
+			commitMessage: releaseMessage(payload.Release.Name, payload.Release.TagName),
+			commitAuthor:  payload.Release.Author.Login,
+		}, "webhook-gitea")
+	}
+
 	// Parse payload (Gitea uses same format as GitHub)
 	var payload GiteaPushPayload
 	if err := c.BodyParser(&payload); err != nil {
@@ -338,31 +573,161 @@ func (h *WebhookHandler) HandleGitea(c *fiber.Ctx) error {
 		})
 	}
 
-	// Extract branch from ref (refs/heads/main -> main)
-	branch := strings.TrimPrefix(payload.Ref, "refs/heads/")
+	// Gitea reports deleted tags with a delete event instead of a push
+	if tag, ok := strings.CutPrefix(payload.Ref, "refs/tags/"); ok {
+		return h.handleTag(c, &project, tagEvent{
+			event:         models.TriggerEventTag,
+			tag:           tag,
+			commitHash:    payload.HeadCommit.ID,
+			commitMessage: payload.HeadCommit.Message,
+			commitAuthor:  payload.HeadCommit.Author.Name,
+		}, "webhook-gitea")
+	}
+
+	return h.handlePush(c, &project, pushEvent{
+		branch:        strings.TrimPrefix(payload.Ref, "refs/heads/"), // refs/heads/main -> main
+		commitHash:    payload.HeadCommit.ID,
+		commitMessage: payload.HeadCommit.Message,
+		commitAuthor:  payload.HeadCommit.Author.Name,
+		changedFiles:  changedFiles(payload.Commits, len(payload.Commits) == payload.TotalCommits),
+	}, "webhook-gitea")
+}
 
+// handlePush deploys a push to every environment tracking its branch: the
+// project itself (production) and its other environments with auto-deploy on
+func (h *WebhookHandler) handlePush(c *fiber.Ctx, project *models.Project, push pushEvent, triggeredBy string) error {
 	// Check if this is the branch we should auto-deploy
 	targetBranch := project.AutoDeployBranch
 	if targetBranch == "" {
-		targetBranch = project.GitBranch
+		targetBranch = project.GitBranch // Default to project's main branch
+	}
+
+	var targets []*models.ProjectEnvironment // nil stands for production
+	if push.branch == targetBranch {
+		targets = append(targets, nil)
+	}
+
+	var environments []models.ProjectEnvironment
+	h.db.Where("project_id = ? AND git_branch = ? AND auto_deploy = ?", project.ID, push.branch, true).
+		Order("id ASC").
+		Find(&environments)
+	for i := range environments {
+		targets = append(targets, &environments[i])
+	}
+
+	if len(targets) == 0 {
+		return c.JSON(fiber.Map{
+			"message": fmt.Sprintf("Push to %s ignored. Auto-deploy configured for %s", push.branch, targetBranch),
+		})
+	}
+
+	// Monorepo path filters: pushes that change none of the project's files
+	// are recorded as skipped. Without the full list of changed files, the
+	// deployment compares with the last deployed commit once it's cloned
+	var skipReason string
+	checkPaths := false
+	if project.HasPathFilters() {
+		if push.changedFiles == nil {
+			checkPaths = true
+		} else if !project.DeploysChanges(push.changedFiles) {
+			skipReason = fmt.Sprintf("None of the %d file(s) changed by the push match the project's path filters", len(push.changedFiles))
+		}
+	}
+
+	// Create a deployment per environment
+	now := time.Now()
+	var triggered []fiber.Map
+	for _, environment := range targets {
+		newDeployment := models.Deployment{
+			ProjectID:     project.ID,
+			CommitHash:    push.commitHash,
+			CommitMessage: push.commitMessage,
+			CommitAuthor:  push.commitAuthor,
+			Branch:        push.branch,
+			Status:        models.DeploymentPending,
+			CheckPaths:    checkPaths,
+			TriggeredBy:   triggeredBy,
+			StartedAt:     &now,
+		}
+		if skipReason != "" {
+			newDeployment.Status = models.DeploymentSkipped
+			newDeployment.SkipReason = skipReason
+			newDeployment.CompletedAt = &now
+		}
+		name := models.ProductionEnvironment
+		if environment != nil {
+			newDeployment.ProjectEnvironmentID = &environment.ID
+			name = environment.Name
+		}
+
+		if err := h.db.Create(&newDeployment).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create deployment",
+			})
+		}
+
+		if skipReason != "" {
+			triggered = append(triggered, fiber.Map{
+				"deployment_id": newDeployment.ID,
+				"environment":   name,
+			})
+			continue
+		}
+
+		// Queue deployment for execution
+		h.deploymentService.Enqueue(newDeployment.ID, project.ID)
+
+		triggered = append(triggered, fiber.Map{
+			"deployment_id":  newDeployment.ID,
+			"environment":    name,
+			"queue_position": h.deploymentService.QueuePosition(newDeployment.ID),
+		})
 	}
 
-	if branch != targetBranch {
+	// Acknowledged, so the Git provider doesn't report the webhook as failing
+	if skipReason != "" {
 		return c.JSON(fiber.Map{
-			"message": fmt.Sprintf("Push to %s ignored. Auto-deploy configured for %s", branch, targetBranch),
+			"message":       fmt.Sprintf("Push to %s skipped: %s", push.branch, skipReason),
+			"skipped":       true,
+			"reason":        skipReason,
+			"deployment_id": triggered[0]["deployment_id"],
+			"deployments":   triggered,
+			"project_id":    project.ID,
+			"branch":        push.branch,
+			"commit":        shortCommit(push.commitHash),
+		})
+	}
+
+	// deployment_id and queue_position are those of the first deployment
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":        "Deployment triggered successfully",
+		"deployment_id":  triggered[0]["deployment_id"],
+		"queue_position": triggered[0]["queue_position"],
+		"deployments":    triggered,
+		"project_id":     project.ID,
+		"branch":         push.branch,
+		"commit":         shortCommit(push.commitHash),
+	})
+}
+
+// handleTag deploys a tag to production when one of the project's trigger
+// rules for the event matches it; the deployment checks out the tag itself
+func (h *WebhookHandler) handleTag(c *fiber.Ctx, project *models.Project, event tagEvent, triggeredBy string) error {
+	if project.TriggerRuleFor(event.event, event.tag) == nil {
+		return c.JSON(fiber.Map{
+			"message": fmt.Sprintf("Tag %s ignored. No %s trigger rule matches it", event.tag, event.event),
 		})
 	}
 
-	// Create deployment
 	now := time.Now()
 	newDeployment := models.Deployment{
 		ProjectID:     project.ID,
-		CommitHash:    payload.HeadCommit.ID,
-		CommitMessage: payload.HeadCommit.Message,
-		CommitAuthor:  payload.HeadCommit.Author.Name,
-		Branch:        branch,
+		CommitHash:    event.commitHash,
+		CommitMessage: event.commitMessage,
+		CommitAuthor:  event.commitAuthor,
+		Tag:           event.tag,
 		Status:        models.DeploymentPending,
-		TriggeredBy:   "webhook-gitea",
+		TriggeredBy:   triggeredBy,
 		StartedAt:     &now,
 	}
 
@@ -372,21 +737,124 @@ func (h *WebhookHandler) HandleGitea(c *fiber.Ctx) error {
 		})
 	}
 
-	// Trigger deployment asynchronously
-	go func() {
-		if err := h.deploymentService.Deploy(newDeployment.ID); err != nil {
-			log.Printf("Webhook deployment failed for project %d: %v", project.ID, err)
-		} else {
-			log.Printf("Webhook deployment successful for project %d (deployment %d)", project.ID, newDeployment.ID)
-		}
-	}()
+	// Queue deployment for execution
+	h.deploymentService.Enqueue(newDeployment.ID, project.ID)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":       "Deployment triggered successfully",
-		"deployment_id": newDeployment.ID,
-		"project_id":    project.ID,
-		"branch":        branch,
-		"commit":        payload.HeadCommit.ID[:7],
+		"message":        fmt.Sprintf("Deployment of tag %s triggered successfully", event.tag),
+		"deployment_id":  newDeployment.ID,
+		"queue_position": h.deploymentService.QueuePosition(newDeployment.ID),
+		"project_id":     project.ID,
+		"tag":            event.tag,
+		"commit":         shortCommit(event.commitHash),
+	})
+}
+
+// releaseMessage describes a release for the deployment's commit message
+func releaseMessage(name, tag string) string {
+	if name == "" {
+		name = tag
+	}
+	return "Release " + name
+}
+
+// changedFiles collects the files changed by a push's commits, or nil when
+// the payload didn't list all of them (complete is false) or no files at all
+func changedFiles(commits []PushCommit, complete bool) []string {
+	if !complete {
+		return nil
+	}
+
+	var files []string
+	for _, commit := range commits {
+		files = append(files, commit.Added...)
+		files = append(files, commit.Removed...)
+		files = append(files, commit.Modified...)
+	}
+	return files
+}
+
+// shortCommit abbreviates a commit hash like git does
+func shortCommit(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+// handlePullRequest deploys a pull request to its preview, or removes the
+// preview when the pull request is closed or merged
+func (h *WebhookHandler) handlePullRequest(c *fiber.Ctx, project *models.Project, event pullRequestEvent, triggeredBy string) error {
+	number := event.pullRequest.Number
+
+	switch event.action {
+	case previewClose:
+		var preview models.Preview
+		if err := h.db.Where("project_id = ? AND number = ? AND status <> ?", project.ID, number, models.PreviewClosed).
+			First(&preview).Error; err != nil {
+			return c.JSON(fiber.Map{
+				"message": fmt.Sprintf("Pull request #%d has no preview deployment", number),
+			})
+		}
+
+		if err := h.deploymentService.ClosePreview(&preview); err != nil {
+			log.Printf("Failed to close preview %d of project %d: %v", preview.ID, project.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to remove preview deployment",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message":    fmt.Sprintf("Preview deployment of pull request #%d is being removed", number),
+			"preview_id": preview.ID,
+			"project_id": project.ID,
+		})
+
+	case previewDeploy:
+		// Previews opened before they were disabled are still removed on close
+		if !project.PreviewDeployments {
+			return c.JSON(fiber.Map{
+				"message": "Preview deployments are disabled for this project",
+			})
+		}
+		// Fork branches aren't in the project's repository, and would run with its environment variables
+		if event.fork {
+			return c.JSON(fiber.Map{
+				"message": fmt.Sprintf("Pull request #%d comes from a fork, which doesn't get a preview deployment", number),
+			})
+		}
+		if project.BaaSType == models.BaaSPocketBase {
+			return c.JSON(fiber.Map{
+				"message": "Preview deployments aren't supported for PocketBase projects",
+			})
+		}
+		if h.cfg.PanelDomain == "" {
+			return c.JSON(fiber.Map{
+				"message": "Preview deployments need PANEL_DOMAIN to be set for their subdomains",
+			})
+		}
+
+		preview, newDeployment, err := h.deploymentService.DeployPreview(project.ID, event.pullRequest, triggeredBy)
+		if err != nil {
+			log.Printf("Failed to deploy preview of pull request #%d of project %d: %v", number, project.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create deployment",
+			})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"message":        fmt.Sprintf("Preview deployment of pull request #%d triggered successfully", number),
+			"deployment_id":  newDeployment.ID,
+			"preview_id":     preview.ID,
+			"queue_position": newDeployment.QueuePosition,
+			"project_id":     project.ID,
+			"branch":         event.pullRequest.Branch,
+			"commit":         event.pullRequest.CommitHash,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("Event for pull request #%d ignored", number),
 	})
 }
 
@@ -7,10 +7,14 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenTypeAccess marks JWTs that may be used as bearer tokens
+const TokenTypeAccess = "access"
+
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	TokenType string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
@@ -53,6 +57,13 @@ func AuthMiddleware(jwtSecret string) fiber.Handler {
 			})
 		}
 
+		// Only access tokens are accepted (older refresh tokens were JWTs signed with the same secret)
+		if claims.TokenType != TokenTypeAccess {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid token type",
+			})
+		}
+
 		// Store user info in context
 		c.Locals("userID", claims.UserID)
 		c.Locals("userEmail", claims.Email)
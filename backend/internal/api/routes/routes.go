@@ -1,25 +1,59 @@
 package routes
 
 import (
+	"log"
+
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 
 	"github.com/vps-panel/backend/internal/api/handlers"
 	"github.com/vps-panel/backend/internal/api/middleware"
 	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/services/caddy"
+	"github.com/vps-panel/backend/internal/services/certs"
+	"github.com/vps-panel/backend/internal/services/deployment"
 	"github.com/vps-panel/backend/internal/services/websocket"
 )
 
 func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub) error {
+	// Project ownership scopes websocket events to their owner
+	wsHub.SetDatabase(db)
+
+	// Track the certificates of served domains (issuance after deployments, expiry)
+	certMonitor := certs.NewMonitor(db, cfg, wsHub)
+	certMonitor.Start()
+
+	// One Caddy service for everything that writes sites, so changes staged by
+	// one caller and reloaded by another share the same pending set and lock
+	caddyService := caddy.NewCaddyService(cfg)
+
+	// Initialize the shared deployment service so in-flight deployments
+	// are tracked in one place regardless of how they were triggered
+	deploymentService, err := deployment.NewDeploymentService(db, cfg, wsHub, certMonitor, caddyService)
+	if err != nil {
+		log.Printf("Warning: Failed to initialize deployment service: %v", err)
+		log.Println("Deployments will be queued but not executed")
+	} else {
+		deploymentService.Start()
+	}
+
+	// Keep Caddy sites in line with projects (removes configs of deleted projects)
+	caddyReconciler := caddy.NewReconciler(db, cfg, caddyService)
+	caddyReconciler.Start()
+
+	// Turn maintenance mode on and off when scheduled windows start and end
+	caddy.NewMaintenanceScheduler(db, caddyService).Start()
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, cfg)
-	projectHandler := handlers.NewProjectHandler(db, cfg)
-	deploymentHandler := handlers.NewDeploymentHandler(db, cfg, wsHub)
-	webhookHandler, err := handlers.NewWebhookHandler(db, cfg, wsHub)
+	projectHandler := handlers.NewProjectHandler(db, cfg, deploymentService, certMonitor, caddyService, wsHub)
+	deploymentHandler := handlers.NewDeploymentHandler(db, cfg, deploymentService)
+	webhookHandler, err := handlers.NewWebhookHandler(db, cfg, deploymentService)
 	if err != nil {
 		return err
 	}
 	gitProviderHandler := handlers.NewGitProviderHandler(db, cfg)
+	adminHandler := handlers.NewAdminHandler(caddyReconciler)
 
 	// API v1 routes
 	api := app.Group("/api/v1")
@@ -30,6 +64,7 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub
 	auth.Post("/register", authHandler.Register)
 	auth.Post("/login", authHandler.Login)
 	auth.Post("/refresh", authHandler.RefreshToken)
+	auth.Post("/logout", authHandler.Logout)
 
 	// OAuth callbacks (public - OAuth providers redirect here)
 	api.Get("/auth/oauth/callback/github", authHandler.GitHubOAuthCallback)
@@ -53,11 +88,18 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub
 	oauth.Get("/github/init", authHandler.GitHubOAuthInit)
 	oauth.Get("/gitea/init", authHandler.GiteaOAuthInit)
 
+	// Revoke every session of the current user
+	protected.Post("/auth/logout-all", authHandler.LogoutAll)
+
 	// User routes
 	users := protected.Group("/users")
 	users.Get("/me", authHandler.GetCurrentUser)
 	users.Put("/me", authHandler.UpdateProfile)
 
+	// Admin routes
+	admin := protected.Group("/admin", middleware.RequireAdmin)
+	admin.Get("/caddy/reconcile", adminHandler.ReconcileReport) // Dry run of the Caddy reconciler
+
 	// Git Providers routes
 	providers := protected.Group("/git-providers")
 	providers.Get("/", gitProviderHandler.GetAll)
@@ -85,6 +127,8 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub
 	deployments.Get("/:deploymentId", deploymentHandler.GetByID)
 	deployments.Post("/", deploymentHandler.Create)
 	deployments.Post("/:deploymentId/cancel", deploymentHandler.Cancel)
+	deployments.Post("/:deploymentId/rollback", deploymentHandler.Rollback)
+	deployments.Post("/:deploymentId/promote", deploymentHandler.Promote) // Deploy its image to another environment
 	deployments.Get("/:deploymentId/logs", deploymentHandler.GetLogs)
 
 	// Environment variables
@@ -100,6 +144,44 @@ func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub
 	domains.Post("/", projectHandler.AddDomain)
 	domains.Put("/:domainId", projectHandler.UpdateDomain)
 	domains.Delete("/:domainId", projectHandler.DeleteDomain)
+	domains.Get("/:domainId/verification", projectHandler.GetDomainVerification)
+	domains.Post("/:domainId/verify", projectHandler.VerifyDomain)
+	domains.Post("/:domainId/certificate/check", projectHandler.CheckDomainCertificate)
+
+	// Access control (basic auth and IP lists)
+	access := projects.Group("/:id/access")
+	access.Get("/", projectHandler.GetAccessPolicies)
+	access.Post("/", projectHandler.AddAccessPolicy)
+	access.Put("/:policyId", projectHandler.UpdateAccessPolicy)
+	access.Delete("/:policyId", projectHandler.DeleteAccessPolicy)
+
+	// Uploaded TLS certificates
+	certificates := projects.Group("/:id/certificates")
+	certificates.Get("/", projectHandler.GetCertificates)
+	certificates.Post("/", projectHandler.UploadCertificate)
+	certificates.Put("/:certificateId", projectHandler.ReplaceCertificate)
+	certificates.Delete("/:certificateId", projectHandler.DeleteCertificate)
+
+	// Maintenance mode
+	maintenance := projects.Group("/:id/maintenance")
+	maintenance.Get("/", projectHandler.GetMaintenance)
+	maintenance.Put("/", projectHandler.UpdateMaintenance)
+	maintenance.Post("/enable", projectHandler.EnableMaintenance)
+	maintenance.Post("/disable", projectHandler.DisableMaintenance)
+	maintenance.Post("/windows", projectHandler.AddMaintenanceWindow)
+	maintenance.Delete("/windows/:windowId", projectHandler.DeleteMaintenanceWindow)
+
+	// Environments besides production (the project itself), e.g. staging
+	projectEnvironments := projects.Group("/:id/project-environments")
+	projectEnvironments.Get("/", projectHandler.GetProjectEnvironments)
+	projectEnvironments.Post("/", projectHandler.AddProjectEnvironment)
+	projectEnvironments.Put("/:environmentId", projectHandler.UpdateProjectEnvironment)
+	projectEnvironments.Delete("/:environmentId", projectHandler.DeleteProjectEnvironment)
+
+	// Pull request previews (deployed from webhooks)
+	previews := projects.Group("/:id/previews")
+	previews.Get("/", projectHandler.GetPreviews)
+	previews.Delete("/:previewId", projectHandler.ClosePreview)
 
 	// Webhook management (protected - require authentication)
 	webhook := projects.Group("/:id/webhook")
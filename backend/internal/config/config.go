@@ -31,16 +31,34 @@ type Config struct {
 	RedisDB       int
 
 	// Caddy
-	CaddyConfigPath string
-	CaddyReloadCmd  string
+	CaddyConfigPath  string
+	CaddyReloadCmd   string
+	CaddyValidateCmd string // Validates a staged site file (path appended); empty skips validation
+	CaddyAdminURL    string // Admin API endpoint; empty keeps file mode
+	CaddyAdminServer string // HTTP server in the Caddy config that project routes are added to
+	CaddyCertsPath   string // Uploaded certificates are written here for Caddy to load
+
+	CaddyReconcileInterval int // seconds between syncing sites with the database, 0 only syncs at startup
+
+	// Certificate monitor
+	CertCheckInterval     int // seconds between checks of all served certificates, 0 disables them
+	CertExpiryWarningDays int // certificates expiring within this many days are reported
 
 	// Deployment
 	ProjectsDir         string
 	BuildTimeout        int
 	MaxConcurrentBuilds int
+	ImageRetention      int // Number of release images kept per project for rollbacks
 
 	// Security
-	JWTSecret string
+	JWTSecret       string
+	AccessTokenTTL  int // seconds
+	RefreshTokenTTL int // seconds
+
+	// Encryption of secrets at rest (base64 encoded 32-byte master keys)
+	EncryptionKey          string
+	EncryptionKeyFile      string // Used when EncryptionKey is empty; generated on first start
+	EncryptionPreviousKeys string // Comma-separated keys still accepted for decryption during rotation
 
 	// Admin
 	AdminEmail    string
@@ -55,6 +73,7 @@ type Config struct {
 	// Panel Domain (for auto-generating subdomains)
 	PanelDomain string
 	PanelURL    string // Full URL to panel (for webhook URLs)
+	ServerIPs   string // Comma-separated public IPs custom domains must point at; empty uses PANEL_DOMAIN's
 }
 
 func Load() *Config {
@@ -83,16 +102,33 @@ func Load() *Config {
 		RedisDB:       getEnvAsInt("REDIS_DB", 0),
 
 		// Caddy
-		CaddyConfigPath: getEnv("CADDY_CONFIG_PATH", "/etc/caddy/sites"),
-		CaddyReloadCmd:  getEnv("CADDY_RELOAD_CMD", "sudo systemctl reload caddy"),
+		CaddyConfigPath:  getEnv("CADDY_CONFIG_PATH", "/etc/caddy/sites"),
+		CaddyReloadCmd:   getEnv("CADDY_RELOAD_CMD", "sudo systemctl reload caddy"),
+		CaddyValidateCmd: getEnv("CADDY_VALIDATE_CMD", "caddy validate --adapter caddyfile --config"),
+		CaddyAdminURL:    getEnv("CADDY_ADMIN_URL", ""),
+		CaddyAdminServer: getEnv("CADDY_ADMIN_SERVER", "srv0"),
+		CaddyCertsPath:   getEnv("CADDY_CERTS_PATH", "/etc/caddy/certs"),
+
+		CaddyReconcileInterval: getEnvAsInt("CADDY_RECONCILE_INTERVAL", 300),
+
+		// Certificate monitor
+		CertCheckInterval:     getEnvAsInt("CERT_CHECK_INTERVAL", 21600),
+		CertExpiryWarningDays: getEnvAsInt("CERT_EXPIRY_WARNING_DAYS", 14),
 
 		// Deployment
 		ProjectsDir:         getEnv("PROJECTS_DIR", "./data/projects"),
 		BuildTimeout:        getEnvAsInt("BUILD_TIMEOUT", 600),
 		MaxConcurrentBuilds: getEnvAsInt("MAX_CONCURRENT_BUILDS", 3),
+		ImageRetention:      getEnvAsInt("IMAGE_RETENTION", 5),
 
 		// Security
-		JWTSecret: getEnv("JWT_SECRET", "change-this-secret-key"),
+		JWTSecret:       getEnv("JWT_SECRET", "change-this-secret-key"),
+		AccessTokenTTL:  getEnvAsInt("ACCESS_TOKEN_TTL", 86400),
+		RefreshTokenTTL: getEnvAsInt("REFRESH_TOKEN_TTL", 604800),
+
+		EncryptionKey:          getEnv("ENCRYPTION_KEY", ""),
+		EncryptionKeyFile:      getEnv("ENCRYPTION_KEY_FILE", "./data/encryption.key"),
+		EncryptionPreviousKeys: getEnv("ENCRYPTION_PREVIOUS_KEYS", ""),
 
 		// Admin
 		AdminEmail:    getEnv("ADMIN_EMAIL", "admin@example.com"),
@@ -107,6 +143,7 @@ func Load() *Config {
 		// Panel Domain
 		PanelDomain: getEnv("PANEL_DOMAIN", ""),
 		PanelURL:    getEnv("PANEL_URL", ""),
+		ServerIPs:   getEnv("SERVER_IPS", ""),
 	}
 }
 
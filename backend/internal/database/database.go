@@ -13,12 +13,18 @@ import (
 
 	"github.com/vps-panel/backend/internal/config"
 	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/secrets"
 )
 
 func Initialize(cfg *config.Config) (*gorm.DB, error) {
 	var db *gorm.DB
 	var err error
 
+	// Encryption keys must be loaded before any model with encrypted columns is used
+	if err := secrets.Init(cfg); err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+
 	// Configure GORM logger
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
@@ -63,18 +69,49 @@ func Initialize(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Encrypt secrets stored in plaintext by earlier versions
+	if _, err := EncryptSecrets(db, false); err != nil {
+		return nil, fmt.Errorf("failed to encrypt existing secrets: %w", err)
+	}
+
 	log.Println("✅ Database initialized successfully")
 	return db, nil
 }
 
+// tables lists the models migrated by runMigrations
+var tables = []interface{}{
+	&models.User{},
+	&models.GitProvider{},
+	&models.Project{},
+	&models.Deployment{},
+	&models.Environment{},
+	&models.Domain{},
+	&models.AccessPolicy{},
+	&models.AccessUser{},
+	&models.Certificate{},
+	&models.MaintenanceWindow{},
+	&models.Preview{},
+	&models.ProjectEnvironment{},
+	&models.BuildLog{},
+	&models.RefreshToken{},
+}
+
 func runMigrations(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.User{},
-		&models.GitProvider{},
-		&models.Project{},
-		&models.Deployment{},
-		&models.Environment{},
-		&models.Domain{},
-		&models.BuildLog{},
-	)
+	if err := db.AutoMigrate(tables...); err != nil {
+		return err
+	}
+
+	// Domain names are unique among verified domains only, so an unverified
+	// claim can't block the domain's owner. This replaces the unique index on
+	// all domains, which AutoMigrate leaves in place
+	for _, statement := range []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_domains_verified_domain ON domains (domain)
+			WHERE verification_status = 'verified' AND deleted_at IS NULL`,
+		`DROP INDEX IF EXISTS idx_domains_domain`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
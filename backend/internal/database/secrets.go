@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/secrets"
+)
+
+// secretColumns lists the columns encrypted at rest (see the serializer tags on the models)
+var secretColumns = []struct {
+	table   string
+	columns []string
+	where   string // limits which rows are encrypted
+}{
+	{table: "git_providers", columns: []string{"client_secret", "token"}},
+	{table: "projects", columns: []string{"git_token", "webhook_secret"}},
+	{table: "users", columns: []string{"git_hub_token", "git_lab_token", "gitea_token"}},
+	{table: "environments", columns: []string{"value"}, where: "is_secret = true"},
+	{table: "certificates", columns: []string{"certificate_pem", "private_key_pem"}},
+}
+
+// EncryptSecrets encrypts plaintext values left from before encryption was enabled
+// With rotate set, values encrypted with a previous master key are re-encrypted
+// with the current one as well. It returns the number of values written
+func EncryptSecrets(db *gorm.DB, rotate bool) (int, error) {
+	total := 0
+
+	for _, t := range secretColumns {
+		for _, column := range t.columns {
+			count, err := encryptColumn(db, t.table, column, t.where, rotate)
+			if err != nil {
+				return total, fmt.Errorf("%s.%s: %w", t.table, column, err)
+			}
+			total += count
+		}
+	}
+
+	return total, nil
+}
+
+// encryptColumn works on the raw column values, bypassing the model serializers
+func encryptColumn(db *gorm.DB, table, column, where string, rotate bool) (int, error) {
+	query := db.Table(table).Select("id", column).Where(column + " <> ''")
+	if where != "" {
+		query = query.Where(where)
+	}
+
+	type row struct {
+		id    uint
+		value string
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []row
+	for rows.Next() {
+		var id uint
+		var value sql.NullString
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		if !value.Valid || secrets.IsCurrent(value.String) {
+			continue
+		}
+		if secrets.IsEncrypted(value.String) && !rotate {
+			continue
+		}
+		pending = append(pending, row{id: id, value: value.String})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range pending {
+		plaintext, err := secrets.Decrypt(r.value)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", r.id, err)
+		}
+
+		encrypted, err := secrets.Encrypt(plaintext)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", r.id, err)
+		}
+
+		if err := db.Table(table).Where("id = ?", r.id).UpdateColumn(column, encrypted).Error; err != nil {
+			return 0, fmt.Errorf("row %d: %w", r.id, err)
+		}
+	}
+
+	if len(pending) > 0 {
+		log.Printf("Encrypted %d value(s) in %s.%s", len(pending), table, column)
+	}
+
+	return len(pending), nil
+}
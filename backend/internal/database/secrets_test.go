@@ -0,0 +1,190 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/secrets"
+	"github.com/vps-panel/backend/internal/testutil"
+)
+
+func initKeys(t *testing.T, current string, previous ...string) {
+	t.Helper()
+
+	cfg := &config.Config{EncryptionKey: current, EncryptionPreviousKeys: strings.Join(previous, ",")}
+	if err := secrets.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// rawValue reads a column without the model serializers
+func rawValue(t *testing.T, db *gorm.DB, table, column string, id uint) string {
+	t.Helper()
+
+	var value string
+	if err := db.Table(table).Select(column).Where("id = ?", id).Row().Scan(&value); err != nil {
+		t.Fatalf("%s.%s of row %d: %v", table, column, id, err)
+	}
+	return value
+}
+
+// Every encrypted field must be listed, or key rotation leaves it behind
+func TestSecretColumnsMatchEncryptedFields(t *testing.T) {
+	db := testutil.OpenDB(t)
+
+	var tagged []string
+	for _, table := range tables {
+		s, err := schema.Parse(table, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range s.Fields {
+			switch field.TagSettings["SERIALIZER"] {
+			case "encrypted":
+				tagged = append(tagged, s.Table+"."+field.DBName)
+			case "encrypted_if_secret":
+				tagged = append(tagged, s.Table+"."+field.DBName+" (if secret)")
+			}
+		}
+	}
+
+	var listed []string
+	for _, table := range secretColumns {
+		for _, column := range table.columns {
+			if table.where != "" {
+				column += " (if secret)"
+			}
+			listed = append(listed, table.table+"."+column)
+		}
+	}
+
+	sort.Strings(tagged)
+	sort.Strings(listed)
+	if strings.Join(tagged, "\n") != strings.Join(listed, "\n") {
+		t.Errorf("secretColumns = %v, want the encrypted fields of the models %v", listed, tagged)
+	}
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	db := testutil.OpenDB(t)
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey := newKey(t)
+	initKeys(t, oldKey)
+
+	// A row holding a value in every secret column
+	user := &models.User{Email: "dev@example.com", PasswordHash: "hash", GitHubToken: "gh-token", GitLabToken: "gl-token", GiteaToken: "gitea-token"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	provider := &models.GitProvider{UserID: user.ID, Type: models.ProviderGitea, Name: "Gitea", ClientID: "id", ClientSecret: "client-secret", Token: "oauth-token"}
+	if err := db.Create(provider).Error; err != nil {
+		t.Fatal(err)
+	}
+	project := &models.Project{Name: "app", UserID: user.ID, GitURL: "https://example.com/app.git", GitToken: "git-token", WebhookSecret: "webhook-secret"}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatal(err)
+	}
+	secret := &models.Environment{ProjectID: project.ID, Key: "API_KEY", Value: "api-key", IsSecret: true}
+	plain := &models.Environment{ProjectID: project.ID, Key: "PORT", Value: "3000"}
+	if err := db.Create([]*models.Environment{secret, plain}).Error; err != nil {
+		t.Fatal(err)
+	}
+	certificate := &models.Certificate{ProjectID: project.ID, CertificatePEM: "certificate", PrivateKeyPEM: "private-key"}
+	if err := db.Create(certificate).Error; err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]uint{
+		"users":         user.ID,
+		"git_providers": provider.ID,
+		"projects":      project.ID,
+		"environments":  secret.ID,
+		"certificates":  certificate.ID,
+	}
+
+	total := 0
+	for _, table := range secretColumns {
+		for _, column := range table.columns {
+			if value := rawValue(t, db, table.table, column, rows[table.table]); !secrets.IsCurrent(value) {
+				t.Fatalf("%s.%s = %q, want it encrypted when written", table.table, column, value)
+			}
+			total++
+		}
+	}
+	if value := rawValue(t, db, "environments", "value", plain.ID); value != "3000" {
+		t.Errorf("non-secret variable stored as %q", value)
+	}
+
+	// A value from before encryption was enabled
+	if err := db.Table("users").Where("id = ?", user.ID).UpdateColumn("gitea_token", "gitea-token").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	currentKey := newKey(t)
+	initKeys(t, currentKey, oldKey)
+
+	// Without rotate only plaintext values are encrypted
+	if count, err := EncryptSecrets(db, false); err != nil || count != 1 {
+		t.Fatalf("EncryptSecrets(false) = %d, %v, want the plaintext value encrypted", count, err)
+	}
+	if count, err := EncryptSecrets(db, true); err != nil || count != total-1 {
+		t.Fatalf("EncryptSecrets(true) = %d, %v, want the other %d values re-encrypted", count, err, total-1)
+	}
+	if count, err := EncryptSecrets(db, true); err != nil || count != 0 {
+		t.Errorf("EncryptSecrets(true) again = %d, %v, want nothing left to do", count, err)
+	}
+
+	for _, table := range secretColumns {
+		for _, column := range table.columns {
+			if value := rawValue(t, db, table.table, column, rows[table.table]); !secrets.IsCurrent(value) {
+				t.Errorf("%s.%s not encrypted with the new key", table.table, column)
+			}
+		}
+	}
+	if value := rawValue(t, db, "environments", "value", plain.ID); value != "3000" {
+		t.Errorf("non-secret variable stored as %q after rotation", value)
+	}
+
+	// Everything still reads back once the old key is gone
+	initKeys(t, currentKey)
+	var loaded models.Certificate
+	if err := db.First(&loaded, certificate.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded.CertificatePEM != "certificate" || loaded.PrivateKeyPEM != "private-key" {
+		t.Errorf("certificate read back as %q, %q", loaded.CertificatePEM, loaded.PrivateKeyPEM)
+	}
+	var loadedUser models.User
+	if err := db.First(&loadedUser, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loadedUser.GiteaToken != "gitea-token" || loadedUser.GitHubToken != "gh-token" {
+		t.Errorf("user tokens read back as %q, %q", loadedUser.GiteaToken, loadedUser.GitHubToken)
+	}
+	var variables []models.Environment
+	if err := db.Order("id").Find(&variables).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(variables) != 2 || variables[0].Value != "api-key" || variables[1].Value != "3000" {
+		t.Errorf("variables read back as %+v", variables)
+	}
+}
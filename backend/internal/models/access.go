@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccessPolicy restricts who can reach a project's site
+// A policy without a domain covers every domain of the project that has no
+// policy of its own. Requests must pass the IP lists first, then basic auth
+// if the policy has users.
+type AccessPolicy struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProjectID uint  `gorm:"not null;index" json:"project_id"`
+	DomainID  *uint `gorm:"index" json:"domain_id"` // nil applies to the whole project
+
+	AllowCIDRs []string `gorm:"type:text;serializer:json" json:"allow_cidrs"` // If set, only these addresses get through
+	DenyCIDRs  []string `gorm:"type:text;serializer:json" json:"deny_cidrs"`  // Always refused, checked before the allow list
+
+	// Relationships
+	Project Project      `gorm:"foreignKey:ProjectID" json:"-"`
+	Users   []AccessUser `gorm:"foreignKey:PolicyID;constraint:OnDelete:CASCADE" json:"users"`
+}
+
+func (AccessPolicy) TableName() string {
+	return "access_policies"
+}
+
+// AccessUser is a basic auth login of an access policy
+// Only the bcrypt hash of the password is stored, in the form Caddy expects
+type AccessUser struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PolicyID     uint   `gorm:"not null;index" json:"policy_id"`
+	Username     string `gorm:"not null" json:"username"`
+	PasswordHash string `gorm:"not null" json:"-"`
+}
+
+func (AccessUser) TableName() string {
+	return "access_users"
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Certificate is an uploaded TLS certificate served instead of one obtained
+// automatically through ACME
+// A certificate without a domain is shared by the project: it's used for every
+// domain of the project it covers (e.g. a wildcard certificate for the
+// project's subdomains) that has no certificate of its own.
+type Certificate struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProjectID uint  `gorm:"not null;index" json:"project_id"`
+	DomainID  *uint `gorm:"index" json:"domain_id"` // nil shares it with the whole project
+
+	CertificatePEM string `gorm:"type:text;not null;serializer:encrypted" json:"-"` // Leaf first, then intermediates
+	PrivateKeyPEM  string `gorm:"type:text;not null;serializer:encrypted" json:"-"` // Never send to frontend (encrypted at rest)
+
+	// Parsed from the leaf certificate on upload
+	Names       []string  `gorm:"type:text;serializer:json" json:"names"` // DNS names, e.g. *.example.com
+	Issuer      string    `json:"issuer"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256 of the leaf, hex
+
+	// Relationships
+	Project Project `gorm:"foreignKey:ProjectID" json:"-"`
+}
+
+func (Certificate) TableName() string {
+	return "certificates"
+}
+
+// Covers reports whether the certificate is valid for host
+// A wildcard name covers exactly one label, like browsers check it
+func (c *Certificate) Covers(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, name := range c.Names {
+		name = strings.ToLower(name)
+		if name == host {
+			return true
+		}
+		if base, ok := strings.CutPrefix(name, "*."); ok {
+			if i := strings.Index(host, "."); i > 0 && host[i+1:] == base {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Leaf parses the leaf certificate
+func (c *Certificate) Leaf() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(c.CertificatePEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate in PEM data")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// CertificateFor picks the uploaded certificate served for a domain on host:
+// its own, or else the first shared one, as long as it covers host. Returns
+// nil to use ACME
+func CertificateFor(certificates []Certificate, domainID uint, host string) *Certificate {
+	for i := range certificates {
+		if certificates[i].DomainID != nil && *certificates[i].DomainID == domainID {
+			if certificates[i].Covers(host) {
+				return &certificates[i]
+			}
+			break
+		}
+	}
+	for i := range certificates {
+		if certificates[i].DomainID == nil && certificates[i].Covers(host) {
+			return &certificates[i]
+		}
+	}
+	return nil
+}
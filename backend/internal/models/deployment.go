@@ -15,6 +15,7 @@ const (
 	DeploymentSuccess   DeploymentStatus = "success"
 	DeploymentFailed    DeploymentStatus = "failed"
 	DeploymentCancelled DeploymentStatus = "cancelled"
+	DeploymentSkipped   DeploymentStatus = "skipped" // Push didn't change a file matching the path filters
 )
 
 type Deployment struct {
@@ -30,6 +31,7 @@ type Deployment struct {
 	CommitMessage string `json:"commit_message"`
 	CommitAuthor  string `json:"commit_author"`
 	Branch        string `json:"branch"`
+	Tag           string `json:"tag,omitempty"` // Tag deployed instead of the head of the branch, if any
 
 	// Status
 	Status        DeploymentStatus `gorm:"type:varchar(20);default:pending" json:"status"`
@@ -37,10 +39,21 @@ type Deployment struct {
 	CompletedAt   *time.Time       `json:"completed_at,omitempty"`
 	Duration      int              `json:"duration"` // seconds
 	ErrorMessage  string           `gorm:"type:text" json:"error_message,omitempty"`
+	SkipReason    string           `gorm:"type:text" json:"skip_reason,omitempty"`
+	CheckPaths    bool             `gorm:"default:false" json:"-"` // Diff against the last deployment with the path filters before building
+
+	// Release image (immutable repo:tag reference, used for rollbacks)
+	ImageTag string `json:"image_tag,omitempty"`
 
 	// Trigger
-	TriggeredBy   string `json:"triggered_by"`   // webhook, manual, api
-	TriggeredByID uint   `json:"triggered_by_id"` // user ID if manual
+	TriggeredBy          string `json:"triggered_by"`                                  // webhook, manual, api, rollback, promote
+	TriggeredByID        uint   `json:"triggered_by_id"`                               // user ID if manual
+	SourceDeploymentID   *uint  `gorm:"index" json:"source_deployment_id,omitempty"`   // deployment whose image was reused (rollback, promote)
+	PreviewID            *uint  `gorm:"index" json:"preview_id,omitempty"`             // preview this deployment builds, if any
+	ProjectEnvironmentID *uint  `gorm:"index" json:"project_environment_id,omitempty"` // environment deployed to; none for production
+
+	// Build queue position while pending (1-based, not persisted)
+	QueuePosition int `gorm:"-" json:"queue_position,omitempty"`
 
 	// Relationships
 	Project  Project    `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
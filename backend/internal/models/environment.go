@@ -12,10 +12,11 @@ type Environment struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	ProjectID uint   `gorm:"not null;index" json:"project_id"`
-	Key       string `gorm:"not null" json:"key"`
-	Value     string `gorm:"type:text;not null" json:"value"`
-	IsSecret  bool   `gorm:"default:false" json:"is_secret"`
+	ProjectID            uint   `gorm:"not null;index" json:"project_id"`
+	ProjectEnvironmentID *uint  `gorm:"index" json:"project_environment_id,omitempty"` // Variable of one environment; production's have none
+	Key                  string `gorm:"not null" json:"key"`
+	Value                string `gorm:"type:text;not null;serializer:encrypted_if_secret" json:"value"` // Encrypted at rest when IsSecret
+	IsSecret             bool   `gorm:"default:false" json:"is_secret"`
 
 	// Relationships
 	Project Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
@@ -31,10 +32,32 @@ type Domain struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	ProjectID uint   `gorm:"not null;index" json:"project_id"`
-	Domain    string `gorm:"uniqueIndex;not null" json:"domain"`
-	IsActive  bool   `gorm:"default:true" json:"is_active"`
-	SSLEnabled bool  `gorm:"default:true" json:"ssl_enabled"`
+	ProjectID            uint   `gorm:"not null;index" json:"project_id"`
+	PreviewID            *uint  `gorm:"index" json:"preview_id,omitempty"`             // Set for the subdomain of a preview, see SiteDomains
+	ProjectEnvironmentID *uint  `gorm:"index" json:"project_environment_id,omitempty"` // Set for the domains of an environment other than production
+	Domain               string `gorm:"not null" json:"domain"`                        // Unique among verified domains only, see database.runMigrations
+	IsActive             bool   `gorm:"default:true" json:"is_active"`
+	SSLEnabled           bool   `gorm:"default:true" json:"ssl_enabled"` // false serves the domain over plain HTTP only
+
+	// Routing
+	IsPrimary         bool          `gorm:"default:false" json:"is_primary"`          // Target of redirect-to-primary; defaults to the first active domain
+	RedirectToPrimary bool          `gorm:"default:false" json:"redirect_to_primary"` // Redirect every request to the primary domain
+	RedirectCode      int           `gorm:"default:0" json:"redirect_code"`           // 301 or 308 (0 = 301)
+	Canonical         CanonicalHost `gorm:"default:''" json:"canonical"`              // Also serve the www/apex counterpart and redirect it
+	Rules             []DomainRule  `gorm:"type:text;serializer:json" json:"rules"`   // Path redirects and rewrites, applied in order
+
+	// Ownership verification; only verified domains are served
+	VerificationStatus DomainVerificationStatus `gorm:"type:varchar(20);default:verified" json:"verification_status"`
+	VerificationToken  string                   `json:"verification_token,omitempty"` // Expected in the _vps-panel-verify TXT record
+	VerificationError  string                   `json:"verification_error,omitempty"` // Why the last check failed
+	VerifiedAt         *time.Time               `json:"verified_at,omitempty"`
+
+	// TLS certificate served for the domain, recorded by the certificate monitor
+	CertStatus    CertificateStatus `gorm:"type:varchar(20);default:''" json:"cert_status"`
+	CertIssuer    string            `json:"cert_issuer,omitempty"`
+	CertExpiresAt *time.Time        `json:"cert_expires_at,omitempty"`
+	CertError     string            `json:"cert_error,omitempty"` // Why the last check failed
+	CertCheckedAt *time.Time        `json:"cert_checked_at,omitempty"`
 
 	// Relationships
 	Project Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
@@ -44,6 +67,55 @@ func (Domain) TableName() string {
 	return "domains"
 }
 
+// DomainVerificationStatus tracks whether a domain's owner proved control over it
+type DomainVerificationStatus string
+
+const (
+	DomainPending  DomainVerificationStatus = "pending"  // Waiting for the TXT and A/AAAA records
+	DomainFailed   DomainVerificationStatus = "failed"   // Last check failed, see VerificationError
+	DomainVerified DomainVerificationStatus = "verified" // Served by Caddy; domains added before verification existed count as verified
+)
+
+// CertificateStatus is the state of the certificate a domain serves
+type CertificateStatus string
+
+const (
+	CertificateUnknown  CertificateStatus = ""        // Not checked yet
+	CertificatePending  CertificateStatus = "pending" // Waiting for Caddy to obtain it after a deployment
+	CertificateValid    CertificateStatus = "valid"
+	CertificateExpiring CertificateStatus = "expiring" // Valid, but expires within the warning period
+	CertificateError    CertificateStatus = "error"    // Not issued or invalid, see CertError
+)
+
+// Verified reports whether the domain may be served
+func (d *Domain) Verified() bool {
+	return d.VerificationStatus == DomainVerified
+}
+
+// CanonicalHost selects which of example.com and www.example.com is canonical
+type CanonicalHost string
+
+const (
+	CanonicalNone CanonicalHost = ""
+	CanonicalWWW  CanonicalHost = "www"  // example.com redirects to www.example.com
+	CanonicalApex CanonicalHost = "apex" // www.example.com redirects to example.com
+)
+
+type DomainRuleType string
+
+const (
+	DomainRuleRedirect DomainRuleType = "redirect"
+	DomainRuleRewrite  DomainRuleType = "rewrite"
+)
+
+// DomainRule redirects or internally rewrites requests matching a path
+type DomainRule struct {
+	Type DomainRuleType `json:"type"`
+	Path string         `json:"path"`           // Caddy path matcher, e.g. /blog/*
+	To   string         `json:"to"`             // Target path or URL; may use placeholders like {uri}
+	Code int            `json:"code,omitempty"` // Redirects only: 301, 302, 307 or 308 (0 = 302)
+}
+
 type BuildLog struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
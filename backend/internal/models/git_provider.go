@@ -24,15 +24,15 @@ type GitProvider struct {
 	UserID uint `gorm:"not null;index" json:"user_id"`
 
 	// Provider configuration
-	Type         ProviderType `gorm:"type:varchar(50);not null" json:"type"` // github, gitlab, gitea
-	Name         string       `gorm:"not null" json:"name"`                  // e.g., "My Gitea Server", "Company GitHub"
-	URL          string       `json:"url,omitempty"`                         // For self-hosted (Gitea, GitLab)
-	ClientID     string       `gorm:"not null" json:"-"`                     // Never send to frontend in GET requests
-	ClientSecret string       `gorm:"not null" json:"-"`                     // Never send to frontend
+	Type         ProviderType `gorm:"type:varchar(50);not null" json:"type"`  // github, gitlab, gitea
+	Name         string       `gorm:"not null" json:"name"`                   // e.g., "My Gitea Server", "Company GitHub"
+	URL          string       `json:"url,omitempty"`                          // For self-hosted (Gitea, GitLab)
+	ClientID     string       `gorm:"not null" json:"-"`                      // Never send to frontend in GET requests
+	ClientSecret string       `gorm:"not null;serializer:encrypted" json:"-"` // Never send to frontend (encrypted at rest)
 
 	// OAuth state
 	Connected bool   `gorm:"default:false" json:"connected"`
-	Token     string `json:"-"` // OAuth access token
+	Token     string `gorm:"serializer:encrypted" json:"-"` // OAuth access token (encrypted at rest)
 	Username  string `json:"username,omitempty"`
 
 	// Settings
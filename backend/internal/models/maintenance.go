@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaintenanceWindow is a scheduled period of maintenance mode
+type MaintenanceWindow struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProjectID uint      `gorm:"not null;index" json:"project_id"`
+	StartsAt  time.Time `gorm:"not null;index" json:"starts_at"`
+	EndsAt    time.Time `gorm:"not null;index" json:"ends_at"`
+	Message   string    `json:"message,omitempty"` // Replaces the project's maintenance message during the window
+
+	// Relationships
+	Project Project `gorm:"foreignKey:ProjectID" json:"-"`
+}
+
+func (MaintenanceWindow) TableName() string {
+	return "maintenance_windows"
+}
+
+// Active reports whether the window covers t
+func (w *MaintenanceWindow) Active(t time.Time) bool {
+	return !t.Before(w.StartsAt) && t.Before(w.EndsAt)
+}
+
+// InMaintenance reports whether the project is in maintenance mode at t, and
+// the scheduled window active at t, if any. MaintenanceWindows must be loaded
+func (p *Project) InMaintenance(t time.Time) (bool, *MaintenanceWindow) {
+	for i := range p.MaintenanceWindows {
+		if p.MaintenanceWindows[i].Active(t) {
+			return true, &p.MaintenanceWindows[i]
+		}
+	}
+	return p.MaintenanceEnabled, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"path"
+	"strings"
+)
+
+// HasPathFilters reports whether pushes are only deployed when they change
+// certain files
+func (p *Project) HasPathFilters() bool {
+	return len(p.IncludePaths) > 0 || len(p.ExcludePaths) > 0
+}
+
+// DeploysChanges reports whether a push changing files gets deployed: one of
+// them must match an include pattern (any file when there are none) and no
+// exclude pattern. Files are paths from the repository root
+func (p *Project) DeploysChanges(files []string) bool {
+	for _, file := range files {
+		included := len(p.IncludePaths) == 0 || matchesAnyPath(p.IncludePaths, file)
+		if included && !matchesAnyPath(p.ExcludePaths, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidPathPattern reports whether a path filter pattern parses
+func ValidPathPattern(pattern string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil || segment == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAnyPath(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a file against a pattern of globs per path segment, where
+// ** stands for any number of directories. A pattern also matches everything
+// below the directories it matches: frontend and packages/* match all their files
+func matchPath(pattern, file string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(file, "/"))
+}
+
+func matchSegments(pattern, file []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(file); i++ {
+			if matchSegments(pattern[1:], file[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(file) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], file[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], file[1:])
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PreviewStatus string
+
+const (
+	PreviewPending PreviewStatus = "pending" // First deployment hasn't finished yet
+	PreviewActive  PreviewStatus = "active"
+	PreviewFailed  PreviewStatus = "failed"
+	PreviewClosed  PreviewStatus = "closed" // Pull request closed, container, site and domain removed
+)
+
+// Preview is the isolated deployment of an open pull/merge request, served on
+// a subdomain of its own. Closed previews are kept and reopened with their PR
+type Preview struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProjectID uint `gorm:"not null;uniqueIndex:idx_previews_project_number" json:"project_id"`
+	Number    int  `gorm:"not null;uniqueIndex:idx_previews_project_number" json:"number"` // Pull/merge request number
+
+	// Pull request
+	Title      string `json:"title"`
+	URL        string `json:"url"`    // Pull request page
+	Branch     string `json:"branch"` // Head branch the preview is built from
+	CommitHash string `json:"commit_hash"`
+	Author     string `json:"author"`
+
+	// Status
+	Status       PreviewStatus `gorm:"type:varchar(20);default:pending" json:"status"`
+	LastDeployed *time.Time    `json:"last_deployed,omitempty"`
+	ClosedAt     *time.Time    `json:"closed_at,omitempty"`
+
+	// Ports of the preview's container, 0 until its first deployment
+	FrontendPort int `gorm:"default:0" json:"frontend_port"`
+	BackendPort  int `gorm:"default:0" json:"backend_port"`
+
+	// Relationships
+	Project Project  `gorm:"foreignKey:ProjectID" json:"-"`
+	Domains []Domain `gorm:"foreignKey:PreviewID" json:"domains,omitempty"`
+}
+
+func (Preview) TableName() string {
+	return "previews"
+}
+
+// ForPreview returns the project as it's deployed for one of its previews: the
+// pull request's branch, the preview's own ports and a name of its own, which
+// keeps its container, image and checkout apart from the project's. Its Caddy
+// site is named after the project and preview IDs instead, see caddy.siteName
+func (p *Project) ForPreview(preview *Preview) Project {
+	project := *p
+	project.Preview = preview
+	project.Name = fmt.Sprintf("%s-pr-%d", p.Name, preview.Number)
+	project.GitBranch = preview.Branch
+	if preview.FrontendPort > 0 {
+		project.FrontendPort = preview.FrontendPort
+		project.BackendPort = preview.BackendPort
+	}
+
+	// Previews keep no release images to roll back to, and stay up while the
+	// project is in maintenance
+	project.HealthCheckRollback = false
+	project.MaintenanceEnabled = false
+	project.MaintenanceWindows = nil
+	return project
+}
+
+// SiteDomains returns the domains of the project's own site, or only those of
+// its preview or environment for a project returned by ForPreview or ForEnvironment
+func (p *Project) SiteDomains() []Domain {
+	var domains []Domain
+	for _, domain := range p.Domains {
+		switch {
+		case p.Preview != nil:
+			if domain.PreviewID == nil || *domain.PreviewID != p.Preview.ID {
+				continue
+			}
+		case p.ProjectEnvironment != nil:
+			if domain.ProjectEnvironmentID == nil || *domain.ProjectEnvironmentID != p.ProjectEnvironment.ID {
+				continue
+			}
+		case domain.PreviewID != nil || domain.ProjectEnvironmentID != nil:
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains
+}
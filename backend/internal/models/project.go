@@ -8,6 +8,8 @@ import (
 
 type FrameworkType string
 type BaaSType string
+type DeploymentPolicy string
+type HeaderProfile string
 
 const (
 	// Framework types
@@ -23,8 +25,30 @@ const (
 	BaaSSupabase   BaaSType = "supabase"
 	BaaSFirebase   BaaSType = "firebase"
 	BaaSAppwrite   BaaSType = "appwrite"
+
+	// Deployment policies (how concurrent deployments of one project are handled)
+	DeploymentPolicyQueue     DeploymentPolicy = "queue"     // run every deployment in order
+	DeploymentPolicySupersede DeploymentPolicy = "supersede" // cancel older pending deployments, build only the newest
+
+	// Header profiles (security headers added to every response of the site)
+	HeaderProfileDefault HeaderProfile = ""        // HSTS preload, nosniff, referrer policy; frames denied (same origin with PocketBase)
+	HeaderProfileStrict  HeaderProfile = "strict"  // default plus frames denied, cross-origin isolation and a locked down permissions policy
+	HeaderProfileRelaxed HeaderProfile = "relaxed" // HSTS without preload or subdomains, same-origin frames allowed
+	HeaderProfileCustom  HeaderProfile = "custom"  // only the project's custom headers and CSP
 )
 
+// CustomHeader sets a response header; an empty value removes it
+type CustomHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CSPDirective is one directive of the Content-Security-Policy, e.g. img-src 'self' data:
+type CSPDirective struct {
+	Name    string   `json:"name"`
+	Sources []string `json:"sources"` // empty for directives without values, e.g. upgrade-insecure-requests
+}
+
 type Project struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -37,11 +61,13 @@ type Project struct {
 	UserID      uint   `gorm:"not null;index" json:"user_id"`
 
 	// Repository
-	GitURL        string `gorm:"not null" json:"git_url"`
-	GitBranch     string `gorm:"default:main" json:"git_branch"`
-	GitUsername   string `json:"git_username,omitempty"`   // For private repos
-	GitToken      string `json:"-"`                        // Access token (never sent to frontend)
-	RootDirectory string `json:"root_directory,omitempty"` // Subdirectory for monorepos (e.g., "frontend")
+	GitURL        string   `gorm:"not null" json:"git_url"`
+	GitBranch     string   `gorm:"default:main" json:"git_branch"`
+	GitUsername   string   `json:"git_username,omitempty"`                         // For private repos
+	GitToken      string   `gorm:"serializer:encrypted" json:"-"`                  // Access token (never sent to frontend, encrypted at rest)
+	RootDirectory string   `json:"root_directory,omitempty"`                       // Subdirectory for monorepos (e.g., "frontend")
+	IncludePaths  []string `gorm:"type:text;serializer:json" json:"include_paths"` // Pushes deploy only if they change a matching file, see path_filter.go
+	ExcludePaths  []string `gorm:"type:text;serializer:json" json:"exclude_paths"` // Files whose changes never deploy
 
 	// Framework & Backend
 	Framework        FrameworkType `gorm:"type:varchar(50)" json:"framework"`
@@ -61,8 +87,33 @@ type Project struct {
 	// Deployment settings
 	AutoDeploy     bool   `gorm:"default:false" json:"auto_deploy"` // Webhook auto-deploy
 	DeploymentPath string `json:"deployment_path"`                  // /home/user/apps/project-name
-	WebhookSecret  string `json:"webhook_secret,omitempty"`         // Secret for webhook verification
+	WebhookSecret  string `gorm:"serializer:encrypted" json:"webhook_secret,omitempty"` // Secret for webhook verification (encrypted at rest)
 	AutoDeployBranch string `json:"auto_deploy_branch,omitempty"`   // Branch to auto-deploy (defaults to GitBranch)
+	DeploymentPolicy DeploymentPolicy `gorm:"type:varchar(20);default:queue" json:"deployment_policy"` // queue, supersede
+	PreviewDeployments bool `gorm:"default:false" json:"preview_deployments"` // Deploy pull/merge requests to previews of their own
+	TriggerRules []TriggerRule `gorm:"type:text;serializer:json" json:"trigger_rules"` // Tags and releases deployed besides the branch, see trigger.go
+
+	// Health check run after a container starts, before the deployment is marked successful
+	// Zero values fall back to the defaults in the deployment service
+	HealthCheckPath           string `json:"health_check_path,omitempty"`                // Path to probe (default "/")
+	HealthCheckExpectedStatus int    `json:"health_check_expected_status"`               // Expected HTTP status, 0 accepts anything below 500
+	HealthCheckTimeout        int    `json:"health_check_timeout"`                       // Seconds per probe
+	HealthCheckRetries        int    `json:"health_check_retries"`                       // Probes before the check fails
+	HealthCheckStartPeriod    int    `json:"health_check_start_period"`                  // Seconds to wait before the first probe
+	HealthCheckRollback       bool   `gorm:"default:false" json:"health_check_rollback"` // Restore the previous image when the check fails
+
+	// Response headers added by Caddy; custom headers override the profile's
+	HeaderProfile HeaderProfile  `gorm:"type:varchar(20);default:''" json:"header_profile"`
+	CustomHeaders []CustomHeader `gorm:"type:text;serializer:json" json:"custom_headers"`
+	CSPDirectives []CSPDirective `gorm:"type:text;serializer:json" json:"csp_directives"` // Built into a Content-Security-Policy header
+	CSPReportOnly bool           `gorm:"default:false" json:"csp_report_only"`           // Send it as Content-Security-Policy-Report-Only
+
+	// Maintenance mode: Caddy answers with a 503 page instead of the app, see maintenance.go
+	MaintenanceEnabled    bool     `gorm:"default:false" json:"maintenance_enabled"`               // On until turned off; scheduled windows turn it on by themselves
+	MaintenanceMessage    string   `json:"maintenance_message,omitempty"`                          // Shown on the built-in page
+	MaintenancePage       string   `gorm:"type:text" json:"maintenance_page,omitempty"`            // Custom HTML replacing the built-in page
+	MaintenanceRetryAfter int      `gorm:"default:0" json:"maintenance_retry_after"`               // Seconds for Retry-After (0 = 3600); windows send their end instead
+	MaintenanceAllowCIDRs []string `gorm:"type:text;serializer:json" json:"maintenance_allow_cidrs"` // Addresses that still reach the app
 
 	// Status
 	Status       string `gorm:"default:pending" json:"status"` // pending, deploying, active, failed
@@ -73,6 +124,14 @@ type Project struct {
 	Deployments []Deployment  `gorm:"foreignKey:ProjectID" json:"deployments,omitempty"`
 	Environments []Environment `gorm:"foreignKey:ProjectID" json:"environments,omitempty"`
 	Domains     []Domain      `gorm:"foreignKey:ProjectID" json:"domains,omitempty"`
+	AccessPolicies []AccessPolicy `gorm:"foreignKey:ProjectID" json:"access_policies,omitempty"`
+	Certificates []Certificate `gorm:"foreignKey:ProjectID" json:"certificates,omitempty"`
+	MaintenanceWindows []MaintenanceWindow `gorm:"foreignKey:ProjectID" json:"maintenance_windows,omitempty"`
+	ProjectEnvironments []ProjectEnvironment `gorm:"foreignKey:ProjectID" json:"project_environments,omitempty"` // Environments besides production
+
+	// Set on the copies returned by ForPreview and ForEnvironment (not persisted)
+	Preview            *Preview            `gorm:"-" json:"-"`
+	ProjectEnvironment *ProjectEnvironment `gorm:"-" json:"-"`
 }
 
 func (Project) TableName() string {
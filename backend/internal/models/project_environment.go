@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductionEnvironment names the project itself, which is deployed from its
+// own branch, domains, variables and ports next to its other environments
+const ProductionEnvironment = "production"
+
+// ProjectEnvironment is a further deployment of a project, e.g. staging, with
+// a branch, domains, environment variables, ports and deployment history of
+// its own. Not to be confused with Environment, an environment variable
+type ProjectEnvironment struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProjectID  uint   `gorm:"not null;index" json:"project_id"`
+	Name       string `gorm:"not null" json:"name"`            // e.g. staging; part of its container name and subdomain
+	GitBranch  string `gorm:"not null" json:"git_branch"`      // Branch deployed to the environment
+	AutoDeploy bool   `gorm:"default:true" json:"auto_deploy"` // Deploy pushes to the branch (needs the project's webhook)
+
+	// Ports of the environment's container, 0 until its first deployment
+	FrontendPort int `gorm:"default:0" json:"frontend_port"`
+	BackendPort  int `gorm:"default:0" json:"backend_port"`
+
+	// Status
+	Status       string     `gorm:"default:pending" json:"status"` // pending, active, failed
+	LastDeployed *time.Time `json:"last_deployed,omitempty"`
+
+	// Relationships
+	Project   Project       `gorm:"foreignKey:ProjectID" json:"-"`
+	Domains   []Domain      `gorm:"foreignKey:ProjectEnvironmentID" json:"domains,omitempty"`
+	Variables []Environment `gorm:"foreignKey:ProjectEnvironmentID" json:"-"`
+}
+
+func (ProjectEnvironment) TableName() string {
+	return "project_environments"
+}
+
+// ForEnvironment returns the project as it's deployed to one of its
+// environments: the environment's branch, variables and ports, and a name of
+// its own, which keeps its container, image and checkout apart from the
+// project's. Variables and domains must be loaded on both
+func (p *Project) ForEnvironment(env *ProjectEnvironment) Project {
+	project := *p
+	project.ProjectEnvironment = env
+	project.Name = fmt.Sprintf("%s-%s", p.Name, env.Name)
+	project.GitBranch = env.GitBranch
+	project.AutoDeployBranch = env.GitBranch
+	project.Environments = env.Variables
+	if env.FrontendPort > 0 {
+		project.FrontendPort = env.FrontendPort
+		project.BackendPort = env.BackendPort
+	}
+
+	// Maintenance mode applies to production only
+	project.MaintenanceEnabled = false
+	project.MaintenanceWindows = nil
+	return project
+}
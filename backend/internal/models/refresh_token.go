@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a single refresh token issued to a login session
+// Only the SHA-256 hash of the token is stored. Every refresh rotates the
+// token: the old one is marked used and a new one is issued in the same
+// family, so a used token being presented again means it was stolen
+type RefreshToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID    uint   `gorm:"not null;index" json:"user_id"`
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"`
+	FamilyID  string `gorm:"not null;index" json:"family_id"` // Login session (device), shared by all rotations
+
+	// Device info captured when the token was issued
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`    // Set once the token has been rotated
+	RevokedAt *time.Time `json:"revoked_at,omitempty"` // Set on logout or reuse detection
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -0,0 +1,291 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Trigger rule events
+const (
+	TriggerEventTag     = "tag"     // A tag is pushed (GitHub, GitLab, Gitea)
+	TriggerEventRelease = "release" // A release is published (GitHub, Gitea)
+)
+
+// semverPrefix marks trigger patterns that are semver ranges instead of globs
+const semverPrefix = "semver:"
+
+// TriggerRule deploys the project (production) at a tag when the tag is pushed
+// or a release is published for it, and the tag matches the rule's pattern
+type TriggerRule struct {
+	Event   string `json:"event"`   // tag, release
+	Pattern string `json:"pattern"` // Glob such as v*, or a semver range such as semver:>=1.4.0 <2.0.0
+}
+
+// Valid reports whether the rule has a known event and a pattern that parses
+func (r TriggerRule) Valid() bool {
+	if r.Event != TriggerEventTag && r.Event != TriggerEventRelease {
+		return false
+	}
+	if constraint, ok := strings.CutPrefix(r.Pattern, semverPrefix); ok {
+		_, err := parseSemverRange(constraint)
+		return err == nil
+	}
+	_, err := path.Match(r.Pattern, "")
+	return strings.TrimSpace(r.Pattern) != "" && err == nil
+}
+
+// Matches reports whether a tag matches the rule's pattern
+// Semver ranges only match tags that are versions, with or without a v prefix
+func (r TriggerRule) Matches(tag string) bool {
+	constraint, ok := strings.CutPrefix(r.Pattern, semverPrefix)
+	if !ok {
+		matched, _ := path.Match(r.Pattern, tag)
+		return matched
+	}
+
+	alternatives, err := parseSemverRange(constraint)
+	if err != nil {
+		return false
+	}
+	version, ok := parseSemver(tag, false)
+	if !ok {
+		return false
+	}
+	for _, comparators := range alternatives {
+		if comparators.matches(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// TriggerRuleFor returns the first of the project's trigger rules for event
+// that matches tag, or nil if none does
+func (p *Project) TriggerRuleFor(event, tag string) *TriggerRule {
+	for i := range p.TriggerRules {
+		if p.TriggerRules[i].Event == event && p.TriggerRules[i].Matches(tag) {
+			return &p.TriggerRules[i]
+		}
+	}
+	return nil
+}
+
+// semver is a parsed semantic version; build metadata is dropped
+type semver struct {
+	major, minor, patch int
+	pre                 []string // Pre-release identifiers, e.g. rc, 1 for 2.0.0-rc.1
+}
+
+// parseSemver parses a version with an optional v prefix. With partial set,
+// minor and patch may be left out and count as 0, as in ^1.4
+func parseSemver(s string, partial bool) (semver, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, hasPre := strings.Cut(s, "-")
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || (len(parts) < 3 && !partial) {
+		return semver{}, false
+	}
+
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return semver{}, false
+		}
+		numbers[i] = n
+	}
+
+	version := semver{major: numbers[0], minor: numbers[1], patch: numbers[2]}
+	if hasPre {
+		version.pre = strings.Split(pre, ".")
+		for _, identifier := range version.pre {
+			if identifier == "" {
+				return semver{}, false
+			}
+		}
+	}
+	return version, true
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than o
+// A pre-release is lower than its release
+func (v semver) compare(o semver) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		a, aErr := strconv.Atoi(v.pre[i])
+		b, bErr := strconv.Atoi(o.pre[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if a != b {
+				return sign(a - b)
+			}
+		case aErr == nil: // Numeric identifiers are lower than alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(v.pre[i], o.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(v.pre) - len(o.pre))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// semverComparator is one condition of a range, e.g. >=1.4.0
+type semverComparator struct {
+	op      string // =, >, >=, <, <=
+	version semver
+}
+
+func (c semverComparator) matches(v semver) bool {
+	d := v.compare(c.version)
+	switch c.op {
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return d == 0
+}
+
+// semverComparators is a set of conditions that must all hold
+type semverComparators []semverComparator
+
+// matches checks v against every comparator. Like npm, pre-releases only
+// match when a comparator names a pre-release of the same version, so
+// >=1.4.0 doesn't pick up 2.0.0-rc.1
+func (cs semverComparators) matches(v semver) bool {
+	if len(v.pre) > 0 {
+		allowed := false
+		for _, c := range cs {
+			if len(c.version.pre) > 0 && c.version.major == v.major && c.version.minor == v.minor && c.version.patch == v.patch {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	for _, c := range cs {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSemverRange parses alternatives separated by ||, each a list of
+// comparators separated by spaces: =, >, >=, <, <=, ^ (same major version)
+// and ~ (same minor version), e.g. ">=1.4.0 <2.0.0 || ^3.1"
+func parseSemverRange(s string) ([]semverComparators, error) {
+	var alternatives []semverComparators
+	for _, alternative := range strings.Split(s, "||") {
+		var comparators semverComparators
+
+		fields := strings.Fields(alternative)
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Allow a space between the operator and the version, as in >= 1.4.0
+			if strings.Trim(field, "<>=^~") == "" && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+
+			parsed, err := parseSemverComparator(field)
+			if err != nil {
+				return nil, err
+			}
+			comparators = append(comparators, parsed...)
+		}
+
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("empty semver range")
+		}
+		alternatives = append(alternatives, comparators)
+	}
+	return alternatives, nil
+}
+
+// parseSemverComparator parses one comparator; ^ and ~ expand to a lower and
+// an upper bound
+func parseSemverComparator(s string) ([]semverComparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+
+	version, ok := parseSemver(strings.TrimPrefix(s, op), true)
+	if !ok {
+		return nil, fmt.Errorf("invalid version in semver range: %q", s)
+	}
+	// How many of major, minor and patch are given, e.g. 2 for ^1.4
+	core := strings.TrimPrefix(strings.TrimPrefix(s, op), "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	given := strings.Count(core, ".") + 1
+
+	switch op {
+	case "^":
+		// Like npm, bump the first non-zero part, or the last one given:
+		// ^1.4.0 is <2.0.0, ^0.4.0 is <0.5.0, ^0.0.3 is <0.0.4 and ^0.0 is <0.1.0
+		var upper semver
+		switch {
+		case version.major > 0 || given == 1:
+			upper = semver{major: version.major + 1}
+		case version.minor > 0 || given == 2:
+			upper = semver{minor: version.minor + 1}
+		default:
+			upper = semver{patch: version.patch + 1}
+		}
+		return []semverComparator{{op: ">=", version: version}, {op: "<", version: upper}}, nil
+	case "~":
+		// ~1.4 and ~1.4.2 keep the minor version, ~1 only the major one
+		upper := semver{major: version.major, minor: version.minor + 1}
+		if given == 1 {
+			upper = semver{major: version.major + 1}
+		}
+		return []semverComparator{{op: ">=", version: version}, {op: "<", version: upper}}, nil
+	case "":
+		op = "="
+	}
+	return []semverComparator{{op: op, version: version}}, nil
+}
@@ -0,0 +1,119 @@
+package models
+
+import "testing"
+
+func TestTriggerRuleMatchesSemverRanges(t *testing.T) {
+	tests := []struct {
+		pattern string
+		tag     string
+		want    bool
+	}{
+		// Comparators, with or without a space after the operator
+		{"semver:>=1.4.0 <2.0.0", "v1.4.0", true},
+		{"semver:>=1.4.0 <2.0.0", "1.9.3", true},
+		{"semver:>=1.4.0 <2.0.0", "v2.0.0", false},
+		{"semver:>=1.4.0 <2.0.0", "v1.3.9", false},
+		{"semver:>= 1.4.0 < 2.0.0", "v1.5.0", true},
+		{"semver:>= 1.4.0 < 2.0.0", "v2.0.0", false},
+		{"semver:=1.4.0", "v1.4.0", true},
+		{"semver:1.4.0", "v1.4.1", false},
+		{"semver:>1.4.0", "v1.4.0", false},
+		{"semver:<=1.4.0", "v1.4.0+build.5", true},
+
+		// ^ keeps the first non-zero part
+		{"semver:^1.4.2", "v1.9.0", true},
+		{"semver:^1.4.2", "v1.4.1", false},
+		{"semver:^1.4.2", "v2.0.0", false},
+		{"semver:^1.4", "v1.4.0", true},
+		{"semver:^1", "v1.99.0", true},
+		{"semver:^0.4.2", "v0.4.9", true},
+		{"semver:^0.4.2", "v0.5.0", false},
+		{"semver:^0.0.3", "v0.0.3", true},
+		{"semver:^0.0.3", "v0.0.4", false},
+		{"semver:^0.0", "v0.0.9", true},
+		{"semver:^0.0", "v0.1.0", false},
+		{"semver:^0", "v0.9.0", true},
+		{"semver:^0", "v1.0.0", false},
+
+		// ~ keeps the minor version, or the major one when only that is given
+		{"semver:~1.4.2", "v1.4.9", true},
+		{"semver:~1.4.2", "v1.5.0", false},
+		{"semver:~1.4", "v1.4.0", true},
+		{"semver:~1", "v1.9.0", true},
+		{"semver:~1", "v2.0.0", false},
+
+		// Pre-releases only match ranges naming a pre-release of the same version
+		{"semver:>=1.4.0", "v2.0.0-rc.1", false},
+		{"semver:^2.0.0-rc.1", "v2.0.0-rc.2", true},
+		{"semver:^2.0.0-rc.1", "v2.0.0-beta.1", false},
+		{"semver:^2.0.0-rc.1", "v2.0.0", true},
+		{"semver:^2.0.0-rc.1", "v2.1.0-rc.1", false},
+		{"semver:>=2.0.0-rc.2", "v2.0.0-rc.10", true},
+		{"semver:>=2.0.0-rc.1", "v2.0.0-1", false},
+
+		// Alternatives
+		{"semver:^1.4 || ^3.1", "v3.2.0", true},
+		{"semver:^1.4 || ^3.1", "v2.0.0", false},
+		{"semver:<1.0.0||>=3.0.0", "v0.9.0", true},
+		{"semver:<1.0.0||>=3.0.0", "v3.0.0", true},
+
+		// Only versions match semver ranges
+		{"semver:>=1.0.0", "release-2", false},
+		{"semver:>=1.0.0", "v1.4", false},
+		{"semver:>=1.0.0", "v01.4.0", false},
+
+		// Patterns without the prefix are globs
+		{"v*", "v1.4.0", true},
+		{"v*", "release-1", false},
+		{"release-*", "release-1", true},
+	}
+
+	for _, tt := range tests {
+		rule := TriggerRule{Event: TriggerEventTag, Pattern: tt.pattern}
+		if got := rule.Matches(tt.tag); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestTriggerRuleValid(t *testing.T) {
+	tests := []struct {
+		rule TriggerRule
+		want bool
+	}{
+		{TriggerRule{Event: TriggerEventTag, Pattern: "v*"}, true},
+		{TriggerRule{Event: TriggerEventRelease, Pattern: "semver:>= 1.4.0 <2.0.0 || ^3"}, true},
+		{TriggerRule{Event: "push", Pattern: "v*"}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: " "}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: "v["}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: "semver:"}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: "semver:^1.4 ||"}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: "semver:>=1.x"}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: "semver:>=1.4.0-"}, false},
+		{TriggerRule{Event: TriggerEventTag, Pattern: "semver:>=1.2.3.4"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.Valid(); got != tt.want {
+			t.Errorf("%+v valid = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestTriggerRuleFor(t *testing.T) {
+	project := &Project{TriggerRules: []TriggerRule{
+		{Event: TriggerEventTag, Pattern: "semver:^1.0.0"},
+		{Event: TriggerEventTag, Pattern: "v*"},
+		{Event: TriggerEventRelease, Pattern: "v2*"},
+	}}
+
+	if rule := project.TriggerRuleFor(TriggerEventTag, "v1.2.0"); rule != &project.TriggerRules[0] {
+		t.Errorf("v1.2.0 tag matched %+v, want the first rule", rule)
+	}
+	if rule := project.TriggerRuleFor(TriggerEventTag, "v2.0.0"); rule != &project.TriggerRules[1] {
+		t.Errorf("v2.0.0 tag matched %+v, want the glob", rule)
+	}
+	if rule := project.TriggerRuleFor(TriggerEventRelease, "v1.2.0"); rule != nil {
+		t.Errorf("v1.2.0 release matched %+v, want none", rule)
+	}
+}
@@ -19,13 +19,13 @@ type User struct {
 
 	// OAuth connections
 	GitHubConnected bool   `json:"github_connected"`
-	GitHubToken     string `json:"-"` // Never send to frontend
+	GitHubToken     string `gorm:"serializer:encrypted" json:"-"` // Never send to frontend (encrypted at rest)
 	GitHubUsername  string `json:"github_username,omitempty"`
 	GitLabConnected bool   `json:"gitlab_connected"`
-	GitLabToken     string `json:"-"` // Never send to frontend
+	GitLabToken     string `gorm:"serializer:encrypted" json:"-"` // Never send to frontend (encrypted at rest)
 	GitLabUsername  string `json:"gitlab_username,omitempty"`
 	GiteaConnected  bool   `json:"gitea_connected"`
-	GiteaToken      string `json:"-"` // Never send to frontend
+	GiteaToken      string `gorm:"serializer:encrypted" json:"-"` // Never send to frontend (encrypted at rest)
 	GiteaUsername   string `json:"gitea_username,omitempty"`
 	GiteaURL        string `json:"gitea_url,omitempty"` // User's Gitea instance URL
 
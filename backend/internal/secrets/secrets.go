@@ -0,0 +1,293 @@
+// Package secrets encrypts sensitive database columns at rest
+//
+// Values are envelope encrypted: every value gets its own random data key
+// (AES-256-GCM), and the data key is wrapped with the master key. Stored values
+// look like
+//
+//	enc:v1:<key id>:<wrapped data key>:<ciphertext>
+//
+// The key id identifies the master key that wrapped the data key, so values
+// written with a previous master key can still be read during a key rotation
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/vps-panel/backend/internal/config"
+)
+
+const (
+	prefix  = "enc:v1:"
+	keySize = 32
+)
+
+var (
+	// ErrNotInitialized is returned when values are encrypted before Init was called
+	ErrNotInitialized = errors.New("secrets: encryption keys not initialized")
+	// ErrUnknownKey is returned when a value was encrypted with a master key that isn't configured
+	ErrUnknownKey = errors.New("secrets: value was encrypted with an unknown master key")
+)
+
+// Keyring holds the master key used for new values and previous keys that can still decrypt
+type Keyring struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+var (
+	mu      sync.RWMutex
+	keyring *Keyring
+)
+
+// Init loads the master keys from the configuration and registers the GORM serializers
+// It must be called before the database is opened
+func Init(cfg *config.Config) error {
+	k, err := LoadKeyring(cfg)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	keyring = k
+	mu.Unlock()
+
+	registerSerializers()
+	return nil
+}
+
+// LoadKeyring reads the master key from ENCRYPTION_KEY or the key file, plus any previous keys
+// If neither is set, a new key file is generated so a fresh install works out of the box
+func LoadKeyring(cfg *config.Config) (*Keyring, error) {
+	encoded := strings.TrimSpace(cfg.EncryptionKey)
+	if encoded == "" {
+		data, err := os.ReadFile(cfg.EncryptionKeyFile)
+		switch {
+		case err == nil:
+			encoded = strings.TrimSpace(string(data))
+		case os.IsNotExist(err):
+			encoded, err = generateKeyFile(cfg.EncryptionKeyFile)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+	}
+
+	current, err := decodeKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	k := &Keyring{
+		currentID: keyID(current),
+		keys:      map[string][]byte{keyID(current): current},
+	}
+
+	for _, previous := range strings.Split(cfg.EncryptionPreviousKeys, ",") {
+		previous = strings.TrimSpace(previous)
+		if previous == "" {
+			continue
+		}
+		key, err := decodeKey(previous)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous encryption key: %w", err)
+		}
+		k.keys[keyID(key)] = key
+	}
+
+	return k, nil
+}
+
+// GenerateKey returns a new random master key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// IsEncrypted reports whether a stored value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// IsCurrent reports whether a stored value is encrypted with the current master key
+func IsCurrent(value string) bool {
+	if !IsEncrypted(value) {
+		return false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if keyring == nil {
+		return false
+	}
+	return strings.HasPrefix(value, prefix+keyring.currentID+":")
+}
+
+// Encrypt encrypts a value with a fresh data key wrapped by the current master key
+// Empty values are stored as-is
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	mu.RLock()
+	k := keyring
+	mu.RUnlock()
+	if k == nil {
+		return "", ErrNotInitialized
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := seal(k.keys[k.currentID], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + k.currentID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt reverses Encrypt. Values that aren't encrypted (e.g. rows written
+// before encryption was enabled) are returned unchanged
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("secrets: malformed encrypted value")
+	}
+
+	mu.RLock()
+	k := keyring
+	mu.RUnlock()
+	if k == nil {
+		return "", ErrNotInitialized
+	}
+
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("secrets: malformed data key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("secrets: malformed ciphertext: %w", err)
+	}
+
+	dataKey, err := open(masterKey, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("secrets: failed to unwrap data key: %w", err)
+	}
+
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("secrets: failed to decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// seal encrypts with AES-GCM and prepends the nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64 encoded: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+// keyID is a short fingerprint of a master key, stored with every value
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func generateKeyFile(path string) (string, error) {
+	encoded, err := GenerateKey()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create encryption key directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write encryption key file: %w", err)
+	}
+
+	log.Printf("⚠️  Generated new encryption key at %s - back it up, secrets can't be recovered without it", path)
+	return encoded, nil
+}
@@ -0,0 +1,196 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vps-panel/backend/internal/config"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// initKeys loads current as the master key, with previous keys that can still decrypt
+func initKeys(t *testing.T, current string, previous ...string) {
+	t.Helper()
+
+	cfg := &config.Config{EncryptionKey: current, EncryptionPreviousKeys: strings.Join(previous, ", ")}
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	initKeys(t, newKey(t))
+
+	encrypted, err := Encrypt("ghp_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || !IsCurrent(encrypted) || strings.Contains(encrypted, "ghp_token") {
+		t.Fatalf("Encrypt = %q, want a value encrypted with the current key", encrypted)
+	}
+
+	decrypted, err := Decrypt(encrypted)
+	if err != nil || decrypted != "ghp_token" {
+		t.Errorf("Decrypt = %q, %v", decrypted, err)
+	}
+
+	// Every value gets its own data key and nonce
+	if again, _ := Encrypt("ghp_token"); again == encrypted {
+		t.Error("encrypting the same value twice gave the same result")
+	}
+
+	// Empty values and values from before encryption are passed through
+	if encrypted, err := Encrypt(""); encrypted != "" || err != nil {
+		t.Errorf("Encrypt(\"\") = %q, %v", encrypted, err)
+	}
+	if decrypted, err := Decrypt("plaintext"); decrypted != "plaintext" || err != nil {
+		t.Errorf("Decrypt(plaintext) = %q, %v", decrypted, err)
+	}
+	if IsEncrypted("plaintext") || IsCurrent("plaintext") {
+		t.Error("plaintext reported as encrypted")
+	}
+}
+
+func TestDecryptWithPreviousKeys(t *testing.T) {
+	oldKey, currentKey := newKey(t), newKey(t)
+
+	initKeys(t, oldKey)
+	encrypted, err := Encrypt("webhook-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// During a rotation old values still decrypt, but aren't current
+	initKeys(t, currentKey, oldKey)
+	if decrypted, err := Decrypt(encrypted); err != nil || decrypted != "webhook-secret" {
+		t.Errorf("Decrypt with the previous key = %q, %v", decrypted, err)
+	}
+	if IsCurrent(encrypted) {
+		t.Error("value of the previous key reported as current")
+	}
+	if reencrypted, _ := Encrypt("webhook-secret"); !IsCurrent(reencrypted) {
+		t.Error("new value not encrypted with the current key")
+	}
+
+	// Once the previous key is dropped its values can't be read
+	initKeys(t, currentKey)
+	if _, err := Decrypt(encrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt without the previous key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestDecryptRejectsDamagedValues(t *testing.T) {
+	initKeys(t, newKey(t))
+
+	encrypted, err := Encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(encrypted, prefix), ":")
+
+	// Flip a character of the ciphertext, keeping it valid base64
+	ciphertext := []byte(parts[2])
+	if ciphertext[0] == 'A' {
+		ciphertext[0] = 'B'
+	} else {
+		ciphertext[0] = 'A'
+	}
+
+	for name, value := range map[string]string{
+		"missing part":        prefix + parts[0] + ":" + parts[1],
+		"invalid data key":    prefix + parts[0] + ":!:" + parts[2],
+		"modified data key":   prefix + parts[0] + ":" + parts[2] + ":" + parts[2],
+		"modified ciphertext": prefix + parts[0] + ":" + parts[1] + ":" + string(ciphertext),
+	} {
+		if _, err := Decrypt(value); err == nil {
+			t.Errorf("%s: Decrypt succeeded", name)
+		}
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	initKeys(t, newKey(t))
+	encrypted, err := Encrypt("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	saved := keyring
+	keyring = nil
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		keyring = saved
+		mu.Unlock()
+	})
+
+	if _, err := Encrypt("token"); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Encrypt = %v, want ErrNotInitialized", err)
+	}
+	if _, err := Decrypt(encrypted); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Decrypt = %v, want ErrNotInitialized", err)
+	}
+	if IsCurrent(encrypted) {
+		t.Error("IsCurrent without keys = true")
+	}
+}
+
+func TestLoadKeyringGeneratesKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "encryption.key")
+
+	first, err := LoadKeyring(&config.Config{EncryptionKeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Later starts read the same key
+	second, err := LoadKeyring(&config.Config{EncryptionKeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.currentID != second.currentID {
+		t.Errorf("key changed between starts: %s, %s", first.currentID, second.currentID)
+	}
+}
+
+func TestLoadKeyringRejectsInvalidKeys(t *testing.T) {
+	valid := newKey(t)
+
+	for name, cfg := range map[string]*config.Config{
+		"not base64":       {EncryptionKey: "not base64!"},
+		"too short":        {EncryptionKey: "c2hvcnQ="},
+		"invalid previous": {EncryptionKey: valid, EncryptionPreviousKeys: "c2hvcnQ="},
+	} {
+		if _, err := LoadKeyring(cfg); err == nil {
+			t.Errorf("%s: LoadKeyring succeeded", name)
+		}
+	}
+
+	k, err := LoadKeyring(&config.Config{EncryptionKey: valid, EncryptionPreviousKeys: " , " + newKey(t) + ","})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.keys) != 2 {
+		t.Errorf("loaded %d keys, want the current and one previous key", len(k.keys))
+	}
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// registerSerializers makes the serializers available as struct tags:
+//
+//	`gorm:"serializer:encrypted"`           always encrypted
+//	`gorm:"serializer:encrypted_if_secret"` encrypted when the row's IsSecret field is true
+func registerSerializers() {
+	schema.RegisterSerializer("encrypted", encryptedSerializer{})
+	schema.RegisterSerializer("encrypted_if_secret", encryptedSerializer{onlyIfSecret: true})
+}
+
+type encryptedSerializer struct {
+	onlyIfSecret bool
+}
+
+// Scan decrypts the column into the string field
+func (s encryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("secrets: unsupported column type %T for %s", dbValue, field.Name)
+	}
+
+	plaintext, err := Decrypt(stored)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field.Name, err)
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+// Value encrypts the string field before it is written
+func (s encryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("secrets: %s must be a string", field.Name)
+	}
+
+	if s.onlyIfSecret && !isSecretRow(ctx, field, dst) {
+		return plaintext, nil
+	}
+
+	return Encrypt(plaintext)
+}
+
+func isSecretRow(ctx context.Context, field *schema.Field, dst reflect.Value) bool {
+	secretField := field.Schema.LookUpField("IsSecret")
+	if secretField == nil || !dst.IsValid() {
+		return false
+	}
+
+	isSecret, _ := secretField.ValueOf(ctx, dst)
+	secret, _ := isSecret.(bool)
+	return secret
+}
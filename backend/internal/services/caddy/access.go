@@ -0,0 +1,82 @@
+package caddy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// AccessConfig is an access policy applied to some of the site's hosts
+type AccessConfig struct {
+	Name  string // matcher prefix
+	Hosts string // space separated
+	Allow string // space separated IPs/CIDRs, empty allows everyone
+	Deny  string // space separated IPs/CIDRs
+	Users []AccessUserConfig
+}
+
+type AccessUserConfig struct {
+	Username     string
+	PasswordHash string // bcrypt
+}
+
+// addAccess turns the project's access policies into per-host checks
+// Must run after addDomains. A domain's own policy replaces the project-wide
+// one for that domain; policies of inactive or redirect-only domains are
+// dropped since those hosts don't serve the site.
+func (c *CaddyConfig) addAccess(policies []models.AccessPolicy) {
+	hosts := make(map[uint]string, len(c.Domains))
+	for _, domain := range c.Domains {
+		hosts[domain.ID] = domain.Domain
+	}
+
+	var projectWide *models.AccessPolicy
+	own := make(map[uint]bool)
+	for i := range policies {
+		policy := &policies[i]
+		if policy.DomainID == nil {
+			projectWide = policy
+			continue
+		}
+		host, ok := hosts[*policy.DomainID]
+		if !ok {
+			continue
+		}
+		own[*policy.DomainID] = true
+		c.appendAccess(policy, []string{host})
+	}
+
+	if projectWide == nil {
+		return
+	}
+	var rest []string
+	for _, domain := range c.Domains {
+		if !own[domain.ID] {
+			rest = append(rest, domain.Domain)
+		}
+	}
+	if len(rest) > 0 {
+		c.appendAccess(projectWide, rest)
+	}
+}
+
+func (c *CaddyConfig) appendAccess(policy *models.AccessPolicy, hosts []string) {
+	access := AccessConfig{
+		Name:  fmt.Sprintf("access%d", len(c.Access)+1),
+		Hosts: strings.Join(hosts, " "),
+		Allow: strings.Join(policy.AllowCIDRs, " "),
+		Deny:  strings.Join(policy.DenyCIDRs, " "),
+	}
+	for _, user := range policy.Users {
+		access.Users = append(access.Users, AccessUserConfig{
+			Username:     user.Username,
+			PasswordHash: user.PasswordHash,
+		})
+	}
+
+	if access.Allow == "" && access.Deny == "" && len(access.Users) == 0 {
+		return
+	}
+	c.Access = append(c.Access, access)
+}
@@ -0,0 +1,423 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// errAdminUnavailable is returned when the admin API can't be reached at all
+var errAdminUnavailable = errors.New("caddy admin API unavailable")
+
+// adminClient talks to Caddy's JSON admin API (https://caddyserver.com/docs/api)
+//
+// Site blocks are rendered from the same templates as in file mode and turned
+// into JSON with the /adapt endpoint, which also validates them. The resulting
+// routes are wrapped in a single route tagged with an @id per project, so a
+// project can be replaced or removed with one request that leaves all other
+// sites alone. Caddy applies every change atomically: if the new config fails
+// to load, the running config is kept.
+type adminClient struct {
+	baseURL string
+	server  string // HTTP server the project routes are added to, e.g. srv0
+	client  *http.Client
+}
+
+func newAdminClient(baseURL, server string) *adminClient {
+	return &adminClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		server:  server,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// projectRouteIDPrefix marks the routes managed by the panel
+const projectRouteIDPrefix = "vps-panel-project-"
+
+// projectRouteID is the @id of the route holding a project's site, or the
+// site of one of its previews or environments
+func projectRouteID(project *models.Project) string {
+	if project.Preview != nil {
+		return fmt.Sprintf("%s%d-pr-%d", projectRouteIDPrefix, project.ID, project.Preview.Number)
+	}
+	if project.ProjectEnvironment != nil {
+		return fmt.Sprintf("%s%d-env-%d", projectRouteIDPrefix, project.ID, project.ProjectEnvironment.ID)
+	}
+	return fmt.Sprintf("%s%d", projectRouteIDPrefix, project.ID)
+}
+
+// adaptedConfig is the part of an adapted Caddyfile the panel uses
+// Per-site logging is not carried over in admin API mode. Neither are TLS
+// connection policies: uploaded certificates are loaded into the TLS app and
+// picked by SNI, and Caddy doesn't obtain certificates for the names they cover
+type adaptedConfig struct {
+	Apps struct {
+		HTTP struct {
+			Servers map[string]struct {
+				Listen []string          `json:"listen"`
+				Routes []json.RawMessage `json:"routes"`
+			} `json:"servers"`
+		} `json:"http"`
+		TLS struct {
+			Certificates struct {
+				LoadFiles []json.RawMessage `json:"load_files"`
+			} `json:"certificates"`
+		} `json:"tls"`
+	} `json:"apps"`
+}
+
+// applySite validates a site block and installs it as the route with the given @id
+func (c *adminClient) applySite(id string, site []byte) error {
+	route, certificates, err := c.buildRoute(id, site)
+	if err != nil {
+		return err
+	}
+	if err := c.loadCertificates(certificates); err != nil {
+		return err
+	}
+	return c.applyRoute(id, route)
+}
+
+// buildRoute adapts a site block into a single route with the given @id,
+// also returning the certificate files the site loads
+func (c *adminClient) buildRoute(id string, site []byte) ([]byte, []json.RawMessage, error) {
+	routes, certificates, err := c.adapt(site)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	route, err := json.Marshal(map[string]interface{}{
+		"@id": id,
+		"handle": []map[string]interface{}{
+			{"handler": "subroute", "routes": routes},
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode Caddy route: %w", err)
+	}
+	return route, certificates, nil
+}
+
+// applyRoute adds a route or replaces the one with the same @id
+func (c *adminClient) applyRoute(id string, route []byte) error {
+	// Replace the existing route in place
+	exists, err := c.exists("/id/" + id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return c.do(http.MethodPatch, "/id/"+id, route, nil)
+	}
+
+	serverPath := "/config/apps/http/servers/" + c.server
+	if ok, err := c.exists(serverPath); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("caddy server %q not found, check CADDY_ADMIN_SERVER", c.server)
+	}
+
+	// Project routes are matched by host, so they go before the server's
+	// existing routes which may include catch-alls
+	var existing []json.RawMessage
+	if err := c.do(http.MethodGet, serverPath+"/routes", nil, &existing); err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return c.do(http.MethodPut, serverPath+"/routes", []byte("["+string(route)+"]"), nil)
+	}
+	return c.do(http.MethodPut, serverPath+"/routes/0", route, nil)
+}
+
+// getRoute returns the route with the given @id, or nil if there is none
+func (c *adminClient) getRoute(id string) (json.RawMessage, error) {
+	var route json.RawMessage
+	err := c.do(http.MethodGet, "/id/"+id, nil, &route)
+
+	var apiErr *adminError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil || string(route) == "null" {
+		return nil, err
+	}
+	return route, nil
+}
+
+// routeIDs returns the @ids of the server's routes that start with prefix
+func (c *adminClient) routeIDs(prefix string) ([]string, error) {
+	var routes []struct {
+		ID string `json:"@id"`
+	}
+	if err := c.do(http.MethodGet, "/config/apps/http/servers/"+c.server+"/routes", nil, &routes); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, route := range routes {
+		if strings.HasPrefix(route.ID, prefix) {
+			ids = append(ids, route.ID)
+		}
+	}
+	return ids, nil
+}
+
+// removeSite deletes the route with the given @id, if present
+func (c *adminClient) removeSite(id string) error {
+	exists, err := c.exists("/id/" + id)
+	if err != nil || !exists {
+		return err
+	}
+	return c.do(http.MethodDelete, "/id/"+id, nil, nil)
+}
+
+// adapt converts a Caddyfile site block to JSON routes and certificate files
+// to load, without loading them. The routes are all added to one server, so
+// the site must only listen on that server's addresses: plain HTTP sites,
+// which Caddy serves on port 80, are refused when the server is the HTTPS one
+func (c *adminClient) adapt(site []byte) ([]json.RawMessage, []json.RawMessage, error) {
+	var resp struct {
+		Warnings []struct {
+			Message string `json:"message"`
+		} `json:"warnings"`
+		Result adaptedConfig `json:"result"`
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/adapt", bytes.NewReader(site))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "text/caddyfile")
+	if err := c.send(req, &resp); err != nil {
+		var apiErr *adminError
+		if errors.As(err, &apiErr) {
+			return nil, nil, fmt.Errorf("invalid Caddy config: %w", err)
+		}
+		return nil, nil, err
+	}
+
+	for _, w := range resp.Warnings {
+		log.Printf("Caddy adapt warning: %s", w.Message)
+	}
+
+	listen, err := c.serverListen()
+	if err != nil {
+		return nil, nil, err
+	}
+	served := make(map[string]bool, len(listen))
+	for _, address := range listen {
+		served[address] = true
+	}
+
+	names := make([]string, 0, len(resp.Result.Apps.HTTP.Servers))
+	for name, server := range resp.Result.Apps.HTTP.Servers {
+		for _, address := range server.Listen {
+			if !served[address] {
+				return nil, nil, fmt.Errorf("site listens on %s, but Caddy server %q only on %s; "+
+					"sites on other addresses, such as domains without SSL, can't be served in admin API mode",
+					address, c.server, strings.Join(listen, ", "))
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var routes []json.RawMessage
+	for _, name := range names {
+		routes = append(routes, resp.Result.Apps.HTTP.Servers[name].Routes...)
+	}
+	if len(routes) == 0 {
+		return nil, nil, fmt.Errorf("invalid Caddy config: site has no routes")
+	}
+
+	return routes, resp.Result.Apps.TLS.Certificates.LoadFiles, nil
+}
+
+// serverListen returns the addresses the server project routes are added to listens on
+func (c *adminClient) serverListen() ([]string, error) {
+	var listen []string
+	err := c.do(http.MethodGet, "/config/apps/http/servers/"+c.server+"/listen", nil, &listen)
+
+	var apiErr *adminError
+	if (errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound) || (err == nil && len(listen) == 0) {
+		return nil, fmt.Errorf("caddy server %q not found, check CADDY_ADMIN_SERVER", c.server)
+	}
+	return listen, err
+}
+
+// tlsAppPath is the TLS app of the running config, which holds loaded certificates
+const tlsAppPath = "/config/apps/tls"
+
+// loadCertificates adds certificate files to the TLS app, replacing the entry
+// loading the same file
+func (c *adminClient) loadCertificates(files []json.RawMessage) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	return c.updateLoadedFiles(func(loaded []interface{}) ([]interface{}, bool) {
+		changed := false
+		for _, raw := range files {
+			var file map[string]interface{}
+			if err := json.Unmarshal(raw, &file); err != nil {
+				continue
+			}
+
+			found := false
+			for i, entry := range loaded {
+				if loadedFile(entry) != file["certificate"] {
+					continue
+				}
+				found = true
+				if !reflect.DeepEqual(entry, interface{}(file)) {
+					loaded[i] = file
+					changed = true
+				}
+			}
+			if !found {
+				loaded = append(loaded, file)
+				changed = true
+			}
+		}
+		return loaded, changed
+	})
+}
+
+// unloadCertificate removes the entries loading a certificate file from the TLS app
+func (c *adminClient) unloadCertificate(certFile string) error {
+	return c.updateLoadedFiles(func(loaded []interface{}) ([]interface{}, bool) {
+		kept := loaded[:0]
+		for _, entry := range loaded {
+			if loadedFile(entry) != certFile {
+				kept = append(kept, entry)
+			}
+		}
+		return kept, len(kept) != len(loaded)
+	})
+}
+
+// updateLoadedFiles changes the certificate files of the TLS app, creating the
+// app if needed. Nothing is written unless update reports a change
+func (c *adminClient) updateLoadedFiles(update func(loaded []interface{}) ([]interface{}, bool)) error {
+	var app map[string]interface{}
+	err := c.do(http.MethodGet, tlsAppPath, nil, &app)
+
+	var apiErr *adminError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound) {
+		return err
+	}
+	if app == nil {
+		app = make(map[string]interface{})
+	}
+
+	certificates, _ := app["certificates"].(map[string]interface{})
+	if certificates == nil {
+		certificates = make(map[string]interface{})
+	}
+	loaded, _ := certificates["load_files"].([]interface{})
+
+	loaded, changed := update(loaded)
+	if !changed {
+		return nil
+	}
+	certificates["load_files"] = loaded
+	app["certificates"] = certificates
+
+	body, err := json.Marshal(app)
+	if err != nil {
+		return fmt.Errorf("failed to encode Caddy TLS app: %w", err)
+	}
+	return c.do(http.MethodPost, tlsAppPath, body, nil)
+}
+
+// loadedFile returns the certificate file of a load_files entry
+func loadedFile(entry interface{}) interface{} {
+	if file, ok := entry.(map[string]interface{}); ok {
+		return file["certificate"]
+	}
+	return nil
+}
+
+// exists reports whether a config path or @id is set
+func (c *adminClient) exists(path string) (bool, error) {
+	var value json.RawMessage
+	err := c.do(http.MethodGet, path, nil, &value)
+
+	var apiErr *adminError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Unset config paths are returned as null
+	return len(value) > 0 && string(value) != "null", nil
+}
+
+func (c *adminClient) do(method, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.send(req, out)
+}
+
+// adminError is an error response of the admin API
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return fmt.Sprintf("caddy admin API returned %d: %s", e.status, e.message)
+}
+
+func (c *adminClient) send(req *http.Request, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errAdminUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Caddy admin API response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			message = body.Error
+		}
+		return &adminError{status: resp.StatusCode, message: message}
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode Caddy admin API response: %w", err)
+		}
+	}
+	return nil
+}
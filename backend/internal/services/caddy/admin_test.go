@@ -0,0 +1,252 @@
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// stubAdmin is a minimal Caddy admin API serving one HTTP server, srv0
+type stubAdmin struct {
+	t      *testing.T
+	mu     sync.Mutex
+	listen []string
+	routes []json.RawMessage
+	adapt  map[string][]string // listen addresses of the adapted servers, by the site's first line
+}
+
+func newStubAdmin(t *testing.T, listen ...string) (*stubAdmin, *httptest.Server) {
+	stub := &stubAdmin{
+		t:      t,
+		listen: listen,
+		routes: []json.RawMessage{json.RawMessage(`{"handle":[{"handler":"static_response"}]}`)},
+		adapt:  make(map[string][]string),
+	}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func (a *stubAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	const server = "/config/apps/http/servers/srv0"
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/adapt":
+		// Every adapted server gets one route for the site
+		site, _, _ := strings.Cut(string(body), "\n")
+		servers := map[string]interface{}{}
+		for i, address := range a.adapt[site] {
+			servers[fmt.Sprintf("srv%d", i)] = map[string]interface{}{
+				"listen": []string{address},
+				"routes": []interface{}{map[string]interface{}{"match": []interface{}{map[string]interface{}{"host": []string{site}}}}},
+			}
+		}
+		writeJSON(w, map[string]interface{}{"result": map[string]interface{}{"apps": map[string]interface{}{"http": map[string]interface{}{"servers": servers}}}})
+	case r.Method == http.MethodGet && r.URL.Path == server:
+		writeJSON(w, map[string]interface{}{"listen": a.listen, "routes": a.routes})
+	case r.Method == http.MethodGet && r.URL.Path == server+"/listen":
+		writeJSON(w, a.listen)
+	case r.Method == http.MethodGet && r.URL.Path == server+"/routes":
+		writeJSON(w, a.routes)
+	case r.Method == http.MethodPut && r.URL.Path == server+"/routes":
+		a.routes = nil
+		json.Unmarshal(body, &a.routes)
+	case r.Method == http.MethodPut && r.URL.Path == server+"/routes/0":
+		a.routes = append([]json.RawMessage{body}, a.routes...)
+	case strings.HasPrefix(r.URL.Path, "/id/"):
+		i := a.routeIndex(strings.TrimPrefix(r.URL.Path, "/id/"))
+		if i < 0 {
+			http.Error(w, `{"error":"unknown object ID"}`, http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Write(a.routes[i])
+		case http.MethodPatch:
+			a.routes[i] = body
+		case http.MethodDelete:
+			a.routes = append(a.routes[:i], a.routes[i+1:]...)
+		}
+	default:
+		a.t.Errorf("unexpected admin API request: %s %s", r.Method, r.URL.Path)
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	}
+}
+
+func (a *stubAdmin) routeIndex(id string) int {
+	for i, route := range a.routes {
+		var r struct {
+			ID string `json:"@id"`
+		}
+		if json.Unmarshal(route, &r) == nil && r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a *stubAdmin) routeIDs() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var ids []string
+	for _, route := range a.routes {
+		var r struct {
+			ID string `json:"@id"`
+		}
+		json.Unmarshal(route, &r)
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestAdminApplySiteAddsRouteBeforeExistingOnes(t *testing.T) {
+	stub, server := newStubAdmin(t, ":443")
+	stub.adapt["app.example.com {"] = []string{":443"}
+	client := newAdminClient(server.URL, "srv0")
+
+	id := projectRouteIDPrefix + "1"
+	if err := client.applySite(id, []byte("app.example.com {\n}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if ids := stub.routeIDs(); len(ids) != 2 || ids[0] != id || ids[1] != "" {
+		t.Fatalf("routes = %q, want the project route before the catch-all", ids)
+	}
+
+	// Applying again replaces the route in place
+	if err := client.applySite(id, []byte("app.example.com {\n}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if ids := stub.routeIDs(); len(ids) != 2 || ids[0] != id {
+		t.Fatalf("routes = %q after reapplying, want the route replaced", ids)
+	}
+
+	ids, err := client.routeIDs(projectRouteIDPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Errorf("routeIDs = %q, want [%s]", ids, id)
+	}
+
+	if err := client.removeSite(id); err != nil {
+		t.Fatal(err)
+	}
+	if ids := stub.routeIDs(); len(ids) != 1 || ids[0] != "" {
+		t.Errorf("routes = %q after removing, want only the catch-all", ids)
+	}
+}
+
+func TestAdminAdaptRefusesSitesOnOtherListeners(t *testing.T) {
+	stub, server := newStubAdmin(t, ":443")
+	stub.adapt["http://app.example.com {"] = []string{":80"}
+	stub.adapt["app.example.com http://legacy.example.com {"] = []string{":443", ":80"}
+	client := newAdminClient(server.URL, "srv0")
+
+	for _, site := range []string{"http://app.example.com {\n}\n", "app.example.com http://legacy.example.com {\n}\n"} {
+		err := client.applySite(projectRouteIDPrefix+"1", []byte(site))
+		if err == nil || !strings.Contains(err.Error(), ":80") {
+			t.Errorf("applySite(%q) = %v, want an error about :80", site, err)
+		}
+	}
+	if ids := stub.routeIDs(); len(ids) != 1 {
+		t.Errorf("routes = %q, want nothing added", ids)
+	}
+}
+
+func TestAdminAdaptRequiresServer(t *testing.T) {
+	stub, server := newStubAdmin(t)
+	stub.adapt["app.example.com {"] = []string{":443"}
+	client := newAdminClient(server.URL, "srv0")
+
+	err := client.applySite(projectRouteIDPrefix+"1", []byte("app.example.com {\n}\n"))
+	if err == nil || !strings.Contains(err.Error(), "CADDY_ADMIN_SERVER") {
+		t.Errorf("applySite = %v, want an error about CADDY_ADMIN_SERVER", err)
+	}
+}
+
+func TestAdminUnavailableFallsBackToFiles(t *testing.T) {
+	_, server := newStubAdmin(t, ":443")
+	server.Close()
+
+	s := NewCaddyService(&config.Config{
+		CaddyConfigPath:  t.TempDir(),
+		CaddyCertsPath:   t.TempDir(),
+		CaddyReloadCmd:   "true",
+		CaddyAdminURL:    server.URL,
+		CaddyAdminServer: "srv0",
+	})
+	project := &models.Project{ID: 1, Name: "app"}
+	name := siteName(project)
+	site := []byte("app.example.com {\n}\n")
+
+	if err := s.apply(project, name, site); err != nil {
+		t.Fatalf("apply = %v, want a fallback to the site file", err)
+	}
+	if data, err := os.ReadFile(s.siteFile(name)); err != nil || string(data) != string(site) {
+		t.Fatalf("site file = %q, %v", data, err)
+	}
+	if _, ok := s.pending[name]; !ok {
+		t.Fatal("site file not pending a reload")
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload = %v, want the reload command run", err)
+	}
+
+	if err := s.RemoveProject(project); err != nil {
+		t.Fatalf("RemoveProject = %v, want a fallback to the site file", err)
+	}
+	if _, err := os.Stat(s.siteFile(name)); !os.IsNotExist(err) {
+		t.Errorf("site file not removed: %v", err)
+	}
+	if _, ok := s.pending[name]; !ok {
+		t.Error("removal not pending a reload")
+	}
+}
+
+func TestAdminAvailableSkipsReloadCommand(t *testing.T) {
+	stub, server := newStubAdmin(t, ":443")
+	stub.adapt["app.example.com {"] = []string{":443"}
+
+	s := NewCaddyService(&config.Config{
+		CaddyConfigPath:  t.TempDir(),
+		CaddyCertsPath:   t.TempDir(),
+		CaddyReloadCmd:   "false",
+		CaddyAdminURL:    server.URL,
+		CaddyAdminServer: "srv0",
+	})
+	project := &models.Project{ID: 1, Name: "app"}
+
+	if err := s.apply(project, siteName(project), []byte("app.example.com {\n}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveProject(project); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(s.configPath); len(files) > 0 {
+		t.Errorf("site files written: %v", files)
+	}
+
+	// Changes are live as soon as the admin API accepts them
+	if err := s.Reload(); err != nil {
+		t.Errorf("Reload = %v, want the reload command skipped", err)
+	}
+}
@@ -1,81 +1,170 @@
 package caddy
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
+	"github.com/vps-panel/backend/internal/config"
 	"github.com/vps-panel/backend/internal/models"
 )
 
+// CaddyService configures the reverse proxy for deployed projects
+//
+// In file mode every project gets a project-<id>.caddy file imported by the main
+// Caddyfile, applied with the reload command. When CADDY_ADMIN_URL is set, the
+// same site blocks are adapted and applied through Caddy's admin API instead,
+// one project route at a time; if the admin API can't be reached the service
+// falls back to file mode.
 type CaddyService struct {
-	configPath string
-	reloadCmd  string
+	configPath  string
+	reloadCmd   string
+	validateCmd string       // run with a staged site file appended; empty skips validation
+	certsPath   string       // uploaded certificates, see tls.go
+	admin       *adminClient // nil in file mode
+
+	// Site files changed since the last reload, see files.go
+	mu      sync.Mutex
+	pending map[string]bool
 }
 
-func NewCaddyService(configPath, reloadCmd string) *CaddyService {
-	return &CaddyService{
-		configPath: configPath,
-		reloadCmd:  reloadCmd,
+func NewCaddyService(cfg *config.Config) *CaddyService {
+	s := &CaddyService{
+		configPath:  cfg.CaddyConfigPath,
+		reloadCmd:   cfg.CaddyReloadCmd,
+		validateCmd: cfg.CaddyValidateCmd,
+		certsPath:   cfg.CaddyCertsPath,
+		pending:     make(map[string]bool),
 	}
+	if cfg.CaddyAdminURL != "" {
+		s.admin = newAdminClient(cfg.CaddyAdminURL, cfg.CaddyAdminServer)
+	}
+	return s
 }
 
 const caddyConfigTemplate = `# {{ .ProjectName }}
-{{ range .Domains }}{{ .Domain }}{{ if ne .Domain (index $.Domains 0).Domain }}, {{ end }}{{ end }} {
+{{- range .Sites }}
+{{ .Addresses }} {
+{{- if .TLS }}
+    # Uploaded certificate
+    tls {{ .TLS.Certificate }} {{ .TLS.Key }}
+{{- end }}
     # Enable compression
     encode gzip zstd
-
-    {{ if .HasCustomAPI }}
-    # Custom API routes
-    handle /api/user/* {
-        reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
-    }
-
-    handle /api/admin/* {
-        reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+{{ range $.Rules }}
+    # {{ if .Redirect }}Redirect{{ else }}Rewrite{{ end }} {{ .Host }}{{ .Path }}
+    @{{ .Name }} {
+        host {{ .Host }}
+        path {{ .Path }}
     }
-    {{ end }}
+    {{ if .Redirect }}redir @{{ .Name }} {{ .To }} {{ .Code }}{{ else }}rewrite @{{ .Name }} {{ .To }}{{ end }}
+{{ end }}
+    # A route keeps its handlers in written order, so access checks run first
+    route {
+{{- range $.Access }}
+        # Access control for {{ .Hosts }}
+{{- if .Deny }}
+        @{{ .Name }}_denied {
+            host {{ .Hosts }}
+            remote_ip {{ .Deny }}
+        }
+        respond @{{ .Name }}_denied "Forbidden" 403
+{{- end }}
+{{- if .Allow }}
+        @{{ .Name }}_not_allowed {
+            host {{ .Hosts }}
+            not remote_ip {{ .Allow }}
+        }
+        respond @{{ .Name }}_not_allowed "Forbidden" 403
+{{- end }}
+{{- if .Users }}
+        @{{ .Name }} host {{ .Hosts }}
+        basic_auth @{{ .Name }} {
+{{- range .Users }}
+            {{ .Username }} {{ .PasswordHash }}
+{{- end }}
+        }
+{{- end }}
+{{ end }}{{ if $.Maintenance }}
+        # Maintenance mode
+{{- if $.Maintenance.Allow }}
+        @maintenance not remote_ip {{ $.Maintenance.Allow }}
+{{- else }}
+        @maintenance path *
+{{- end }}
+        header @maintenance Content-Type "text/html; charset=utf-8"
+        header @maintenance Cache-Control "no-store"
+        header @maintenance Retry-After "{{ $.Maintenance.RetryAfter }}"
+        respond @maintenance <<MAINTENANCE_PAGE
+{{ $.Maintenance.Page }}
+        MAINTENANCE_PAGE 503
+{{ end }}
+        {{ if $.HasCustomAPI }}
+        # Custom API routes
+        handle /api/user/* {
+            reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+        }
 
-    {{ if .HasBackend }}
-    # Backend API routes
-    handle /api/* {
-        reverse_proxy 127.0.0.1:{{ $.BackendPort }}
-    }
+        handle /api/admin/* {
+            reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+        }
+        {{ end }}
 
-    # Backend admin panel
-    handle /_/* {
-        reverse_proxy 127.0.0.1:{{ $.BackendPort }}
-    }
-    {{ end }}
+        {{ if $.HasBackend }}
+        # Backend API routes
+        handle /api/* {
+            reverse_proxy 127.0.0.1:{{ $.BackendPort }}
+        }
 
-    # Frontend
-    reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+        # Backend admin panel
+        handle /_/* {
+            reverse_proxy 127.0.0.1:{{ $.BackendPort }}
+        }
+        {{ end }}
 
+        # Frontend
+        reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+    }
+{{ if $.Headers }}
     # Security headers
     header {
-        Strict-Transport-Security "max-age=31536000; includeSubDomains; preload"
-        X-Frame-Options "DENY"
-        X-Content-Type-Options "nosniff"
-        Referrer-Policy "strict-origin-when-cross-origin"
+{{- range $.Headers }}
+        {{ if .Remove }}-{{ .Name }}{{ else }}{{ .Name }} "{{ .Value }}"{{ end }}
+{{- end }}
     }
-
+{{ end }}
     # Logging
     log {
-        output file /var/log/caddy/{{ $.ProjectName }}.log {
+        output file /var/log/caddy/{{ $.SiteName }}.log {
             roll_size 100MB
             roll_keep 3
         }
         format json
     }
 }
-`
+{{ end }}{{ range .Redirects }}
+{{ .Address }} {
+    redir {{ .Target }}{uri} {{ .Code }}
+}
+{{ end }}`
 
 type CaddyConfig struct {
 	ProjectName  string
-	Domains      []DomainConfig
+	SiteName     string             // site file and log name, see siteName
+	Domains      []DomainConfig     // hosts serving the project
+	Sites        []SiteConfig       // site blocks serving Domains, see tls.go
+	Rules        []RuleConfig       // path redirects and rewrites
+	Redirects    []RedirectConfig   // hosts that only redirect, see routing.go
+	Access       []AccessConfig     // IP lists and basic auth, see access.go
+	Headers      []HeaderConfig     // response headers, see headers.go
+	Maintenance  *MaintenanceConfig // nil unless in maintenance mode, see maintenance.go
 	FrontendPort int
 	BackendPort  int
 	HasBackend   bool
@@ -83,10 +172,15 @@ type CaddyConfig struct {
 }
 
 type DomainConfig struct {
+	ID     uint
 	Domain string
+	SSL    bool
 }
 
-func (s *CaddyService) GenerateConfig(project *models.Project) error {
+var errNoActiveDomains = errors.New("no active domains configured for project")
+
+// ensureDirs creates the site config directory and the directory of the site logs
+func (s *CaddyService) ensureDirs() error {
 	// Ensure config directory exists
 	if err := os.MkdirAll(s.configPath, 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
@@ -98,9 +192,37 @@ func (s *CaddyService) GenerateConfig(project *models.Project) error {
 		return fmt.Errorf("failed to create log directory: %w", err)
 	}
 
+	return nil
+}
+
+// projectSite renders the site block of a project as GenerateConfig or
+// GenerateConfigWithPocketBase would, returning the site name and content
+func (s *CaddyService) projectSite(project *models.Project) (string, []byte, error) {
+	if project.BaaSType == models.BaaSPocketBase {
+		return s.pocketBaseSite(project)
+	}
+	return s.standardSite(project)
+}
+
+func (s *CaddyService) GenerateConfig(project *models.Project) error {
+	if err := s.ensureDirs(); err != nil {
+		return err
+	}
+
+	siteName, site, err := s.standardSite(project)
+	if err != nil {
+		return err
+	}
+
+	return s.apply(project, siteName, site)
+}
+
+// standardSite renders the site block of a project without PocketBase
+func (s *CaddyService) standardSite(project *models.Project) (string, []byte, error) {
 	// Build config data
 	config := CaddyConfig{
 		ProjectName:  sanitizeProjectName(project.Name),
+		SiteName:     siteName(project),
 		FrontendPort: project.FrontendPort,
 		BackendPort:  project.BackendPort,
 		HasBackend:   project.BaaSType != "",
@@ -108,49 +230,94 @@ func (s *CaddyService) GenerateConfig(project *models.Project) error {
 	}
 
 	// Add domains
-	for _, domain := range project.Domains {
-		if domain.IsActive {
-			config.Domains = append(config.Domains, DomainConfig{
-				Domain: domain.Domain,
-			})
-		}
+	config.addDomains(project.SiteDomains())
+	config.addAccess(project.AccessPolicies)
+	config.addHeaders(project, "DENY")
+	config.addSites(project.Certificates, s.certsPath)
+	if err := config.addMaintenance(project, time.Now()); err != nil {
+		return "", nil, err
 	}
 
 	// If no domains, skip
 	if len(config.Domains) == 0 {
-		return fmt.Errorf("no active domains configured for project")
+		return "", nil, errNoActiveDomains
 	}
 
-	// Parse template
-	tmpl, err := template.New("caddy").Parse(caddyConfigTemplate)
+	site, err := renderSite("caddy", caddyConfigTemplate, config)
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
+		return "", nil, err
 	}
 
-	// Write config file
-	configFile := filepath.Join(s.configPath, fmt.Sprintf("%s.caddy", config.ProjectName))
-	file, err := os.Create(configFile)
+	return config.SiteName, site, nil
+}
+
+// renderSite executes a site block template
+func renderSite(name, text string, config CaddyConfig) ([]byte, error) {
+	tmpl, err := template.New(name).Parse(text)
 	if err != nil {
-		return fmt.Errorf("failed to create config file: %w", err)
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, config); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
-	defer file.Close()
+	return buf.Bytes(), nil
+}
 
-	if err := tmpl.Execute(file, config); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+// apply installs a project's site block through the admin API, or as a file
+func (s *CaddyService) apply(project *models.Project, siteName string, site []byte) error {
+	// Sites are validated with the certificate files they reference
+	if err := s.installCertificates(project.Certificates); err != nil {
+		return err
 	}
 
-	return nil
+	if s.admin != nil {
+		err := s.admin.applySite(projectRouteID(project), site)
+		if !errors.Is(err, errAdminUnavailable) {
+			return err
+		}
+		log.Printf("Warning: %v, falling back to config files", err)
+	}
+
+	return s.writeSiteFile(siteName, site)
 }
 
-func (s *CaddyService) RemoveConfig(projectName string) error {
-	configFile := filepath.Join(s.configPath, fmt.Sprintf("%s.caddy", sanitizeProjectName(projectName)))
-	if err := os.Remove(configFile); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove config file: %w", err)
+// RemoveProject removes a project's site, from the admin API and its config file
+// The change takes effect after Reload
+func (s *CaddyService) RemoveProject(project *models.Project) error {
+	name := siteName(project)
+	if s.admin != nil {
+		err := s.admin.removeSite(projectRouteID(project))
+		switch {
+		case errors.Is(err, errAdminUnavailable):
+			log.Printf("Warning: %v, falling back to config files", err)
+		case err != nil:
+			return err
+		default:
+			// Only a file left by an earlier fallback needs removing, otherwise
+			// Reload would run the reload command for nothing
+			if _, err := os.Stat(s.siteFile(name)); os.IsNotExist(err) {
+				return nil
+			}
+		}
 	}
-	return nil
+
+	return s.removeSiteFile(name)
 }
 
+// Reload applies config file changes. If Caddy rejects them, the previous
+// version of every changed site file is restored so the next reload starts
+// from a working config again. In admin API mode changes are already live,
+// so the reload command only runs after a fallback to config files
 func (s *CaddyService) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.admin != nil && len(s.pending) == 0 {
+		return nil
+	}
+
 	// Parse reload command
 	parts := strings.Fields(s.reloadCmd)
 	if len(parts) == 0 {
@@ -160,12 +327,30 @@ func (s *CaddyService) Reload() error {
 	cmd := exec.Command(parts[0], parts[1:]...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to reload Caddy: %w (output: %s)", err, string(output))
+		err = fmt.Errorf("failed to reload Caddy: %w (output: %s)", err, strings.TrimSpace(string(output)))
+		if restored := s.restorePending(); len(restored) > 0 {
+			err = fmt.Errorf("%w; restored previous config for %s", err, strings.Join(restored, ", "))
+		}
+		return err
 	}
 
+	s.pending = make(map[string]bool)
 	return nil
 }
 
+// siteName is the name of a project's site file, or of the site of one of its
+// previews or environments. It's derived from IDs like projectRouteID, since
+// a preview of foo is named foo-pr-1 and a project may be named that too
+func siteName(project *models.Project) string {
+	if project.Preview != nil {
+		return fmt.Sprintf("project-%d-pr-%d", project.ID, project.Preview.Number)
+	}
+	if project.ProjectEnvironment != nil {
+		return fmt.Sprintf("project-%d-env-%d", project.ID, project.ProjectEnvironment.ID)
+	}
+	return fmt.Sprintf("project-%d", project.ID)
+}
+
 func sanitizeProjectName(name string) string {
 	// Replace spaces and special characters with hyphens
 	name = strings.ToLower(name)
@@ -176,19 +361,23 @@ func sanitizeProjectName(name string) string {
 
 // GenerateConfigWithPocketBase generates Caddy config for projects with PocketBase backend
 func (s *CaddyService) GenerateConfigWithPocketBase(project *models.Project) error {
-	// Ensure config directory exists
-	if err := os.MkdirAll(s.configPath, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+	if err := s.ensureDirs(); err != nil {
+		return err
 	}
 
-	// Ensure Caddy log directory exists with proper permissions
-	logDir := "/var/log/caddy"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("failed to create log directory: %w", err)
+	siteName, site, err := s.pocketBaseSite(project)
+	if err != nil {
+		return err
 	}
 
+	return s.apply(project, siteName, site)
+}
+
+// pocketBaseSite renders the site block of a project with a PocketBase backend
+func (s *CaddyService) pocketBaseSite(project *models.Project) (string, []byte, error) {
 	config := CaddyConfig{
 		ProjectName:  sanitizeProjectName(project.Name),
+		SiteName:     siteName(project),
 		FrontendPort: project.FrontendPort,
 		BackendPort:  project.BackendPort,
 		HasBackend:   true,
@@ -196,79 +385,122 @@ func (s *CaddyService) GenerateConfigWithPocketBase(project *models.Project) err
 	}
 
 	// Add domains
-	for _, domain := range project.Domains {
-		if domain.IsActive {
-			config.Domains = append(config.Domains, DomainConfig{
-				Domain: domain.Domain,
-			})
-		}
+	config.addDomains(project.SiteDomains())
+	config.addAccess(project.AccessPolicies)
+	config.addHeaders(project, "SAMEORIGIN")
+	config.addSites(project.Certificates, s.certsPath)
+	if err := config.addMaintenance(project, time.Now()); err != nil {
+		return "", nil, err
 	}
 
 	// If no domains, skip
 	if len(config.Domains) == 0 {
-		return fmt.Errorf("no active domains configured for project")
+		return "", nil, errNoActiveDomains
 	}
 
-	// Enhanced template for PocketBase with proper routing
-	pocketbaseTemplate := `# {{ .ProjectName }} (with PocketBase)
-{{ range .Domains }}{{ .Domain }}{{ if ne .Domain (index $.Domains 0).Domain }}, {{ end }}{{ end }} {
-    # Enable compression
-    encode gzip zstd
+	site, err := renderSite("caddy-pocketbase", pocketbaseConfigTemplate, config)
+	if err != nil {
+		return "", nil, err
+	}
 
-    # PocketBase Admin UI (must come before /api/* to work correctly)
-    handle /_/* {
-        reverse_proxy 127.0.0.1:{{ $.BackendPort }}
-    }
+	return config.SiteName, site, nil
+}
 
-    # PocketBase API routes
-    handle /api/* {
-        reverse_proxy 127.0.0.1:{{ $.BackendPort }}
+// Enhanced template for PocketBase with proper routing
+const pocketbaseConfigTemplate = `# {{ .ProjectName }} (with PocketBase)
+{{- range .Sites }}
+{{ .Addresses }} {
+{{- if .TLS }}
+    # Uploaded certificate
+    tls {{ .TLS.Certificate }} {{ .TLS.Key }}
+{{- end }}
+    # Enable compression
+    encode gzip zstd
+{{ range $.Rules }}
+    # {{ if .Redirect }}Redirect{{ else }}Rewrite{{ end }} {{ .Host }}{{ .Path }}
+    @{{ .Name }} {
+        host {{ .Host }}
+        path {{ .Path }}
     }
+    {{ if .Redirect }}redir @{{ .Name }} {{ .To }} {{ .Code }}{{ else }}rewrite @{{ .Name }} {{ .To }}{{ end }}
+{{ end }}
+    # A route keeps its handlers in written order, so access checks run first
+    route {
+{{- range $.Access }}
+        # Access control for {{ .Hosts }}
+{{- if .Deny }}
+        @{{ .Name }}_denied {
+            host {{ .Hosts }}
+            remote_ip {{ .Deny }}
+        }
+        respond @{{ .Name }}_denied "Forbidden" 403
+{{- end }}
+{{- if .Allow }}
+        @{{ .Name }}_not_allowed {
+            host {{ .Hosts }}
+            not remote_ip {{ .Allow }}
+        }
+        respond @{{ .Name }}_not_allowed "Forbidden" 403
+{{- end }}
+{{- if .Users }}
+        @{{ .Name }} host {{ .Hosts }}
+        basic_auth @{{ .Name }} {
+{{- range .Users }}
+            {{ .Username }} {{ .PasswordHash }}
+{{- end }}
+        }
+{{- end }}
+{{ end }}{{ if $.Maintenance }}
+        # Maintenance mode
+{{- if $.Maintenance.Allow }}
+        @maintenance not remote_ip {{ $.Maintenance.Allow }}
+{{- else }}
+        @maintenance path *
+{{- end }}
+        header @maintenance Content-Type "text/html; charset=utf-8"
+        header @maintenance Cache-Control "no-store"
+        header @maintenance Retry-After "{{ $.Maintenance.RetryAfter }}"
+        respond @maintenance <<MAINTENANCE_PAGE
+{{ $.Maintenance.Page }}
+        MAINTENANCE_PAGE 503
+{{ end }}
+        # PocketBase Admin UI (must come before /api/* to work correctly)
+        handle /_/* {
+            reverse_proxy 127.0.0.1:{{ $.BackendPort }}
+        }
 
-    # PocketBase files and realtime
-    handle /files/* {
-        reverse_proxy 127.0.0.1:{{ $.BackendPort }}
-    }
+        # PocketBase API routes
+        handle /api/* {
+            reverse_proxy 127.0.0.1:{{ $.BackendPort }}
+        }
 
-    # Frontend (all other routes)
-    reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+        # PocketBase files and realtime
+        handle /files/* {
+            reverse_proxy 127.0.0.1:{{ $.BackendPort }}
+        }
 
+        # Frontend (all other routes)
+        reverse_proxy 127.0.0.1:{{ $.FrontendPort }}
+    }
+{{ if $.Headers }}
     # Security headers
     header {
-        Strict-Transport-Security "max-age=31536000; includeSubDomains; preload"
-        X-Frame-Options "SAMEORIGIN"
-        X-Content-Type-Options "nosniff"
-        Referrer-Policy "strict-origin-when-cross-origin"
+{{- range $.Headers }}
+        {{ if .Remove }}-{{ .Name }}{{ else }}{{ .Name }} "{{ .Value }}"{{ end }}
+{{- end }}
     }
-
+{{ end }}
     # Logging
     log {
-        output file /var/log/caddy/{{ $.ProjectName }}.log {
+        output file /var/log/caddy/{{ $.SiteName }}.log {
             roll_size 100MB
             roll_keep 3
         }
         format json
     }
 }
-`
-
-	// Parse template
-	tmpl, err := template.New("caddy-pocketbase").Parse(pocketbaseTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse template: %w", err)
-	}
-
-	// Write config file
-	configFile := filepath.Join(s.configPath, fmt.Sprintf("%s.caddy", config.ProjectName))
-	file, err := os.Create(configFile)
-	if err != nil {
-		return fmt.Errorf("failed to create config file: %w", err)
-	}
-	defer file.Close()
-
-	if err := tmpl.Execute(file, config); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
-	}
-
-	return nil
+{{ end }}{{ range .Redirects }}
+{{ .Address }} {
+    redir {{ .Target }}{uri} {{ .Code }}
 }
+{{ end }}`
@@ -0,0 +1,146 @@
+package caddy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Site files are only picked up by the Caddyfile's `import <dir>/*.caddy`, so
+// staged and previous versions live next to them under other suffixes
+const (
+	stagingSuffix  = ".staging"
+	previousSuffix = ".prev"
+)
+
+func (s *CaddyService) siteFile(siteName string) string {
+	return filepath.Join(s.configPath, fmt.Sprintf("%s.caddy", siteName))
+}
+
+// writeSiteFile writes a site to a staging file, validates it and only then
+// moves it into place, keeping the version Caddy last loaded as <name>.caddy.prev
+func (s *CaddyService) writeSiteFile(siteName string, site []byte) error {
+	configFile := s.siteFile(siteName)
+	staging := configFile + stagingSuffix
+
+	if err := os.WriteFile(staging, site, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	if err := s.validate(staging); err != nil {
+		os.Remove(staging)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.keepPrevious(siteName); err != nil {
+		os.Remove(staging)
+		return err
+	}
+
+	if err := os.Rename(staging, configFile); err != nil {
+		os.Remove(staging)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// removeSiteFile removes a site file, keeping it as the previous version
+func (s *CaddyService) removeSiteFile(siteName string) error {
+	configFile := s.siteFile(siteName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.keepPrevious(siteName); err != nil {
+		return err
+	}
+
+	if err := os.Remove(configFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove config file: %w", err)
+	}
+	return nil
+}
+
+// keepPrevious saves the current site file before its first change since the
+// last reload. Later changes before a reload keep that version, since it's the
+// one Caddy is running. Callers hold s.mu
+func (s *CaddyService) keepPrevious(siteName string) error {
+	if _, ok := s.pending[siteName]; ok {
+		return nil
+	}
+
+	configFile := s.siteFile(siteName)
+	previous := configFile + previousSuffix
+
+	data, err := os.ReadFile(configFile)
+	switch {
+	case err == nil:
+		if err := os.WriteFile(previous, data, 0644); err != nil {
+			return fmt.Errorf("failed to keep previous config file: %w", err)
+		}
+		s.pending[siteName] = true
+	case os.IsNotExist(err):
+		// A new site; a stale previous version must not be restored
+		os.Remove(previous)
+		s.pending[siteName] = false
+	default:
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return nil
+}
+
+// restorePending puts back the previous version of every site changed since
+// the last reload and returns their names. Callers hold s.mu
+func (s *CaddyService) restorePending() []string {
+	var restored []string
+	for siteName, hadPrevious := range s.pending {
+		configFile := s.siteFile(siteName)
+
+		var err error
+		if hadPrevious {
+			err = os.Rename(configFile+previousSuffix, configFile)
+		} else if err = os.Remove(configFile); os.IsNotExist(err) {
+			err = nil
+		}
+
+		if err != nil {
+			log.Printf("Warning: failed to restore Caddy config %s: %v", configFile, err)
+			continue
+		}
+		restored = append(restored, siteName)
+	}
+
+	s.pending = make(map[string]bool)
+	sort.Strings(restored)
+	return restored
+}
+
+// validate runs the validate command against a staged site file
+func (s *CaddyService) validate(path string) error {
+	parts := strings.Fields(s.validateCmd)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	output, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		log.Printf("Warning: skipping Caddy config validation: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid Caddy config: %w (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package caddy
+
+import (
+	"strings"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// HeaderConfig is a response header set on, or removed from, every response of the site
+type HeaderConfig struct {
+	Name   string
+	Value  string // written in double quotes, see validation in the project handler
+	Remove bool
+}
+
+// profileHeaders returns the security headers of a profile in the order they're written
+// frameOptions is the X-Frame-Options value of the default profile, which
+// differs between the standard and the PocketBase template
+func profileHeaders(profile models.HeaderProfile, frameOptions string) []HeaderConfig {
+	switch profile {
+	case models.HeaderProfileStrict:
+		return []HeaderConfig{
+			{Name: "Strict-Transport-Security", Value: "max-age=63072000; includeSubDomains; preload"},
+			{Name: "X-Frame-Options", Value: "DENY"},
+			{Name: "X-Content-Type-Options", Value: "nosniff"},
+			{Name: "Referrer-Policy", Value: "no-referrer"},
+			{Name: "Cross-Origin-Opener-Policy", Value: "same-origin"},
+			{Name: "Permissions-Policy", Value: "camera=(), microphone=(), geolocation=(), payment=(), usb=()"},
+		}
+	case models.HeaderProfileRelaxed:
+		return []HeaderConfig{
+			{Name: "Strict-Transport-Security", Value: "max-age=31536000"},
+			{Name: "X-Frame-Options", Value: "SAMEORIGIN"},
+			{Name: "X-Content-Type-Options", Value: "nosniff"},
+			{Name: "Referrer-Policy", Value: "strict-origin-when-cross-origin"},
+		}
+	case models.HeaderProfileCustom:
+		return nil
+	}
+
+	return []HeaderConfig{
+		{Name: "Strict-Transport-Security", Value: "max-age=31536000; includeSubDomains; preload"},
+		{Name: "X-Frame-Options", Value: frameOptions},
+		{Name: "X-Content-Type-Options", Value: "nosniff"},
+		{Name: "Referrer-Policy", Value: "strict-origin-when-cross-origin"},
+	}
+}
+
+// addHeaders fills in the response headers: the profile's, then the CSP, then
+// the custom headers, each replacing an earlier header of the same name
+func (c *CaddyConfig) addHeaders(project *models.Project, frameOptions string) {
+	c.Headers = profileHeaders(project.HeaderProfile, frameOptions)
+
+	if csp := buildCSP(project.CSPDirectives); csp != "" {
+		name := "Content-Security-Policy"
+		if project.CSPReportOnly {
+			name = "Content-Security-Policy-Report-Only"
+		}
+		c.setHeader(HeaderConfig{Name: name, Value: csp})
+	}
+
+	for _, header := range project.CustomHeaders {
+		c.setHeader(HeaderConfig{
+			Name:   header.Name,
+			Value:  header.Value,
+			Remove: header.Value == "",
+		})
+	}
+}
+
+func (c *CaddyConfig) setHeader(header HeaderConfig) {
+	for i := range c.Headers {
+		if strings.EqualFold(c.Headers[i].Name, header.Name) {
+			c.Headers[i] = header
+			return
+		}
+	}
+	c.Headers = append(c.Headers, header)
+}
+
+// buildCSP joins CSP directives into a header value
+func buildCSP(directives []models.CSPDirective) string {
+	parts := make([]string, 0, len(directives))
+	for _, directive := range directives {
+		parts = append(parts, strings.TrimSpace(directive.Name+" "+strings.Join(directive.Sources, " ")))
+	}
+	return strings.Join(parts, "; ")
+}
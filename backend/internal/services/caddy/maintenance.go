@@ -0,0 +1,194 @@
+package caddy
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// MaintenanceConfig is the page served with a 503 instead of the app
+type MaintenanceConfig struct {
+	Allow      string // space separated IPs/CIDRs that still reach the app
+	RetryAfter string // seconds, or the HTTP date a scheduled window ends
+	Page       string // heredoc body, see heredocBody
+}
+
+const (
+	// MaintenancePageMarker closes the heredoc holding the page, so it can't
+	// appear on a line of its own in a custom page
+	MaintenancePageMarker = "MAINTENANCE_PAGE"
+
+	defaultRetryAfter         = 3600
+	defaultMaintenanceMessage = "We're performing scheduled maintenance and will be back shortly."
+)
+
+var maintenancePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Name }} - Maintenance</title>
+<style>
+body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center; font-family: system-ui, sans-serif; background: #f8fafc; color: #0f172a; }
+main { max-width: 32rem; padding: 2rem; text-align: center; }
+h1 { font-size: 1.5rem; }
+p { color: #475569; line-height: 1.5; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{ .Name }} is down for maintenance</h1>
+<p>{{ .Message }}</p>
+</main>
+</body>
+</html>`))
+
+// addMaintenance fills in the maintenance page if the project is in
+// maintenance mode at now, manually or through a scheduled window
+func (c *CaddyConfig) addMaintenance(project *models.Project, now time.Time) error {
+	active, window := project.InMaintenance(now)
+	if !active {
+		return nil
+	}
+
+	message := project.MaintenanceMessage
+	if window != nil && window.Message != "" {
+		message = window.Message
+	}
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	page := project.MaintenancePage
+	if page == "" {
+		var buf bytes.Buffer
+		if err := maintenancePage.Execute(&buf, map[string]string{"Name": project.Name, "Message": message}); err != nil {
+			return err
+		}
+		page = buf.String()
+	}
+
+	// A window's end is only known to end maintenance if it wasn't also turned on manually
+	retryAfter := strconv.Itoa(defaultRetryAfter)
+	if project.MaintenanceRetryAfter > 0 {
+		retryAfter = strconv.Itoa(project.MaintenanceRetryAfter)
+	}
+	if window != nil && !project.MaintenanceEnabled {
+		retryAfter = window.EndsAt.UTC().Format(http.TimeFormat)
+	}
+
+	c.Maintenance = &MaintenanceConfig{
+		Allow:      strings.Join(project.MaintenanceAllowCIDRs, " "),
+		RetryAfter: retryAfter,
+		Page:       heredocBody(page),
+	}
+	return nil
+}
+
+// heredocBody prepares a page for a heredoc closed by a marker indented like
+// the respond directive: every line gets that indentation, which Caddy strips,
+// and braces are escaped so the page can't use placeholders like {env.*}
+func heredocBody(page string) string {
+	page = strings.ReplaceAll(page, "\r\n", "\n")
+	page = strings.TrimRight(page, "\n")
+	page = strings.NewReplacer("{", `\{`, "}", `\}`).Replace(page)
+
+	lines := strings.Split(page, "\n")
+	for i, line := range lines {
+		lines[i] = "        " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MaintenanceScheduler applies maintenance windows to Caddy when they start and end
+type MaintenanceScheduler struct {
+	db       *gorm.DB
+	caddy    *CaddyService
+	interval time.Duration
+	last     time.Time // boundaries up to here are applied
+}
+
+func NewMaintenanceScheduler(db *gorm.DB, caddyService *CaddyService) *MaintenanceScheduler {
+	return &MaintenanceScheduler{
+		db:       db,
+		caddy:    caddyService,
+		interval: 30 * time.Second,
+	}
+}
+
+// Start checks for windows starting or ending on every interval in the background
+// Boundaries passed while the panel was down are applied by the reconciler at startup
+func (m *MaintenanceScheduler) Start() {
+	m.last = time.Now()
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			m.run(now)
+		}
+	}()
+}
+
+func (m *MaintenanceScheduler) run(now time.Time) {
+	var projectIDs []uint
+	if err := m.db.Model(&models.MaintenanceWindow{}).
+		Where("(starts_at > ? AND starts_at <= ?) OR (ends_at > ? AND ends_at <= ?)", m.last, now, m.last, now).
+		Distinct().
+		Pluck("project_id", &projectIDs).Error; err != nil {
+		log.Printf("Warning: failed to load maintenance windows: %v", err)
+		return
+	}
+	m.last = now
+
+	if len(projectIDs) == 0 {
+		return
+	}
+	if err := m.caddy.ensureDirs(); err != nil {
+		log.Printf("Warning: maintenance window: %v", err)
+		return
+	}
+
+	changed := false
+	for _, id := range projectIDs {
+		var project models.Project
+		if err := m.db.Preload("Domains").Preload("AccessPolicies.Users").Preload("Certificates").
+			Preload("MaintenanceWindows", "ends_at > ?", now).
+			First(&project, id).Error; err != nil || project.FrontendPort == 0 {
+			continue
+		}
+
+		name, site, err := m.caddy.projectSite(&project)
+		if err == errNoActiveDomains {
+			continue
+		}
+		if err == nil {
+			err = m.caddy.apply(&project, name, site)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to apply maintenance window of project %d: %v", project.ID, err)
+			continue
+		}
+
+		if active, _ := project.InMaintenance(now); active {
+			log.Printf("✓ Scheduled maintenance of project %d started", project.ID)
+		} else {
+			log.Printf("✓ Scheduled maintenance of project %d ended", project.ID)
+		}
+		changed = true
+	}
+
+	if changed {
+		if err := m.caddy.Reload(); err != nil {
+			log.Printf("Warning: failed to reload Caddy: %v", err)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package caddy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// Reconciler keeps the Caddy sites in line with the projects and domains in the database
+//
+// Site configs of deleted projects are removed, configs that differ
+// from what the templates generate are rewritten, and missing ones are created.
+// Projects with a deployment in progress are left alone, since their ports may
+// point at a container that isn't live yet.
+type Reconciler struct {
+	db       *gorm.DB
+	caddy    *CaddyService
+	interval time.Duration
+
+	mu sync.Mutex // one run at a time
+}
+
+// ReconcileReport lists what a reconcile run changed, or would change in a dry run
+type ReconcileReport struct {
+	DryRun   bool     `json:"dry_run"`
+	Orphaned []string `json:"orphaned"` // sites without a project, removed
+	Drifted  []string `json:"drifted"`  // sites that differ from the generated config, rewritten
+	Missing  []string `json:"missing"`  // projects without a site, created
+	Skipped  []string `json:"skipped"`  // projects with a deployment in progress
+	Errors   []string `json:"errors"`
+}
+
+// Changed reports whether the run found anything to fix
+func (r *ReconcileReport) Changed() bool {
+	return len(r.Orphaned) > 0 || len(r.Drifted) > 0 || len(r.Missing) > 0
+}
+
+func NewReconciler(db *gorm.DB, cfg *config.Config, caddyService *CaddyService) *Reconciler {
+	return &Reconciler{
+		db:       db,
+		caddy:    caddyService,
+		interval: time.Duration(cfg.CaddyReconcileInterval) * time.Second,
+	}
+}
+
+// Start reconciles once and then on every interval (if set) in the background
+func (r *Reconciler) Start() {
+	go func() {
+		r.runAndLog()
+		if r.interval <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.runAndLog()
+		}
+	}()
+}
+
+func (r *Reconciler) runAndLog() {
+	report, err := r.Run(false)
+	if err != nil {
+		log.Printf("Warning: Caddy reconcile failed: %v", err)
+		return
+	}
+
+	if report.Changed() {
+		log.Printf("✓ Caddy reconciled: %d orphaned, %d drifted, %d missing site(s)",
+			len(report.Orphaned), len(report.Drifted), len(report.Missing))
+	}
+	for _, e := range report.Errors {
+		log.Printf("Warning: Caddy reconcile: %s", e)
+	}
+}
+
+// desiredSite is the generated config of one project
+type desiredSite struct {
+	project *models.Project
+	name    string
+	content []byte
+}
+
+// Run compares the generated sites with the live ones and, unless dryRun is
+// set, fixes the differences
+func (r *Reconciler) Run(dryRun bool) (*ReconcileReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &ReconcileReport{
+		DryRun:   dryRun,
+		Orphaned: []string{},
+		Drifted:  []string{},
+		Missing:  []string{},
+		Skipped:  []string{},
+		Errors:   []string{},
+	}
+
+	desired, keep, err := r.desiredSites(report)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.caddy.admin != nil {
+		err = r.reconcileRoutes(desired, keep, report)
+	} else {
+		err = r.reconcileFiles(desired, keep, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// desiredSites generates the site of every project that should be served
+// keep holds the sites of skipped projects, which must not be treated as orphans
+func (r *Reconciler) desiredSites(report *ReconcileReport) ([]desiredSite, map[string]bool, error) {
+	var projects []models.Project
+	if err := r.db.Preload("Domains").Preload("AccessPolicies.Users").Preload("Certificates").
+		Preload("MaintenanceWindows", "ends_at > ?", time.Now()).Order("id ASC").Find(&projects).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load projects: %w", err)
+	}
+
+	var busy []uint
+	if err := r.db.Model(&models.Deployment{}).
+		Where("status IN ?", []models.DeploymentStatus{models.DeploymentBuilding, models.DeploymentDeploying}).
+		Distinct().
+		Pluck("project_id", &busy).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load active deployments: %w", err)
+	}
+	inProgress := make(map[uint]bool, len(busy))
+	for _, id := range busy {
+		inProgress[id] = true
+	}
+
+	// Open previews are served as sites of their own
+	var previews []models.Preview
+	if err := r.db.Where("status <> ?", models.PreviewClosed).Order("id ASC").Find(&previews).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load previews: %w", err)
+	}
+
+	// So are environments, once deployed
+	var environments []models.ProjectEnvironment
+	if err := r.db.Where("frontend_port <> 0").Order("id ASC").Find(&environments).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load environments: %w", err)
+	}
+
+	sites := make([]*models.Project, 0, len(projects)+len(previews)+len(environments))
+	byID := make(map[uint]*models.Project, len(projects))
+	for i := range projects {
+		sites = append(sites, &projects[i])
+		byID[projects[i].ID] = &projects[i]
+	}
+	for i := range previews {
+		if project, ok := byID[previews[i].ProjectID]; ok && previews[i].FrontendPort != 0 {
+			preview := project.ForPreview(&previews[i])
+			sites = append(sites, &preview)
+		}
+	}
+	for i := range environments {
+		if project, ok := byID[environments[i].ProjectID]; ok {
+			environment := project.ForEnvironment(&environments[i])
+			sites = append(sites, &environment)
+		}
+	}
+
+	var desired []desiredSite
+	keep := make(map[string]bool)
+
+	for _, project := range sites {
+		if project.FrontendPort == 0 {
+			continue
+		}
+
+		name, content, err := r.caddy.projectSite(project)
+		if err == errNoActiveDomains {
+			continue
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("project %d: %v", project.ID, err))
+			continue
+		}
+
+		if inProgress[project.ID] {
+			report.Skipped = append(report.Skipped, name)
+			keep[name] = true
+			keep[projectRouteID(project)] = true
+			continue
+		}
+
+		desired = append(desired, desiredSite{project: project, name: name, content: content})
+	}
+
+	return desired, keep, nil
+}
+
+// reconcileFiles compares the site files in the config directory
+func (r *Reconciler) reconcileFiles(desired []desiredSite, keep map[string]bool, report *ReconcileReport) error {
+	files, err := filepath.Glob(filepath.Join(r.caddy.configPath, "*.caddy"))
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, site := range desired {
+		wanted[site.name] = true
+	}
+
+	changed := false
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".caddy")
+		if wanted[name] || keep[name] {
+			continue
+		}
+
+		report.Orphaned = append(report.Orphaned, name)
+		if report.DryRun {
+			continue
+		}
+		if err := r.caddy.removeSiteFile(name); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", name, err))
+			continue
+		}
+		changed = true
+	}
+
+	if !report.DryRun && len(desired) > 0 {
+		if err := r.caddy.ensureDirs(); err != nil {
+			return err
+		}
+	}
+
+	for _, site := range desired {
+		// Sites are validated with the certificate files they reference
+		if !report.DryRun {
+			if err := r.installCertificates(site, nil); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+				continue
+			}
+		}
+
+		current, err := os.ReadFile(r.caddy.siteFile(site.name))
+		switch {
+		case os.IsNotExist(err):
+			report.Missing = append(report.Missing, site.name)
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+			continue
+		case bytes.Equal(current, site.content):
+			continue
+		default:
+			report.Drifted = append(report.Drifted, site.name)
+		}
+
+		if report.DryRun {
+			continue
+		}
+		if err := r.caddy.writeSiteFile(site.name, site.content); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+			continue
+		}
+		changed = true
+	}
+
+	if changed {
+		if err := r.caddy.Reload(); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	sortReport(report)
+	return nil
+}
+
+// reconcileRoutes compares the project routes in the running Caddy config
+func (r *Reconciler) reconcileRoutes(desired []desiredSite, keep map[string]bool, report *ReconcileReport) error {
+	admin := r.caddy.admin
+
+	ids, err := admin.routeIDs(projectRouteIDPrefix)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, site := range desired {
+		wanted[projectRouteID(site.project)] = true
+	}
+
+	for _, id := range ids {
+		if wanted[id] || keep[id] {
+			continue
+		}
+
+		report.Orphaned = append(report.Orphaned, id)
+		if report.DryRun {
+			continue
+		}
+		if err := admin.removeSite(id); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("route %s: %v", id, err))
+		}
+	}
+
+	for _, site := range desired {
+		id := projectRouteID(site.project)
+
+		route, certificates, err := admin.buildRoute(id, site.content)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+			continue
+		}
+
+		// Routes don't show which certificates are loaded, so those are synced every run
+		if !report.DryRun {
+			if err := r.installCertificates(site, certificates); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+				continue
+			}
+		}
+
+		current, err := admin.getRoute(id)
+		switch {
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+			continue
+		case current == nil:
+			report.Missing = append(report.Missing, site.name)
+		case jsonEqual(current, route):
+			continue
+		default:
+			report.Drifted = append(report.Drifted, site.name)
+		}
+
+		if report.DryRun {
+			continue
+		}
+		if err := admin.applyRoute(id, route); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("site %s: %v", site.name, err))
+		}
+	}
+
+	sortReport(report)
+	return nil
+}
+
+// installCertificates writes the uploaded certificates of a site's project and,
+// in admin API mode, loads the files the site references
+func (r *Reconciler) installCertificates(site desiredSite, files []json.RawMessage) error {
+	if err := r.caddy.installCertificates(site.project.Certificates); err != nil {
+		return err
+	}
+	if r.caddy.admin == nil {
+		return nil
+	}
+	return r.caddy.admin.loadCertificates(files)
+}
+
+// jsonEqual compares two JSON documents regardless of formatting and key order
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func sortReport(report *ReconcileReport) {
+	sort.Strings(report.Orphaned)
+	sort.Strings(report.Drifted)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Skipped)
+}
@@ -0,0 +1,213 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/testutil"
+)
+
+// newTestDB opens an in-memory database with the tables the reconciler reads
+func newTestDB(t *testing.T) *gorm.DB {
+	return testutil.OpenDB(t,
+		&models.Project{},
+		&models.Deployment{},
+		&models.Domain{},
+		&models.AccessPolicy{},
+		&models.AccessUser{},
+		&models.Certificate{},
+		&models.MaintenanceWindow{},
+		&models.Preview{},
+		&models.ProjectEnvironment{},
+	)
+}
+
+// createProject adds a deployed project serving domain
+func createProject(t *testing.T, db *gorm.DB, name, domain string, port int) *models.Project {
+	t.Helper()
+
+	project := &models.Project{
+		Name:         name,
+		UserID:       1,
+		GitURL:       "https://example.com/" + name + ".git",
+		FrontendPort: port,
+		Domains: []models.Domain{{
+			Domain:             domain,
+			IsActive:           true,
+			VerificationStatus: models.DomainVerified,
+		}},
+	}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+func newTestReconciler(t *testing.T, db *gorm.DB) (*Reconciler, *CaddyService) {
+	t.Helper()
+
+	s := NewCaddyService(&config.Config{
+		CaddyConfigPath: t.TempDir(),
+		CaddyReloadCmd:  "true",
+	})
+	return NewReconciler(db, &config.Config{}, s), s
+}
+
+func TestReconcileFilesDetectsOrphanedDriftedAndMissingSites(t *testing.T) {
+	db := newTestDB(t)
+	r, s := newTestReconciler(t, db)
+
+	inSync := createProject(t, db, "in-sync", "in-sync.example.com", 3001)
+	drifted := createProject(t, db, "drifted", "drifted.example.com", 3002)
+	missing := createProject(t, db, "missing", "missing.example.com", 3003)
+
+	inSyncName := siteName(inSync)
+	driftedName := siteName(drifted)
+	missingName := siteName(missing)
+
+	var project models.Project
+	db.Preload("Domains").First(&project, inSync.ID)
+	_, content, err := s.projectSite(&project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		inSyncName:  string(content),
+		driftedName: "drifted.example.com {\n    respond \"edited by hand\"\n}\n",
+		"deleted":   "deleted.example.com {\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(s.siteFile(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := r.Run(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"deleted"}; !reflect.DeepEqual(report.Orphaned, want) {
+		t.Errorf("orphaned = %v, want %v", report.Orphaned, want)
+	}
+	if want := []string{driftedName}; !reflect.DeepEqual(report.Drifted, want) {
+		t.Errorf("drifted = %v, want %v", report.Drifted, want)
+	}
+	if want := []string{missingName}; !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("missing = %v, want %v", report.Missing, want)
+	}
+	if len(report.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", report.Errors)
+	}
+
+	// A dry run only reports
+	for name, content := range files {
+		data, err := os.ReadFile(s.siteFile(name))
+		if err != nil || string(data) != content {
+			t.Errorf("dry run changed site %s", name)
+		}
+	}
+	if _, err := os.Stat(s.siteFile(missingName)); !os.IsNotExist(err) {
+		t.Errorf("dry run created site %s", missingName)
+	}
+}
+
+func TestReconcileFilesSkipsProjectsWithDeploymentInProgress(t *testing.T) {
+	db := newTestDB(t)
+	r, s := newTestReconciler(t, db)
+
+	busy := createProject(t, db, "busy", "busy.example.com", 3001)
+	if err := db.Create(&models.Deployment{ProjectID: busy.ID, Status: models.DeploymentBuilding}).Error; err != nil {
+		t.Fatal(err)
+	}
+	name := siteName(busy)
+
+	// The live site still points at the old container and must not be touched
+	if err := os.WriteFile(s.siteFile(name), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := r.Run(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{name}; !reflect.DeepEqual(report.Skipped, want) {
+		t.Errorf("skipped = %v, want %v", report.Skipped, want)
+	}
+	if len(report.Orphaned) > 0 || len(report.Drifted) > 0 || len(report.Missing) > 0 {
+		t.Errorf("busy project reported as changed: %+v", report)
+	}
+}
+
+func TestReconcileFilesIgnoresOtherFiles(t *testing.T) {
+	db := newTestDB(t)
+	r, s := newTestReconciler(t, db)
+
+	// Staged and previous versions aren't imported by Caddy, so they aren't orphans
+	for _, name := range []string{"site.caddy" + stagingSuffix, "site.caddy" + previousSuffix, "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(s.configPath, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := r.Run(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed() {
+		t.Errorf("report = %+v, want no changes", report)
+	}
+}
+
+func TestReconcileFilesKeepsPreviewsAndEnvironmentsApartFromProjects(t *testing.T) {
+	db := newTestDB(t)
+	r, _ := newTestReconciler(t, db)
+
+	// A preview and an environment of foo, next to projects named like them
+	foo := createProject(t, db, "foo", "foo.example.com", 3001)
+	prProject := createProject(t, db, "foo-pr-1", "pr-project.example.com", 3002)
+	stagingProject := createProject(t, db, "foo-staging", "staging-project.example.com", 3003)
+
+	preview := &models.Preview{ProjectID: foo.ID, Number: 1, Status: models.PreviewActive, FrontendPort: 3004}
+	if err := db.Create(preview).Error; err != nil {
+		t.Fatal(err)
+	}
+	environment := &models.ProjectEnvironment{ProjectID: foo.ID, Name: "staging", GitBranch: "staging", FrontendPort: 3005}
+	if err := db.Create(environment).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, domain := range []models.Domain{
+		{ProjectID: foo.ID, PreviewID: &preview.ID, Domain: "pr-1.foo.example.com"},
+		{ProjectID: foo.ID, ProjectEnvironmentID: &environment.ID, Domain: "staging.foo.example.com"},
+	} {
+		domain.IsActive = true
+		domain.VerificationStatus = models.DomainVerified
+		if err := db.Create(&domain).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := r.Run(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fooPreview := foo.ForPreview(preview)
+	fooStaging := foo.ForEnvironment(environment)
+	want := []string{siteName(foo), siteName(&fooPreview), siteName(&fooStaging), siteName(prProject), siteName(stagingProject)}
+	sort.Strings(want)
+	if !reflect.DeepEqual(report.Missing, want) {
+		t.Errorf("missing = %v, want %v", report.Missing, want)
+	}
+	if len(report.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", report.Errors)
+	}
+}
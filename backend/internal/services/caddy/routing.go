@@ -0,0 +1,161 @@
+package caddy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// RuleConfig is a path redirect or rewrite on one host of the site
+type RuleConfig struct {
+	Name     string // matcher name
+	Host     string
+	Path     string
+	To       string
+	Redirect bool
+	Code     int
+}
+
+// RedirectConfig is a site block that only redirects to another host
+type RedirectConfig struct {
+	Address string
+	Target  string // scheme and host; the request URI is appended
+	Code    int
+}
+
+// addDomains fills in the hosts served by the site, their rules, and the
+// redirect-only sites (redirect-to-primary and www/apex canonicalization)
+// Inactive and unverified domains are left out; addSites groups the hosts into site blocks
+func (c *CaddyConfig) addDomains(domains []models.Domain) {
+	var active []models.Domain
+	for _, domain := range domains {
+		if domain.IsActive && domain.Verified() {
+			active = append(active, domain)
+		}
+	}
+
+	// Redirects go to the primary domain, or the first active one that serves the site
+	var primary *models.Domain
+	for i := range active {
+		if active[i].RedirectToPrimary {
+			continue
+		}
+		if primary == nil || (active[i].IsPrimary && !primary.IsPrimary) {
+			primary = &active[i]
+		}
+	}
+	if primary == nil {
+		return
+	}
+
+	// Hosts configured as domains of their own aren't added again as counterparts
+	configured := make(map[string]bool, len(active))
+	for _, domain := range active {
+		configured[strings.ToLower(domain.Domain)] = true
+	}
+
+	for _, domain := range active {
+		host, alias := canonicalHosts(domain)
+		if alias != strings.ToLower(domain.Domain) && configured[alias] {
+			alias = ""
+		}
+
+		if domain.RedirectToPrimary {
+			// Both the domain and its www/apex counterpart redirect
+			target := siteURL(primary.SSLEnabled, ServedHost(*primary))
+			for _, h := range []string{host, alias} {
+				if h == "" || (h != strings.ToLower(domain.Domain) && configured[h]) {
+					continue
+				}
+				c.Redirects = append(c.Redirects, RedirectConfig{
+					Address: siteAddress(domain.SSLEnabled, h),
+					Target:  target,
+					Code:    redirectCode(domain.RedirectCode),
+				})
+			}
+			continue
+		}
+
+		c.Domains = append(c.Domains, DomainConfig{ID: domain.ID, Domain: host, SSL: domain.SSLEnabled})
+
+		if alias != "" {
+			c.Redirects = append(c.Redirects, RedirectConfig{
+				Address: siteAddress(domain.SSLEnabled, alias),
+				Target:  siteURL(domain.SSLEnabled, host),
+				Code:    redirectCode(domain.RedirectCode),
+			})
+		}
+
+		for _, rule := range domain.Rules {
+			code := 0
+			if rule.Type == models.DomainRuleRedirect {
+				code = rule.Code
+				if code == 0 {
+					code = 302
+				}
+			}
+			c.Rules = append(c.Rules, RuleConfig{
+				Name:     fmt.Sprintf("rule%d", len(c.Rules)+1),
+				Host:     host,
+				Path:     rule.Path,
+				To:       rule.To,
+				Redirect: rule.Type == models.DomainRuleRedirect,
+				Code:     code,
+			})
+		}
+	}
+}
+
+// canonicalHosts returns the host a domain is served on and, with www/apex
+// canonicalization, the other host that redirects to it
+func canonicalHosts(domain models.Domain) (host, alias string) {
+	name := strings.ToLower(domain.Domain)
+	apex := strings.TrimPrefix(name, "www.")
+
+	switch domain.Canonical {
+	case models.CanonicalWWW:
+		return "www." + apex, apex
+	case models.CanonicalApex:
+		return apex, "www." + apex
+	}
+	return name, ""
+}
+
+// ServedHost returns the host a domain's site is served on, after www/apex canonicalization
+func ServedHost(domain models.Domain) string {
+	host, _ := canonicalHosts(domain)
+	return host
+}
+
+// ServedHosts returns every host Caddy serves for a domain: the host its site
+// is served on and, with www/apex canonicalization, the one redirecting to it
+func ServedHosts(domain models.Domain) []string {
+	host, alias := canonicalHosts(domain)
+	if alias == "" {
+		return []string{host}
+	}
+	return []string{host, alias}
+}
+
+// siteAddress is the Caddyfile address of a host; without SSL it's served over plain HTTP only
+func siteAddress(ssl bool, host string) string {
+	if ssl {
+		return host
+	}
+	return "http://" + host
+}
+
+func siteURL(ssl bool, host string) string {
+	if ssl {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+func redirectCode(code int) int {
+	if code == 0 {
+		return 301
+	}
+	return code
+}
@@ -0,0 +1,137 @@
+package caddy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// SiteConfig is a site block serving some of the project's hosts
+// A tls directive applies to every address of its block, so hosts served with
+// an uploaded certificate get a block per certificate with the same content
+type SiteConfig struct {
+	Addresses string     // comma separated
+	TLS       *TLSConfig // nil lets Caddy obtain certificates automatically
+}
+
+// TLSConfig is an uploaded certificate, loaded from the files installCertificates writes
+type TLSConfig struct {
+	Certificate string
+	Key         string
+}
+
+// addSites groups the served hosts into site blocks by the certificate they use
+// Must run after addDomains. Hosts without SSL never use an uploaded certificate.
+func (c *CaddyConfig) addSites(certificates []models.Certificate, certsDir string) {
+	var auto []string
+	var order []uint
+	hosts := make(map[uint][]string)
+
+	for _, domain := range c.Domains {
+		address := siteAddress(domain.SSL, domain.Domain)
+
+		var certificate *models.Certificate
+		if domain.SSL {
+			certificate = models.CertificateFor(certificates, domain.ID, domain.Domain)
+		}
+		if certificate == nil {
+			auto = append(auto, address)
+			continue
+		}
+
+		if _, ok := hosts[certificate.ID]; !ok {
+			order = append(order, certificate.ID)
+		}
+		hosts[certificate.ID] = append(hosts[certificate.ID], address)
+	}
+
+	if len(auto) > 0 {
+		c.Sites = append(c.Sites, SiteConfig{Addresses: strings.Join(auto, ", ")})
+	}
+	for _, id := range order {
+		certFile, keyFile := certificateFiles(certsDir, id)
+		c.Sites = append(c.Sites, SiteConfig{
+			Addresses: strings.Join(hosts[id], ", "),
+			TLS:       &TLSConfig{Certificate: certFile, Key: keyFile},
+		})
+	}
+}
+
+// certificateFiles returns where an uploaded certificate and its key are written
+func certificateFiles(certsDir string, certificateID uint) (certFile, keyFile string) {
+	base := filepath.Join(certsDir, fmt.Sprintf("cert-%d", certificateID))
+	return base + ".crt", base + ".key"
+}
+
+// installCertificates writes a project's uploaded certificates where Caddy
+// loads them from. Keys are only readable by the owner and group, so the
+// directory should belong to Caddy's group (with the setgid bit set)
+func (s *CaddyService) installCertificates(certificates []models.Certificate) error {
+	if len(certificates) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.certsPath, 0750); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	for _, certificate := range certificates {
+		certFile, keyFile := certificateFiles(s.certsPath, certificate.ID)
+		if err := writeIfChanged(certFile, []byte(certificate.CertificatePEM), 0644); err != nil {
+			return fmt.Errorf("failed to write certificate %d: %w", certificate.ID, err)
+		}
+		if err := writeIfChanged(keyFile, []byte(certificate.PrivateKeyPEM), 0640); err != nil {
+			return fmt.Errorf("failed to write key of certificate %d: %w", certificate.ID, err)
+		}
+	}
+	return nil
+}
+
+// RemoveCertificate unloads a deleted certificate from Caddy and removes its files
+// Call it once no site uses the certificate anymore
+func (s *CaddyService) RemoveCertificate(certificateID uint) error {
+	certFile, keyFile := certificateFiles(s.certsPath, certificateID)
+
+	if s.admin != nil {
+		err := s.admin.unloadCertificate(certFile)
+		if errors.Is(err, errAdminUnavailable) {
+			log.Printf("Warning: %v, only removing the certificate files", err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove certificate file: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeIfChanged replaces a file through a temporary one, unless it already holds content
+func writeIfChanged(path string, content []byte, perm os.FileMode) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, content) {
+		return nil
+	}
+
+	tmp := path + stagingSuffix
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
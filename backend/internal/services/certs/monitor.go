@@ -0,0 +1,361 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/caddy"
+	"github.com/vps-panel/backend/internal/services/dnscheck"
+	"github.com/vps-panel/backend/internal/services/websocket"
+)
+
+// Dialer opens TLS connections to the served domains; *tls.Dialer by default,
+// tests can swap in their own. Connections must be *tls.Conn.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+const (
+	dialTimeout = 10 * time.Second
+
+	// After a deployment, Caddy usually obtains a certificate within seconds,
+	// but the ACME challenge can take longer with a rate-limited or slow CA
+	watchInterval = 5 * time.Second
+	watchTimeout  = 3 * time.Minute
+)
+
+// Monitor records the certificate each served HTTPS domain presents
+//
+// Certificates are checked by connecting to the domain like a browser would,
+// which covers whatever Caddy serves regardless of file or admin API mode
+// (Caddy's admin API doesn't expose the state of managed certificates).
+// After a deployment the new domains are watched in the background until the
+// certificate is issued; all served domains are then rechecked periodically,
+// and owners are alerted through the websocket before a certificate expires.
+type Monitor struct {
+	db         *gorm.DB
+	wsHub      *websocket.Hub
+	dns        *dnscheck.Verifier
+	dialer     Dialer
+	interval   time.Duration
+	warnBefore time.Duration
+
+	// How often and how long Watch polls for a new certificate
+	watchInterval time.Duration
+	watchTimeout  time.Duration
+
+	mu       sync.Mutex
+	watching map[uint]bool // domains watched after a deployment, skipped by periodic checks
+}
+
+// NewMonitor creates a monitor that connects with a certificate-verifying TLS dialer
+func NewMonitor(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub) *Monitor {
+	return NewMonitorWithDialer(db, cfg, wsHub, &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: dialTimeout},
+		Config:    &tls.Config{},
+	})
+}
+
+// NewMonitorWithDialer creates a monitor that connects through dialer
+func NewMonitorWithDialer(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub, dialer Dialer) *Monitor {
+	return &Monitor{
+		db:         db,
+		wsHub:      wsHub,
+		dns:        dnscheck.NewVerifier(cfg),
+		dialer:     dialer,
+		interval:   time.Duration(cfg.CertCheckInterval) * time.Second,
+		warnBefore: time.Duration(cfg.CertExpiryWarningDays) * 24 * time.Hour,
+
+		watchInterval: watchInterval,
+		watchTimeout:  watchTimeout,
+
+		watching: make(map[uint]bool),
+	}
+}
+
+// Start checks every served certificate on each interval in the background
+func (m *Monitor) Start() {
+	if m.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			m.checkAll()
+		}
+	}()
+}
+
+// Watch polls the certificates of a project's served HTTPS domains in the
+// background until they are issued or the watch times out, reporting the
+// outcome through report (the deployment's build log)
+func (m *Monitor) Watch(domains []models.Domain, report func(message, level string)) {
+	for _, domain := range domains {
+		if !monitored(&domain) || !m.startWatching(domain.ID) {
+			continue
+		}
+
+		domain := domain
+		go func() {
+			defer m.stopWatching(domain.ID)
+			m.watch(&domain, report)
+		}()
+	}
+}
+
+func (m *Monitor) watch(domain *models.Domain, report func(message, level string)) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.watchTimeout)
+	defer cancel()
+
+	// Uploaded certificates are served as soon as the site is configured
+	if cert, ok := m.uploaded(domain); ok {
+		err := expired(cert)
+		m.record(domain, cert, err)
+		if err != nil {
+			report(fmt.Sprintf("Uploaded SSL certificate for %s: %v", domain.Domain, err), "warning")
+			return
+		}
+		report(fmt.Sprintf("✓ Serving the uploaded SSL certificate for %s, valid until %s",
+			domain.Domain, cert.NotAfter.Format("2006-01-02")), "info")
+		return
+	}
+
+	// Caddy can only obtain a certificate once the domain points at this server
+	if result := m.dns.CheckDNS(ctx, domain.Domain); !result.DNSReady {
+		m.record(domain, nil, fmt.Errorf("DNS not ready: %s", result.Error()))
+		report(fmt.Sprintf("DNS of %s is not ready (%s); the SSL certificate will be issued once it points at this server", domain.Domain, result.Error()), "warning")
+		return
+	}
+
+	m.setStatus(domain, models.CertificatePending)
+	report(fmt.Sprintf("Waiting for the SSL certificate of %s in the background...", domain.Domain), "info")
+
+	var lastErr error
+	for {
+		cert, err := m.probe(ctx, domain.Domain)
+		if err == nil {
+			m.record(domain, cert, nil)
+			report(fmt.Sprintf("✓ SSL certificate for %s issued by %s, valid until %s",
+				domain.Domain, issuerName(cert), cert.NotAfter.Format("2006-01-02")), "info")
+			report(fmt.Sprintf("Your app is now live at: https://%s", domain.Domain), "info")
+			return
+		}
+		lastErr = err
+
+		select {
+		case <-time.After(m.watchInterval):
+		case <-ctx.Done():
+			m.record(domain, nil, lastErr)
+			report(fmt.Sprintf("SSL certificate for %s was not issued within %s: %v", domain.Domain, m.watchTimeout, lastErr), "warning")
+			return
+		}
+	}
+}
+
+// Check probes a domain's certificate now and records the result
+// Uploaded certificates are read from the database instead, since probing
+// would report certificates of an internal CA as untrusted
+func (m *Monitor) Check(ctx context.Context, domain *models.Domain) {
+	if cert, ok := m.uploaded(domain); ok {
+		m.record(domain, cert, expired(cert))
+		return
+	}
+
+	cert, err := m.probe(ctx, domain.Domain)
+	m.record(domain, cert, err)
+}
+
+// CheckProject rechecks the served HTTPS domains of a project in the
+// background, e.g. after its uploaded certificates changed
+func (m *Monitor) CheckProject(projectID uint) {
+	go m.checkDomains(m.db.Where("domains.project_id = ?", projectID))
+}
+
+// checkAll rechecks every served HTTPS domain of a live project
+func (m *Monitor) checkAll() {
+	m.checkDomains(m.db)
+}
+
+// checkDomains rechecks the served HTTPS domains of live projects matching query
+func (m *Monitor) checkDomains(query *gorm.DB) {
+	var domains []models.Domain
+	if err := query.Joins("JOIN projects ON projects.id = domains.project_id AND projects.deleted_at IS NULL").
+		Where("projects.status = ? AND domains.is_active = ? AND domains.ssl_enabled = ? AND domains.verification_status = ?",
+			"active", true, true, models.DomainVerified).
+		Find(&domains).Error; err != nil {
+		log.Printf("Warning: certificate check failed to load domains: %v", err)
+		return
+	}
+
+	for i := range domains {
+		domain := &domains[i]
+		if !monitored(domain) || !m.startWatching(domain.ID) {
+			continue
+		}
+		m.Check(context.Background(), domain)
+		m.stopWatching(domain.ID)
+	}
+}
+
+// probe connects to a domain and returns the certificate it presents
+// Untrusted, expired and mismatched certificates fail the TLS handshake
+func (m *Monitor) probe(ctx context.Context, host string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	conn, err := m.dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, "443"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, errors.New("not a TLS connection")
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+	return certs[0], nil
+}
+
+// uploaded returns the uploaded certificate Caddy serves for a domain, if any
+func (m *Monitor) uploaded(domain *models.Domain) (*x509.Certificate, bool) {
+	var certificates []models.Certificate
+	if err := m.db.Where("project_id = ?", domain.ProjectID).Order("id ASC").Find(&certificates).Error; err != nil || len(certificates) == 0 {
+		return nil, false
+	}
+
+	certificate := models.CertificateFor(certificates, domain.ID, caddy.ServedHost(*domain))
+	if certificate == nil {
+		return nil, false
+	}
+	cert, err := certificate.Leaf()
+	if err != nil {
+		log.Printf("Warning: failed to parse uploaded certificate %d: %v", certificate.ID, err)
+		return nil, false
+	}
+	return cert, true
+}
+
+func expired(cert *x509.Certificate) error {
+	if time.Now().After(cert.NotAfter) {
+		return fmt.Errorf("certificate expired on %s", cert.NotAfter.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// record stores the outcome of a check and broadcasts status changes
+func (m *Monitor) record(domain *models.Domain, cert *x509.Certificate, checkErr error) {
+	previous := domain.CertStatus
+	now := time.Now()
+
+	domain.CertCheckedAt = &now
+	if checkErr != nil {
+		domain.CertStatus = models.CertificateError
+		domain.CertError = checkErr.Error()
+	} else {
+		expires := cert.NotAfter
+		domain.CertIssuer = issuerName(cert)
+		domain.CertExpiresAt = &expires
+		domain.CertError = ""
+		domain.CertStatus = models.CertificateValid
+		if time.Until(expires) < m.warnBefore {
+			domain.CertStatus = models.CertificateExpiring
+		}
+	}
+
+	if err := m.db.Model(&models.Domain{}).Where("id = ?", domain.ID).Updates(map[string]interface{}{
+		"cert_status":     domain.CertStatus,
+		"cert_issuer":     domain.CertIssuer,
+		"cert_expires_at": domain.CertExpiresAt,
+		"cert_error":      domain.CertError,
+		"cert_checked_at": domain.CertCheckedAt,
+	}).Error; err != nil {
+		log.Printf("Warning: failed to save certificate status of %s: %v", domain.Domain, err)
+	}
+
+	if domain.CertStatus == previous {
+		return
+	}
+	switch domain.CertStatus {
+	case models.CertificateExpiring:
+		log.Printf("Warning: certificate of %s expires on %s", domain.Domain, domain.CertExpiresAt.Format("2006-01-02"))
+	case models.CertificateError:
+		log.Printf("Warning: certificate check of %s failed: %s", domain.Domain, domain.CertError)
+	}
+	m.broadcast(domain)
+}
+
+// setStatus changes only the status of a domain's certificate
+func (m *Monitor) setStatus(domain *models.Domain, status models.CertificateStatus) {
+	if domain.CertStatus == status {
+		return
+	}
+	domain.CertStatus = status
+	m.db.Model(&models.Domain{}).Where("id = ?", domain.ID).Update("cert_status", status)
+	m.broadcast(domain)
+}
+
+func (m *Monitor) broadcast(domain *models.Domain) {
+	if m.wsHub == nil {
+		return
+	}
+
+	payload := websocket.CertificateStatusPayload{
+		DomainID:  domain.ID,
+		ProjectID: domain.ProjectID,
+		Domain:    domain.Domain,
+		Status:    string(domain.CertStatus),
+		Issuer:    domain.CertIssuer,
+		Error:     domain.CertError,
+	}
+	if domain.CertExpiresAt != nil {
+		payload.ExpiresAt = domain.CertExpiresAt.Format(time.RFC3339)
+	}
+	m.wsHub.BroadcastCertificateStatus(payload)
+}
+
+func (m *Monitor) startWatching(domainID uint) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watching[domainID] {
+		return false
+	}
+	m.watching[domainID] = true
+	return true
+}
+
+func (m *Monitor) stopWatching(domainID uint) {
+	m.mu.Lock()
+	delete(m.watching, domainID)
+	m.mu.Unlock()
+}
+
+// monitored reports whether a domain is served over HTTPS with a certificate of its own
+// Wildcard certificates need a DNS challenge and can't be probed by name
+func monitored(domain *models.Domain) bool {
+	return domain.IsActive && domain.Verified() && domain.SSLEnabled && !strings.HasPrefix(domain.Domain, "*.")
+}
+
+func issuerName(cert *x509.Certificate) string {
+	if len(cert.Issuer.Organization) > 0 {
+		return fmt.Sprintf("%s (%s)", cert.Issuer.Organization[0], cert.Issuer.CommonName)
+	}
+	return cert.Issuer.CommonName
+}
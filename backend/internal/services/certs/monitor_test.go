@@ -0,0 +1,301 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/config"
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/dnscheck"
+	"github.com/vps-panel/backend/internal/testutil"
+)
+
+// fakeDialer connects every address to one TLS server, failing the first dials
+type fakeDialer struct {
+	addr string // TLS server to connect to; empty fails every dial
+
+	mu    sync.Mutex
+	fails int // dials left that fail
+	dials int
+}
+
+func (d *fakeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dials++
+	fail := d.addr == "" || d.fails > 0
+	if d.fails > 0 {
+		d.fails--
+	}
+	d.mu.Unlock()
+
+	if fail {
+		return nil, errors.New("connection refused")
+	}
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+	return dialer.DialContext(ctx, network, d.addr)
+}
+
+// rawDialer returns plain connections, which aren't *tls.Conn
+type rawDialer struct{}
+
+func (rawDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+// fakeResolver resolves every name to one address
+type fakeResolver struct{ ip string }
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP(r.ip)}}, nil
+}
+
+func (r fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return host + ".", nil
+}
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// newCertificate creates a self-signed certificate for host expiring after validFor,
+// so its issuer is host as well
+func newCertificate(t *testing.T, host string, validFor time.Duration) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTLSServer serves certificate and returns its address
+func newTLSServer(t *testing.T, certificate tls.Certificate) string {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+// newTestMonitor creates a monitor on an in-memory database holding one
+// served domain, with DNS pointing at this server
+func newTestMonitor(t *testing.T, dialer Dialer) (*Monitor, *gorm.DB, *models.Domain) {
+	t.Helper()
+
+	db := testutil.OpenDB(t, &models.Domain{}, &models.Certificate{})
+
+	domain := &models.Domain{
+		ProjectID:          1,
+		Domain:             "app.example.com",
+		IsActive:           true,
+		SSLEnabled:         true,
+		VerificationStatus: models.DomainVerified,
+	}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{ServerIPs: "203.0.113.10", CertExpiryWarningDays: 14}
+	m := NewMonitorWithDialer(db, cfg, nil, dialer)
+	m.dns = dnscheck.NewVerifierWithResolver(cfg, fakeResolver{ip: "203.0.113.10"})
+	return m, db, domain
+}
+
+func TestProbe(t *testing.T) {
+	addr := newTLSServer(t, newCertificate(t, "app.example.com", 90*24*time.Hour))
+	m, _, _ := newTestMonitor(t, &fakeDialer{addr: addr})
+
+	cert, err := m.probe(context.Background(), "app.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "app.example.com" {
+		t.Errorf("probe returned the certificate of %q", cert.Subject.CommonName)
+	}
+
+	m.dialer = &fakeDialer{}
+	if _, err := m.probe(context.Background(), "app.example.com"); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("probe with a failing dialer = %v, want the dial error", err)
+	}
+
+	m.dialer = rawDialer{}
+	if _, err := m.probe(context.Background(), "app.example.com"); err == nil || !strings.Contains(err.Error(), "not a TLS connection") {
+		t.Errorf("probe over a plain connection = %v, want an error", err)
+	}
+}
+
+func TestRecordStatusTransitions(t *testing.T) {
+	m, db, domain := newTestMonitor(t, &fakeDialer{})
+
+	steps := []struct {
+		name     string
+		validFor time.Duration
+		err      error
+		want     models.CertificateStatus
+	}{
+		{"valid", 90 * 24 * time.Hour, nil, models.CertificateValid},
+		{"within the warning period", 5 * 24 * time.Hour, nil, models.CertificateExpiring},
+		{"check failed", 0, errors.New("x509: certificate signed by unknown authority"), models.CertificateError},
+		{"issued again", 90 * 24 * time.Hour, nil, models.CertificateValid},
+	}
+
+	for _, step := range steps {
+		var cert *x509.Certificate
+		if step.err == nil {
+			var err error
+			if cert, err = x509.ParseCertificate(newCertificate(t, domain.Domain, step.validFor).Certificate[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m.record(domain, cert, step.err)
+
+		var stored models.Domain
+		if err := db.First(&stored, domain.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.CertStatus != step.want || domain.CertStatus != step.want {
+			t.Errorf("%s: status = %q (stored %q), want %q", step.name, domain.CertStatus, stored.CertStatus, step.want)
+		}
+		if stored.CertCheckedAt == nil {
+			t.Errorf("%s: check time not stored", step.name)
+		}
+
+		if step.err != nil {
+			if stored.CertError != step.err.Error() {
+				t.Errorf("%s: error = %q, want %q", step.name, stored.CertError, step.err)
+			}
+			continue
+		}
+		if stored.CertError != "" {
+			t.Errorf("%s: error = %q, want it cleared", step.name, stored.CertError)
+		}
+		if stored.CertIssuer != domain.Domain {
+			t.Errorf("%s: issuer = %q, want %s", step.name, stored.CertIssuer, domain.Domain)
+		}
+		if stored.CertExpiresAt == nil || !stored.CertExpiresAt.Equal(cert.NotAfter) {
+			t.Errorf("%s: expiry = %v, want %v", step.name, stored.CertExpiresAt, cert.NotAfter)
+		}
+	}
+}
+
+// watchReports collects what Watch reports until it gives a final verdict
+func watchReports(t *testing.T, m *Monitor, domain *models.Domain, final string) []string {
+	t.Helper()
+
+	reports := make(chan string, 16)
+	m.Watch([]models.Domain{*domain}, func(message, level string) {
+		reports <- level + ": " + message
+	})
+
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case report := <-reports:
+			got = append(got, report)
+			if strings.Contains(report, final) {
+				return got
+			}
+		case <-timeout:
+			t.Fatalf("no report containing %q, got %q", final, got)
+		}
+	}
+}
+
+func TestWatchWaitsForIssuance(t *testing.T) {
+	addr := newTLSServer(t, newCertificate(t, "app.example.com", 90*24*time.Hour))
+	dialer := &fakeDialer{addr: addr, fails: 2}
+	m, db, domain := newTestMonitor(t, dialer)
+	m.watchInterval = 10 * time.Millisecond
+
+	reports := watchReports(t, m, domain, "now live")
+	if !strings.Contains(reports[0], "Waiting for the SSL certificate") {
+		t.Errorf("first report = %q, want the wait announced", reports[0])
+	}
+	if dialer.dials != 3 {
+		t.Errorf("dialed %d times, want 3", dialer.dials)
+	}
+
+	var stored models.Domain
+	db.First(&stored, domain.ID)
+	if stored.CertStatus != models.CertificateValid {
+		t.Errorf("status = %q, want valid", stored.CertStatus)
+	}
+}
+
+func TestWatchTimesOut(t *testing.T) {
+	m, db, domain := newTestMonitor(t, &fakeDialer{})
+	m.watchInterval = 10 * time.Millisecond
+	m.watchTimeout = 100 * time.Millisecond
+
+	reports := watchReports(t, m, domain, "was not issued within")
+	if last := reports[len(reports)-1]; !strings.HasPrefix(last, "warning: ") || !strings.Contains(last, "connection refused") {
+		t.Errorf("final report = %q, want a warning with the last error", last)
+	}
+
+	// The watch is finished once its outcome is recorded
+	deadline := time.Now().Add(time.Second)
+	for !m.startWatching(domain.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("domain still watched after the timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var stored models.Domain
+	db.First(&stored, domain.ID)
+	if stored.CertStatus != models.CertificateError || !strings.Contains(stored.CertError, "connection refused") {
+		t.Errorf("status = %q (%q), want error with the last dial error", stored.CertStatus, stored.CertError)
+	}
+}
+
+func TestWatchSkipsDomainsWithoutDNS(t *testing.T) {
+	m, db, domain := newTestMonitor(t, &fakeDialer{})
+	m.dns = dnscheck.NewVerifierWithResolver(&config.Config{ServerIPs: "203.0.113.10"}, fakeResolver{ip: "198.51.100.7"})
+
+	reports := watchReports(t, m, domain, "is not ready")
+	if len(reports) != 1 {
+		t.Errorf("reports = %q, want only the DNS warning", reports)
+	}
+
+	var stored models.Domain
+	db.First(&stored, domain.ID)
+	if stored.CertStatus != models.CertificateError || !strings.HasPrefix(stored.CertError, "DNS not ready") {
+		t.Errorf("status = %q (%q), want a DNS error", stored.CertStatus, stored.CertError)
+	}
+}
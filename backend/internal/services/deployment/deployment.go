@@ -2,11 +2,10 @@ package deployment
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -19,21 +18,31 @@ import (
 	"github.com/vps-panel/backend/internal/config"
 	"github.com/vps-panel/backend/internal/models"
 	"github.com/vps-panel/backend/internal/services/caddy"
+	"github.com/vps-panel/backend/internal/services/certs"
 	"github.com/vps-panel/backend/internal/services/docker"
 	"github.com/vps-panel/backend/internal/services/git"
 	"github.com/vps-panel/backend/internal/services/websocket"
 )
 
+// ErrDeploymentCancelled is returned by Deploy when the deployment was aborted by the user
+var ErrDeploymentCancelled = errors.New("deployment cancelled by user")
+
+// ErrDeploymentNotCancellable is returned by Cancel when the deployment has already finished
+var ErrDeploymentNotCancellable = errors.New("cannot cancel deployment in current state")
+
 type DeploymentService struct {
 	db            *gorm.DB
 	cfg           *config.Config
 	gitService    *git.GitService
 	dockerService *docker.DockerService
 	caddyService  *caddy.CaddyService
+	certMonitor   *certs.Monitor
 	wsHub         *websocket.Hub
+	running       *deploymentRegistry
+	queue         *buildQueue
 }
 
-func NewDeploymentService(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub) (*DeploymentService, error) {
+func NewDeploymentService(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub, certMonitor *certs.Monitor, caddyService *caddy.CaddyService) (*DeploymentService, error) {
 	dockerService, err := docker.NewDockerService()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Docker service: %w", err)
@@ -44,24 +53,98 @@ func NewDeploymentService(db *gorm.DB, cfg *config.Config, wsHub *websocket.Hub)
 		cfg:           cfg,
 		gitService:    git.NewGitService(cfg.ProjectsDir),
 		dockerService: dockerService,
-		caddyService:  caddy.NewCaddyService(cfg.CaddyConfigPath, cfg.CaddyReloadCmd),
+		caddyService:  caddyService,
+		certMonitor:   certMonitor,
 		wsHub:         wsHub,
+		running:       newDeploymentRegistry(),
+		queue:         newBuildQueue(),
 	}, nil
 }
 
 func (s *DeploymentService) Deploy(deploymentID uint) error {
 	// Load deployment
 	var deployment models.Deployment
-	if err := s.db.Preload("Project").Preload("Project.Domains").Preload("Project.Environments").
+	if err := s.db.Preload("Project").Preload("Project.Domains").Preload("Project.Environments", "project_environment_id IS NULL").
+		Preload("Project.AccessPolicies.Users").
+		Preload("Project.Certificates").
+		Preload("Project.MaintenanceWindows", "ends_at > ?", time.Now()).
 		First(&deployment, deploymentID).Error; err != nil {
 		return fmt.Errorf("failed to load deployment: %w", err)
 	}
 
+	// Deployment was cancelled before it got a chance to start
+	if deployment.Status == models.DeploymentCancelled {
+		return ErrDeploymentCancelled
+	}
+
 	project := deployment.Project
 
-	// Update deployment status
+	// Preview deployments build the pull request into the preview's own container and site
+	var preview *models.Preview
+	if deployment.PreviewID != nil {
+		preview = &models.Preview{}
+		if err := s.db.First(preview, *deployment.PreviewID).Error; err != nil {
+			return fmt.Errorf("failed to load preview: %w", err)
+		}
+
+		// The pull request was closed while this deployment was queued
+		if preview.Status == models.PreviewClosed {
+			now := time.Now()
+			deployment.Status = models.DeploymentCancelled
+			deployment.CompletedAt = &now
+			s.db.Save(&deployment)
+			s.logBuild(deployment.ID, fmt.Sprintf("Pull request #%d was closed, preview deployment cancelled", preview.Number), "warning")
+			return ErrDeploymentCancelled
+		}
+
+		project = project.ForPreview(preview)
+	}
+
+	// Other environments than production are deployed to a container and site of their own
+	var environment *models.ProjectEnvironment
+	if deployment.ProjectEnvironmentID != nil {
+		environment = &models.ProjectEnvironment{}
+		if err := s.db.Preload("Variables").First(environment, *deployment.ProjectEnvironmentID).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed to load environment: %w", err)
+			}
+
+			// The environment was deleted while this deployment was queued
+			now := time.Now()
+			deployment.Status = models.DeploymentCancelled
+			deployment.CompletedAt = &now
+			s.db.Save(&deployment)
+			s.logBuild(deployment.ID, "The environment was deleted, deployment cancelled", "warning")
+			return ErrDeploymentCancelled
+		}
+
+		project = project.ForEnvironment(environment)
+	}
+
+	// Register the deployment so it can be cancelled while running
+	// BUILD_TIMEOUT bounds the whole deployment, not just the image build
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.cfg.BuildTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(s.cfg.BuildTimeout)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	s.running.register(deployment.ID, cancel)
+	defer s.running.unregister(deployment.ID)
+
+	// Claim the deployment; Cancel may have marked it cancelled since it was loaded
+	result := s.db.Model(&models.Deployment{}).
+		Where("id = ? AND status = ?", deployment.ID, models.DeploymentPending).
+		Update("status", models.DeploymentBuilding)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update deployment status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeploymentCancelled
+	}
 	deployment.Status = models.DeploymentBuilding
-	s.db.Save(&deployment)
 
 	// Broadcast status update via WebSocket
 	if s.wsHub != nil {
@@ -69,17 +152,62 @@ func (s *DeploymentService) Deploy(deploymentID uint) error {
 	}
 
 	// Execute deployment steps
-	ctx := context.Background()
 	startTime := time.Now()
 
-	if err := s.executeDeployment(ctx, &deployment, &project); err != nil {
-		// Mark deployment as failed
-		deployment.Status = models.DeploymentFailed
-		deployment.ErrorMessage = err.Error()
+	execute := s.executeDeployment
+	switch deployment.TriggeredBy {
+	case triggerRollback:
+		execute = s.executeRollback
+	case triggerPromote:
+		execute = s.executePromote
+	}
+
+	if err := execute(ctx, &deployment, &project); err != nil {
 		now := time.Now()
 		deployment.CompletedAt = &now
 		deployment.Duration = int(time.Since(startTime).Seconds())
+
+		// Cancellation surfaces as a context error from whichever step was running
+		if errors.Is(ctx.Err(), context.Canceled) {
+			deployment.Status = models.DeploymentCancelled
+			deployment.ErrorMessage = ""
+			s.db.Save(&deployment)
+
+			if s.wsHub != nil {
+				s.wsHub.BroadcastDeploymentStatus(deployment.ID, project.ID, string(models.DeploymentCancelled), "")
+			}
+
+			s.logBuild(deployment.ID, "Deployment cancelled by user", "warning")
+			return ErrDeploymentCancelled
+		}
+
+		// Nothing the project's path filters care about changed; the running container stays
+		if errors.Is(err, ErrDeploymentSkipped) {
+			deployment.Status = models.DeploymentSkipped
+			s.db.Save(&deployment)
+
+			if s.wsHub != nil {
+				s.wsHub.BroadcastDeploymentStatus(deployment.ID, project.ID, string(models.DeploymentSkipped), "")
+			}
+
+			s.logBuild(deployment.ID, fmt.Sprintf("Deployment skipped: %s", deployment.SkipReason), "info")
+			return ErrDeploymentSkipped
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("deployment timed out after %d seconds", s.cfg.BuildTimeout)
+		}
+
+		// Mark deployment as failed
+		deployment.Status = models.DeploymentFailed
+		deployment.ErrorMessage = err.Error()
 		s.db.Save(&deployment)
+		if preview != nil {
+			s.db.Model(preview).Where("status <> ?", models.PreviewClosed).Update("status", models.PreviewFailed)
+		}
+		if environment != nil {
+			s.db.Model(environment).Update("status", "failed")
+		}
 
 		// Broadcast failure via WebSocket
 		if s.wsHub != nil {
@@ -102,21 +230,108 @@ func (s *DeploymentService) Deploy(deploymentID uint) error {
 		s.wsHub.BroadcastDeploymentStatus(deployment.ID, project.ID, string(models.DeploymentSuccess), "")
 	}
 
-	// Update project status
-	project.Status = "active"
-	project.LastDeployed = &now
-	s.db.Save(&project)
+	if preview != nil {
+		s.db.Model(preview).Where("status <> ?", models.PreviewClosed).Updates(map[string]interface{}{
+			"status":        models.PreviewActive,
+			"last_deployed": &now,
+		})
+		s.logBuild(deployment.ID, "Preview deployment completed successfully!", "info")
+		return nil
+	}
+
+	// Update project (or environment) status
+	if environment != nil {
+		s.db.Model(environment).Updates(map[string]interface{}{
+			"status":        "active",
+			"last_deployed": &now,
+		})
+	} else {
+		project.Status = "active"
+		project.LastDeployed = &now
+		s.db.Save(&project)
+	}
+
+	// Drop release images beyond IMAGE_RETENTION
+	s.pruneImages(context.Background(), &project)
 
 	s.logBuild(deployment.ID, "Deployment completed successfully!", "info")
 	return nil
 }
 
+// Cancel aborts a pending or in-flight deployment
+// Running deployments are stopped via their context and finalized by Deploy;
+// deployments that have not started yet are marked cancelled directly
+func (s *DeploymentService) Cancel(deploymentID uint) error {
+	var deployment models.Deployment
+	if err := s.db.First(&deployment, deploymentID).Error; err != nil {
+		return fmt.Errorf("failed to load deployment: %w", err)
+	}
+
+	switch deployment.Status {
+	case models.DeploymentPending, models.DeploymentBuilding, models.DeploymentDeploying:
+	default:
+		return ErrDeploymentNotCancellable
+	}
+
+	if s.running.cancel(deployment.ID) {
+		return nil
+	}
+
+	// Not started yet - drop it from the build queue
+	if s.queue.remove(deployment.ID) {
+		defer s.broadcastQueuePositions()
+	}
+
+	// Deploy only starts deployments that are still pending, so whichever of
+	// the two changes the status first wins
+	now := time.Now()
+	result := s.db.Model(&models.Deployment{}).
+		Where("id = ? AND status = ?", deployment.ID, models.DeploymentPending).
+		Updates(map[string]interface{}{
+			"status":       models.DeploymentCancelled,
+			"completed_at": &now,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel deployment: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// It started in the meantime and is registered before it leaves pending
+		if s.running.cancel(deployment.ID) {
+			return nil
+		}
+		return ErrDeploymentNotCancellable
+	}
+
+	if s.wsHub != nil {
+		s.wsHub.BroadcastDeploymentStatus(deployment.ID, deployment.ProjectID, string(models.DeploymentCancelled), "")
+	}
+
+	s.logBuild(deployment.ID, "Deployment cancelled by user", "warning")
+	return nil
+}
+
 func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *models.Deployment, project *models.Project) error {
+	// The compose setup of PocketBase projects exists once per project
+	if project.ProjectEnvironment != nil && project.BaaSType == models.BaaSPocketBase {
+		return fmt.Errorf("environments aren't supported for PocketBase projects")
+	}
+
 	// Step 1: Clone repository
-	s.logBuild(deployment.ID, "Cloning repository...", "info")
-	repoPath, err := s.gitService.Clone(fmt.Sprintf("project-%d", project.ID), git.CloneOptions{
+	if deployment.Tag != "" {
+		s.logBuild(deployment.ID, fmt.Sprintf("Cloning repository at tag %s...", deployment.Tag), "info")
+	} else {
+		s.logBuild(deployment.ID, "Cloning repository...", "info")
+	}
+	// Pull request branches get force-pushed, so previews are cloned afresh every time
+	if project.Preview != nil {
+		if err := s.gitService.Cleanup(checkoutDir(project)); err != nil {
+			return fmt.Errorf("failed to clean up previous checkout: %w", err)
+		}
+	}
+	repoPath, err := s.gitService.CloneContext(ctx, checkoutDir(project), git.CloneOptions{
 		URL:      project.GitURL,
 		Branch:   project.GitBranch,
+		Tag:      deployment.Tag,
 		Depth:    1,
 		Username: project.GitUsername,
 		Token:    project.GitToken,
@@ -136,6 +351,14 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 		s.db.Save(&deployment)
 	}
 
+	// Pushes whose payload didn't list every changed file are checked against the path filters now
+	if deployment.CheckPaths && project.HasPathFilters() {
+		if reason := s.checkChangedPaths(ctx, deployment, project, repoPath); reason != "" {
+			deployment.SkipReason = reason
+			return ErrDeploymentSkipped
+		}
+	}
+
 	// Determine working directory (for monorepos with root_directory specified)
 	workDir := repoPath
 	if project.RootDirectory != "" {
@@ -148,6 +371,8 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 	s.logBuild(deployment.ID, "Allocating deployment resources...", "info")
 
 	// Allocate ports first
+	// The running container keeps its ports until the new one has taken over
+	previous := livePorts{frontend: project.FrontendPort, backend: project.BackendPort}
 	if err := s.ensureAvailablePorts(project, deployment.ID); err != nil {
 		return fmt.Errorf("failed to ensure available ports: %w", err)
 	}
@@ -157,6 +382,10 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 		return fmt.Errorf("failed to ensure project domain: %w", err)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// Step 3: Detect framework and prepare for deployment
 	s.logBuild(deployment.ID, "Detecting project structure...", "info")
 
@@ -203,7 +432,7 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 
 	// Step 4: Build Docker image (includes install and build steps)
 	s.logBuild(deployment.ID, "Building Docker image...", "info")
-	imageName := fmt.Sprintf("vps-panel/project-%d:latest", project.ID)
+	imageName := latestImage(project)
 
 	// Create a log callback that logs to the database
 	logCallback := func(message string) {
@@ -223,88 +452,29 @@ func (s *DeploymentService) executeDeployment(ctx context.Context, deployment *m
 		return fmt.Errorf("failed to build Docker image: %w", err)
 	}
 
-	// Step 5: Deploy container
+	// Keep an immutable copy of this build so the deployment can be rolled back to
+	// Previews are rebuilt on every push and don't keep release images
+	if project.Preview == nil {
+		s.snapshotImage(ctx, deployment, project)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Step 5: Deploy container next to the running one and switch traffic once it is healthy
+	// Step 6 (Caddy update) is part of the swap; domain was already created in step 2
 	deployment.Status = models.DeploymentDeploying
 	s.db.Save(&deployment)
 	s.logBuild(deployment.ID, "Deploying container...", "info")
 
-	containerID, err := s.dockerService.CreateContainer(ctx, project, imageName)
-	if err != nil {
-		// Check for port conflict
-		if strings.Contains(err.Error(), "address already in use") {
-			portMsg := ""
-			if project.FrontendPort > 0 && project.BackendPort > 0 {
-				portMsg = fmt.Sprintf("frontend port %d or backend port %d", project.FrontendPort, project.BackendPort)
-			} else if project.FrontendPort > 0 {
-				portMsg = fmt.Sprintf("port %d", project.FrontendPort)
-			} else if project.BackendPort > 0 {
-				portMsg = fmt.Sprintf("port %d", project.BackendPort)
-			}
-			return fmt.Errorf("port conflict: %s is already in use. Please use a different port for your project", portMsg)
-		}
-		return fmt.Errorf("failed to create container: %w", err)
-	}
-
-	if err := s.dockerService.StartContainer(ctx, containerID); err != nil {
-		// Check for port conflict on start
-		if strings.Contains(err.Error(), "address already in use") {
-			// Clean up the created container
-			s.dockerService.RemoveContainer(ctx, fmt.Sprintf("vps-panel-%s-%d", project.Name, project.ID))
-
-			portMsg := ""
-			if project.FrontendPort > 0 && project.BackendPort > 0 {
-				portMsg = fmt.Sprintf("frontend port %d or backend port %d", project.FrontendPort, project.BackendPort)
-			} else if project.FrontendPort > 0 {
-				portMsg = fmt.Sprintf("port %d", project.FrontendPort)
-			} else if project.BackendPort > 0 {
-				portMsg = fmt.Sprintf("port %d", project.BackendPort)
-			}
-			return fmt.Errorf("port conflict: %s is already in use. Please use a different port for your project", portMsg)
-		}
-		return fmt.Errorf("failed to start container: %w", err)
-	}
-
-	// Step 6: Update Caddy configuration (domain was already created in step 2)
-	s.logBuild(deployment.ID, "Updating reverse proxy configuration...", "info")
-	if err := s.caddyService.GenerateConfig(project); err != nil {
-		return fmt.Errorf("failed to generate Caddy config: %w", err)
-	}
-
-	if err := s.caddyService.Reload(); err != nil {
-		log.Printf("Warning: failed to reload Caddy: %v", err)
-	}
-
-	// Step 7: Wait for Caddy to provision SSL certificate
-	// Caddy automatically provisions certificates after reload, but it happens asynchronously
-	// We need to wait for this process to complete
-	if len(project.Domains) > 0 {
-		s.logBuild(deployment.ID, "Waiting for SSL certificate provisioning to complete...", "info")
-		s.logBuild(deployment.ID, "Caddy is obtaining SSL certificate from Let's Encrypt...", "info")
-
-		// Wait for Caddy's ACME process to complete (typically takes 5-15 seconds)
-		// This gives Caddy enough time to:
-		// 1. Start the ACME process
-		// 2. Complete the TLS-ALPN-01 challenge
-		// 3. Download and install the certificate
-		time.Sleep(20 * time.Second)
-
-		// Verify certificate was obtained
-		if err := s.verifySSLCertificate(project, deployment.ID); err != nil {
-			// Don't fail deployment, just warn
-			log.Printf("Warning: SSL certificate verification incomplete: %v", err)
-			s.logBuild(deployment.ID, "SSL certificate will be fully active on first user access", "warning")
-		} else {
-			s.logBuild(deployment.ID, "✓ SSL certificate provisioned successfully", "info")
-			// Get the domain to show the user
-			for _, d := range project.Domains {
-				if d.IsActive {
-					s.logBuild(deployment.ID, fmt.Sprintf("Your app is now live at: https://%s", d.Domain), "info")
-					break
-				}
-			}
-		}
+	if err := s.swapContainer(ctx, deployment, project, imageName, previous); err != nil {
+		return err
 	}
 
+	// Step 7: Caddy provisions SSL certificates asynchronously; follow them without blocking the deployment
+	s.watchCertificates(project, deployment.ID)
+
 	return nil
 }
 
@@ -372,8 +542,8 @@ func (s *DeploymentService) writeSystemVariables(builder *strings.Builder, proje
 	// Get deployment URL from the first active domain
 	deploymentURL := ""
 	deploymentDomain := ""
-	for _, domain := range project.Domains {
-		if domain.IsActive {
+	for _, domain := range project.SiteDomains() {
+		if domain.IsActive && domain.Verified() {
 			deploymentDomain = domain.Domain
 			if domain.SSLEnabled {
 				deploymentURL = fmt.Sprintf("https://%s", domain.Domain)
@@ -494,7 +664,7 @@ func (s *DeploymentService) ensureDockerfile(repoPath string, project *models.Pr
 		detectedDir := s.detectOutputDirectory(repoPath)
 		if detectedDir != "" {
 			project.OutputDir = detectedDir
-			s.db.Save(project)
+			s.db.Model(project).Update("output_dir", detectedDir)
 		}
 	}
 
@@ -811,7 +981,7 @@ func (s *DeploymentService) logBuild(deploymentID uint, message, logType string)
 		// Get the project ID for this deployment
 		var deployment models.Deployment
 		if err := s.db.Select("project_id").First(&deployment, deploymentID).Error; err == nil {
-			s.wsHub.BroadcastBuildLog(deploymentID, deployment.ProjectID, message, logType, buildLog.CreatedAt.Format(time.RFC3339))
+			s.wsHub.BroadcastBuildLog(buildLog.ID, deploymentID, deployment.ProjectID, message, logType, buildLog.CreatedAt.Format(time.RFC3339))
 		}
 	}
 }
@@ -861,13 +1031,20 @@ func (s *DeploymentService) generateSubdomain(project *models.Project) string {
 // If no domain exists, it auto-generates a subdomain like Vercel does
 func (s *DeploymentService) ensureProjectDomain(project *models.Project, deploymentID uint) error {
 	// Check if project already has active domains
-	for _, domain := range project.Domains {
-		if domain.IsActive {
+	for _, domain := range project.SiteDomains() {
+		if domain.IsActive && domain.Verified() {
 			s.logBuild(deploymentID, fmt.Sprintf("Using configured domain: %s", domain.Domain), "info")
 			return nil
 		}
 	}
 
+	// Unverified domains aren't served until their DNS records check out
+	for _, domain := range project.SiteDomains() {
+		if domain.IsActive && !domain.Verified() {
+			s.logBuild(deploymentID, fmt.Sprintf("Domain %s is not verified yet and won't be served until it is", domain.Domain), "warning")
+		}
+	}
+
 	// No active domains, need to create one
 	// Check if we have a base domain configured
 	baseDomain := s.cfg.PanelDomain
@@ -890,10 +1067,17 @@ func (s *DeploymentService) ensureProjectDomain(project *models.Project, deploym
 
 	// Create domain entry
 	domain := models.Domain{
-		ProjectID:  project.ID,
-		Domain:     fullDomain,
-		IsActive:   true,
-		SSLEnabled: true,
+		ProjectID:          project.ID,
+		Domain:             fullDomain,
+		IsActive:           true,
+		SSLEnabled:         true,
+		VerificationStatus: models.DomainVerified, // Under the panel's own domain
+	}
+	if project.Preview != nil {
+		domain.PreviewID = &project.Preview.ID
+	}
+	if project.ProjectEnvironment != nil {
+		domain.ProjectEnvironmentID = &project.ProjectEnvironment.ID
 	}
 
 	if err := s.db.Create(&domain).Error; err != nil {
@@ -908,44 +1092,16 @@ func (s *DeploymentService) ensureProjectDomain(project *models.Project, deploym
 	return nil
 }
 
-// verifySSLCertificate verifies that SSL certificate was obtained by Caddy
-// After Caddy reload, certificates are obtained automatically but asynchronously
-// This function simply verifies the certificate is working
-func (s *DeploymentService) verifySSLCertificate(project *models.Project, deploymentID uint) error {
-	// Get the first active domain
-	var domain string
-	for _, d := range project.Domains {
-		if d.IsActive {
-			domain = d.Domain
-			break
-		}
-	}
-
-	if domain == "" {
-		return fmt.Errorf("no active domain found")
-	}
-
-	// Create HTTP client with reasonable timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: false, // Validate the certificate
-			},
-		},
-	}
-
-	url := fmt.Sprintf("https://%s", domain)
-	s.logBuild(deploymentID, "Verifying SSL certificate...", "info")
-
-	// Make a simple HEAD request to verify SSL is working
-	resp, err := client.Head(url)
-	if err != nil {
-		return fmt.Errorf("SSL verification failed: %v", err)
+// watchCertificates has the certificate monitor follow the issuance of the
+// project's SSL certificates in the background, reporting to the build log
+func (s *DeploymentService) watchCertificates(project *models.Project, deploymentID uint) {
+	if s.certMonitor == nil {
+		return
 	}
-	defer resp.Body.Close()
 
-	return nil
+	s.certMonitor.Watch(project.SiteDomains(), func(message, level string) {
+		s.logBuild(deploymentID, message, level)
+	})
 }
 
 // ensureAvailablePorts checks and assigns available ports to the project
@@ -986,12 +1142,33 @@ func (s *DeploymentService) ensureAvailablePorts(project *models.Project, deploy
 		}
 	}
 
-	// Save project if ports were updated
-	if portUpdated {
-		if err := s.db.Save(project).Error; err != nil {
+	// Save project if ports were updated; a new preview or environment records the ports it starts on
+	if portUpdated || (project.Preview != nil && project.Preview.FrontendPort == 0) ||
+		(project.ProjectEnvironment != nil && project.ProjectEnvironment.FrontendPort == 0) {
+		if err := s.savePorts(project); err != nil {
 			return fmt.Errorf("failed to save updated ports: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// savePorts stores the ports of a project, or of its preview or environment
+func (s *DeploymentService) savePorts(project *models.Project) error {
+	ports := map[string]interface{}{
+		"frontend_port": project.FrontendPort,
+		"backend_port":  project.BackendPort,
+	}
+
+	if project.Preview != nil {
+		project.Preview.FrontendPort = project.FrontendPort
+		project.Preview.BackendPort = project.BackendPort
+		return s.db.Model(project.Preview).Updates(ports).Error
+	}
+	if project.ProjectEnvironment != nil {
+		project.ProjectEnvironment.FrontendPort = project.FrontendPort
+		project.ProjectEnvironment.BackendPort = project.BackendPort
+		return s.db.Model(project.ProjectEnvironment).Updates(ports).Error
+	}
+	return s.db.Model(project).Updates(ports).Error
+}
@@ -0,0 +1,76 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// deploymentsOf scopes a query to the deployments of a project's production
+// site, or of the environment it was returned for by ForEnvironment
+func deploymentsOf(project *models.Project) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("project_id = ?", project.ID)
+		if project.ProjectEnvironment != nil {
+			return db.Where("project_environment_id = ?", project.ProjectEnvironment.ID)
+		}
+		return db.Where("project_environment_id IS NULL")
+	}
+}
+
+// DeleteEnvironment deletes an environment and cancels its deployments. Its
+// container, images, checkout, Caddy site, domains and variables are removed
+// in the background, once no deployment of the project is running anymore
+func (s *DeploymentService) DeleteEnvironment(environment *models.ProjectEnvironment) error {
+	var project models.Project
+	if err := s.db.First(&project, environment.ProjectID).Error; err != nil {
+		return fmt.Errorf("failed to load project: %w", err)
+	}
+
+	if err := s.db.Delete(environment).Error; err != nil {
+		return fmt.Errorf("failed to delete environment: %w", err)
+	}
+
+	// Deploy refuses deployments of deleted environments, so this only speeds things up
+	s.cancelUnfinished("project_environment_id", environment.ID)
+
+	target := project.ForEnvironment(environment)
+	go func() {
+		// A cancelled deployment could otherwise recreate what's being removed
+		s.queue.acquire(project.ID)
+		defer s.queue.finish(project.ID)
+
+		s.removeEnvironment(&target)
+	}()
+
+	return nil
+}
+
+// removeEnvironment takes down everything an environment's deployments set up
+func (s *DeploymentService) removeEnvironment(project *models.Project) {
+	environment := project.ProjectEnvironment
+	s.removeSite(project)
+
+	// Release images kept for rollbacks
+	var images []string
+	s.db.Model(&models.Deployment{}).Scopes(deploymentsOf(project)).
+		Where("image_tag <> ''").
+		Distinct().
+		Pluck("image_tag", &images)
+	for _, imageRef := range images {
+		if err := s.dockerService.RemoveImage(context.Background(), imageRef); err != nil {
+			log.Printf("Warning: failed to remove release image %s: %v", imageRef, err)
+		}
+	}
+	s.db.Model(&models.Deployment{}).Scopes(deploymentsOf(project)).Update("image_tag", "")
+
+	// Domains are deleted for good, so they can be added again elsewhere
+	s.db.Unscoped().Where("project_environment_id = ?", environment.ID).Delete(&models.Domain{})
+	s.db.Where("project_environment_id = ?", environment.ID).Delete(&models.Environment{})
+
+	log.Printf("✓ Removed environment %s (project %d)", environment.Name, project.ID)
+}
@@ -0,0 +1,227 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/docker"
+)
+
+const (
+	defaultHealthCheckPath    = "/"
+	defaultHealthCheckTimeout = 5  // seconds per probe
+	defaultHealthCheckRetries = 30 // probes, roughly a minute with the interval below
+
+	// healthCheckInterval is the delay between probes
+	healthCheckInterval = 2 * time.Second
+	// healthCheckLogLines is how much container output is kept in the build log when a check fails
+	healthCheckLogLines = 50
+)
+
+// healthCheck is a project's health check settings with defaults applied
+type healthCheck struct {
+	path           string
+	expectedStatus int
+	timeout        time.Duration
+	retries        int
+	startPeriod    time.Duration
+}
+
+func healthCheckFor(project *models.Project) healthCheck {
+	check := healthCheck{
+		path:           project.HealthCheckPath,
+		expectedStatus: project.HealthCheckExpectedStatus,
+		timeout:        time.Duration(project.HealthCheckTimeout) * time.Second,
+		retries:        project.HealthCheckRetries,
+		startPeriod:    time.Duration(project.HealthCheckStartPeriod) * time.Second,
+	}
+
+	if check.path == "" {
+		check.path = defaultHealthCheckPath
+	}
+	if !strings.HasPrefix(check.path, "/") {
+		check.path = "/" + check.path
+	}
+	if check.timeout <= 0 {
+		check.timeout = defaultHealthCheckTimeout * time.Second
+	}
+	if check.retries <= 0 {
+		check.retries = defaultHealthCheckRetries
+	}
+
+	return check
+}
+
+// accepts reports whether a response status passes the check
+// Without an expected status any response below 500 counts as healthy
+func (c healthCheck) accepts(status int) bool {
+	if c.expectedStatus > 0 {
+		return status == c.expectedStatus
+	}
+	return status < http.StatusInternalServerError
+}
+
+// waitForHealthy probes a container's published port until it passes the project's health check
+// A container that exits fails immediately
+func (s *DeploymentService) waitForHealthy(ctx context.Context, deploymentID uint, containerRef string, port int, check healthCheck) error {
+	if check.startPeriod > 0 {
+		s.logBuild(deploymentID, fmt.Sprintf("Waiting %s before the first health probe...", check.startPeriod), "info")
+		select {
+		case <-time.After(check.startPeriod):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	client := &http.Client{
+		Timeout: check.timeout,
+		// A redirect is an answer, don't follow it to an external host
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, check.path)
+
+	var lastErr error
+	for attempt := 1; attempt <= check.retries; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(healthCheckInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if !s.dockerService.IsContainerRunning(ctx, containerRef) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("container exited during startup")
+		}
+
+		// Without a published port the container only has to stay up
+		if port <= 0 {
+			return nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if check.accepts(resp.StatusCode) {
+			return nil
+		}
+		lastErr = fmt.Errorf("%s responded with status %d", check.path, resp.StatusCode)
+	}
+
+	return fmt.Errorf("not healthy after %d attempts: %w", check.retries, lastErr)
+}
+
+// captureContainerLogs copies the last lines of a container's output into the build log
+func (s *DeploymentService) captureContainerLogs(deploymentID uint, containerRef string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	output, err := s.dockerService.TailContainerLogs(ctx, containerRef, healthCheckLogLines)
+	if err != nil {
+		s.logBuild(deploymentID, fmt.Sprintf("Could not read container logs: %v", err), "warning")
+		return
+	}
+
+	output = strings.TrimSpace(output)
+	if output == "" {
+		s.logBuild(deploymentID, "Container produced no output", "error")
+		return
+	}
+
+	s.logBuild(deploymentID, fmt.Sprintf("Last %d lines of container output:", healthCheckLogLines), "error")
+	for _, line := range strings.Split(output, "\n") {
+		s.logBuild(deploymentID, line, "error")
+	}
+}
+
+// checkComposeHealth runs the project's health check against the compose frontend service
+// On redeployments the previous frontend image can be restored when the check fails
+func (s *DeploymentService) checkComposeHealth(ctx context.Context, deployment *models.Deployment, project *models.Project, canRollback bool) error {
+	containerName := fmt.Sprintf("vps-panel-%s-frontend-%d", sanitizeProjectName(project.Name), project.ID)
+
+	s.logBuild(deployment.ID, "Waiting for frontend to become healthy...", "info")
+	if err := s.waitForHealthy(ctx, deployment.ID, containerName, project.FrontendPort, healthCheckFor(project)); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+
+		s.captureContainerLogs(deployment.ID, containerName)
+		if canRollback && project.HealthCheckRollback {
+			s.restorePreviousImage(ctx, deployment, project)
+		}
+		return fmt.Errorf("frontend failed health check: %w", err)
+	}
+
+	s.logBuild(deployment.ID, "✓ Frontend is healthy", "info")
+	return nil
+}
+
+// restorePreviousImage puts the last successfully deployed image back in place after a failed health check
+// The deployment still fails; this only brings the site back up
+func (s *DeploymentService) restorePreviousImage(ctx context.Context, deployment *models.Deployment, project *models.Project) {
+	var previous models.Deployment
+	if err := s.db.Scopes(deploymentsOf(project)).
+		Where("id <> ? AND status = ? AND image_tag <> ''", deployment.ID, models.DeploymentSuccess).
+		Order("created_at DESC").
+		First(&previous).Error; err != nil {
+		s.logBuild(deployment.ID, "No previous image available to roll back to", "warning")
+		return
+	}
+
+	s.logBuild(deployment.ID, fmt.Sprintf("Rolling back to deployment #%d (%s)...", previous.ID, previous.ImageTag), "warning")
+
+	if err := s.startPreviousImage(ctx, project, previous.ImageTag); err != nil {
+		s.logBuild(deployment.ID, fmt.Sprintf("Rollback failed: %v", err), "error")
+		return
+	}
+
+	s.logBuild(deployment.ID, fmt.Sprintf("✓ Rolled back to deployment #%d", previous.ID), "warning")
+}
+
+func (s *DeploymentService) startPreviousImage(ctx context.Context, project *models.Project, imageRef string) error {
+	if project.BaaSType == models.BaaSPocketBase {
+		if err := s.dockerService.TagImage(ctx, imageRef, latestImage(project)); err != nil {
+			return err
+		}
+
+		projectName := fmt.Sprintf("vps-panel-project-%d", project.ID)
+		workDir := filepath.Join(s.cfg.ProjectsDir, fmt.Sprintf("project-%d", project.ID))
+		return s.dockerService.ComposeRestartService(ctx, workDir, projectName, "frontend")
+	}
+
+	containerID, err := s.dockerService.CreateContainer(ctx, project, imageRef)
+	if err != nil {
+		return err
+	}
+	if err := s.dockerService.StartContainer(ctx, containerID); err != nil {
+		s.dockerService.RemoveContainer(ctx, docker.ContainerName(project))
+		return err
+	}
+
+	if err := s.caddyService.GenerateConfig(project); err != nil {
+		return fmt.Errorf("failed to generate Caddy config: %w", err)
+	}
+	return s.caddyService.Reload()
+}
@@ -0,0 +1,44 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/git"
+)
+
+// ErrDeploymentSkipped is returned by Deploy when a push didn't change a file matching the project's path filters
+var ErrDeploymentSkipped = errors.New("deployment skipped by path filters")
+
+// checkChangedPaths compares the files changed since the last successful
+// deployment of the same environment with the project's path filters, for
+// pushes whose payload didn't list every changed file. It returns the reason
+// to skip the deployment, or "" to build it; when the files can't be listed
+// the deployment is built
+func (s *DeploymentService) checkChangedPaths(ctx context.Context, deployment *models.Deployment, project *models.Project, repoPath string) string {
+	var last models.Deployment
+	if err := s.db.Select("id", "commit_hash").Scopes(deploymentsOf(project)).
+		Where("status = ? AND commit_hash <> '' AND id <> ?", models.DeploymentSuccess, deployment.ID).
+		Order("created_at DESC").
+		First(&last).Error; err != nil {
+		s.logBuild(deployment.ID, "No previous deployment to compare the path filters with, building", "info")
+		return ""
+	}
+
+	files, err := s.gitService.ChangedFiles(ctx, repoPath, git.CloneOptions{
+		Username: project.GitUsername,
+		Token:    project.GitToken,
+	}, last.CommitHash, deployment.CommitHash)
+	if err != nil {
+		s.logBuild(deployment.ID, fmt.Sprintf("Warning: couldn't list the files changed since deployment #%d, building anyway: %v", last.ID, err), "warning")
+		return ""
+	}
+
+	if project.DeploysChanges(files) {
+		s.logBuild(deployment.ID, fmt.Sprintf("✓ Files changed since deployment #%d match the path filters", last.ID), "info")
+		return ""
+	}
+	return fmt.Sprintf("None of the %d file(s) changed since deployment #%d match the project's path filters", len(files), last.ID)
+}
@@ -224,7 +224,9 @@ services:
       --origins=%s
 
   # Frontend Service
+  # Built images are tagged per deployment so the frontend can be rolled back
   frontend:
+    image: %s
     build:
       context: %s
       dockerfile: Dockerfile
@@ -259,6 +261,7 @@ networks:
 		pocketbaseContainerName,
 		project.BackendPort,
 		pocketbaseURL,
+		latestImage(project),
 		frontendBuildContext,
 		pocketbaseURL,
 		frontendContainerName,
@@ -396,8 +399,8 @@ func sanitizeProjectName(name string) string {
 func (s *DeploymentService) generatePocketBaseDeploymentFiles(pocketbaseDir, frontendDir string, project *models.Project, deploymentID uint) error {
 	// Get deployment domain
 	deploymentDomain := ""
-	for _, domain := range project.Domains {
-		if domain.IsActive {
+	for _, domain := range project.SiteDomains() {
+		if domain.IsActive && domain.Verified() {
 			deploymentDomain = domain.Domain
 			break
 		}
@@ -512,6 +515,7 @@ func (s *DeploymentService) deployWithDockerCompose(ctx context.Context, deploym
 		}
 
 		s.logBuild(deployment.ID, "✓ Frontend image built successfully", "info")
+		s.snapshotImage(ctx, deployment, project)
 
 		// Restart only the frontend container
 		s.logBuild(deployment.ID, "Restarting frontend container...", "info")
@@ -520,6 +524,10 @@ func (s *DeploymentService) deployWithDockerCompose(ctx context.Context, deploym
 		}
 
 		s.logBuild(deployment.ID, "✓ Frontend restarted successfully", "info")
+
+		if err := s.checkComposeHealth(ctx, deployment, project, true); err != nil {
+			return err
+		}
 		s.logBuild(deployment.ID, "✓ PocketBase backend remains running (no downtime)", "info")
 	} else {
 		// First deployment: build and start everything
@@ -544,12 +552,17 @@ func (s *DeploymentService) deployWithDockerCompose(ctx context.Context, deploym
 		}
 
 		s.logBuild(deployment.ID, "✓ All images built successfully", "info")
+		s.snapshotImage(ctx, deployment, project)
 	}
 
 	// Step 2.5: Check if this is first-time setup BEFORE starting containers (only for first deployments)
 	var isFirstTimeSetup bool
 	var adminURL string
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if !isRedeployment {
 		// Only start containers and configure Caddy for first deployments
 		// pb_data is now in .runtime folder
@@ -576,6 +589,10 @@ func (s *DeploymentService) deployWithDockerCompose(ctx context.Context, deploym
 
 		s.logBuild(deployment.ID, "✓ All containers started successfully", "info")
 
+		if err := s.checkComposeHealth(ctx, deployment, project, false); err != nil {
+			return err
+		}
+
 		// Step 4: Configure Caddy reverse proxy for both services
 		s.logBuild(deployment.ID, "Configuring reverse proxy...", "info")
 		if err := s.caddyService.GenerateConfigWithPocketBase(project); err != nil {
@@ -583,15 +600,17 @@ func (s *DeploymentService) deployWithDockerCompose(ctx context.Context, deploym
 		}
 
 		if err := s.caddyService.Reload(); err != nil {
-			s.logBuild(deployment.ID, fmt.Sprintf("Warning: failed to reload Caddy: %v", err), "warning")
+			s.logBuild(deployment.ID, fmt.Sprintf("Warning: %v", err), "error")
 		} else {
 			s.logBuild(deployment.ID, "✓ Reverse proxy configured", "info")
 		}
+
+		s.watchCertificates(project, deployment.ID)
 	}
 
 	// Step 5: Display deployment information
-	for _, domain := range project.Domains {
-		if domain.IsActive {
+	for _, domain := range project.SiteDomains() {
+		if domain.IsActive && domain.Verified() {
 			protocol := "https"
 			if !domain.SSLEnabled {
 				protocol = "http"
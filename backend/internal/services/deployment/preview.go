@@ -0,0 +1,177 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// PullRequest is an opened or updated pull/merge request, as reported by a
+// Git provider's webhook
+type PullRequest struct {
+	Number     int
+	Title      string
+	URL        string
+	Branch     string // Head branch, in the project's repository
+	CommitHash string
+	Author     string
+}
+
+// checkoutDir returns the directory a project, or one of its previews or
+// environments, is cloned into
+func checkoutDir(project *models.Project) string {
+	if project.Preview != nil {
+		return fmt.Sprintf("project-%d-pr-%d", project.ID, project.Preview.Number)
+	}
+	if project.ProjectEnvironment != nil {
+		return fmt.Sprintf("project-%d-env-%d", project.ID, project.ProjectEnvironment.ID)
+	}
+	return fmt.Sprintf("project-%d", project.ID)
+}
+
+// DeployPreview queues a deployment of a pull request to its preview, which
+// is created on the first push and reopened if the pull request was closed
+func (s *DeploymentService) DeployPreview(projectID uint, pr PullRequest, triggeredBy string) (*models.Preview, *models.Deployment, error) {
+	var preview models.Preview
+	err := s.db.Where("project_id = ? AND number = ?", projectID, pr.Number).First(&preview).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("failed to load preview: %w", err)
+	}
+
+	preview.ProjectID = projectID
+	preview.Number = pr.Number
+	preview.Title = pr.Title
+	preview.URL = pr.URL
+	preview.Branch = pr.Branch
+	preview.CommitHash = pr.CommitHash
+	preview.Author = pr.Author
+	if preview.ID == 0 || preview.Status == models.PreviewClosed {
+		preview.Status = models.PreviewPending
+		preview.ClosedAt = nil
+	}
+
+	if err := s.db.Save(&preview).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to save preview: %w", err)
+	}
+
+	now := time.Now()
+	deployment := models.Deployment{
+		ProjectID:     projectID,
+		PreviewID:     &preview.ID,
+		CommitHash:    pr.CommitHash,
+		CommitMessage: fmt.Sprintf("Preview of #%d: %s", pr.Number, pr.Title),
+		CommitAuthor:  pr.Author,
+		Branch:        pr.Branch,
+		Status:        models.DeploymentPending,
+		TriggeredBy:   triggeredBy,
+		StartedAt:     &now,
+	}
+
+	if err := s.db.Create(&deployment).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create preview deployment: %w", err)
+	}
+
+	s.Enqueue(deployment.ID, projectID)
+	deployment.QueuePosition = s.QueuePosition(deployment.ID)
+
+	return &preview, &deployment, nil
+}
+
+// ClosePreview closes a preview and cancels its deployments. Its container,
+// image, checkout, Caddy site and domain are removed in the background, once
+// no deployment of the project is running anymore
+func (s *DeploymentService) ClosePreview(preview *models.Preview) error {
+	var project models.Project
+	if err := s.db.First(&project, preview.ProjectID).Error; err != nil {
+		return fmt.Errorf("failed to load project: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.db.Model(preview).Updates(map[string]interface{}{
+		"status":    models.PreviewClosed,
+		"closed_at": &now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to close preview: %w", err)
+	}
+
+	// Deploy refuses deployments of closed previews, so this only speeds things up
+	s.cancelUnfinished("preview_id", preview.ID)
+
+	target := project.ForPreview(preview)
+	go func() {
+		// A cancelled deployment could otherwise recreate what's being removed
+		s.queue.acquire(project.ID)
+		defer s.queue.finish(project.ID)
+
+		s.removePreview(&target)
+	}()
+
+	return nil
+}
+
+// removePreview takes down everything a preview's deployments set up
+func (s *DeploymentService) removePreview(project *models.Project) {
+	preview := project.Preview
+
+	// Reopened while waiting; its new deployment takes over what's there
+	var current models.Preview
+	if err := s.db.Select("id", "status").First(&current, preview.ID).Error; err == nil && current.Status != models.PreviewClosed {
+		return
+	}
+
+	s.removeSite(project)
+
+	// Deleted for good, so the subdomain can be created again if the pull request is reopened
+	s.db.Unscoped().Where("preview_id = ?", preview.ID).Delete(&models.Domain{})
+	s.db.Model(preview).Updates(map[string]interface{}{
+		"frontend_port": 0,
+		"backend_port":  0,
+	})
+
+	log.Printf("✓ Removed preview of pull request #%d (project %d)", preview.Number, project.ID)
+}
+
+// removeSite takes down the Caddy site, containers, latest image and checkout
+// of a project returned by ForPreview or ForEnvironment
+func (s *DeploymentService) removeSite(project *models.Project) {
+	ctx := context.Background()
+
+	// Stop routing traffic before the container goes away
+	if err := s.caddyService.RemoveProject(project); err != nil {
+		log.Printf("Warning: failed to remove Caddy site of %s: %v", project.Name, err)
+	} else if err := s.caddyService.Reload(); err != nil {
+		log.Printf("Warning: failed to reload Caddy: %v", err)
+	}
+
+	if err := s.dockerService.RemoveProjectContainers(ctx, project); err != nil {
+		log.Printf("Warning: failed to remove container of %s: %v", project.Name, err)
+	}
+	if err := s.dockerService.RemoveImage(ctx, latestImage(project)); err != nil {
+		log.Printf("Note: image of %s: %v", project.Name, err)
+	}
+	if err := s.gitService.Cleanup(checkoutDir(project)); err != nil {
+		log.Printf("Warning: failed to remove checkout of %s: %v", project.Name, err)
+	}
+}
+
+// cancelUnfinished cancels the pending and running deployments of a preview
+// or environment, selected by column
+func (s *DeploymentService) cancelUnfinished(column string, id uint) {
+	var unfinished []uint
+	s.db.Model(&models.Deployment{}).
+		Where(column+" = ? AND status IN ?", id, []models.DeploymentStatus{
+			models.DeploymentPending, models.DeploymentBuilding, models.DeploymentDeploying,
+		}).
+		Pluck("id", &unfinished)
+	for _, deploymentID := range unfinished {
+		if err := s.Cancel(deploymentID); err != nil && !errors.Is(err, ErrDeploymentNotCancellable) {
+			log.Printf("Warning: failed to cancel deployment %d: %v", deploymentID, err)
+		}
+	}
+}
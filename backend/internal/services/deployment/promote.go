@@ -0,0 +1,126 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// triggerPromote marks deployments that start another environment's release image instead of building
+const triggerPromote = "promote"
+
+// ErrPromoteSameEnvironment is returned when a deployment is promoted to the environment it was deployed to
+var ErrPromoteSameEnvironment = errors.New("deployment already belongs to this environment; roll back to it instead")
+
+// ErrPromotePreview is returned for deployments of pull request previews, which
+// build unreviewed code and have no environment of their own
+var ErrPromotePreview = errors.New("preview deployments can't be promoted; merge the pull request instead")
+
+// ErrPromoteUnsupported is returned for PocketBase projects, which have no environments
+var ErrPromoteUnsupported = errors.New("promotion isn't supported for PocketBase projects")
+
+// Promote queues a deployment that starts the image of a successful deployment
+// in another environment of the project (nil for production), with that
+// environment's variables, ports and domains
+func (s *DeploymentService) Promote(projectID, deploymentID uint, environmentID *uint, userID uint) (*models.Deployment, error) {
+	var source models.Deployment
+	if err := s.db.Preload("Project").Where("id = ? AND project_id = ?", deploymentID, projectID).First(&source).Error; err != nil {
+		return nil, fmt.Errorf("failed to load deployment: %w", err)
+	}
+
+	if source.Project.BaaSType == models.BaaSPocketBase {
+		return nil, ErrPromoteUnsupported
+	}
+	if source.Status != models.DeploymentSuccess || source.ImageTag == "" {
+		return nil, ErrRollbackUnavailable
+	}
+	if source.PreviewID != nil {
+		return nil, ErrPromotePreview
+	}
+	if sameEnvironment(source.ProjectEnvironmentID, environmentID) {
+		return nil, ErrPromoteSameEnvironment
+	}
+
+	now := time.Now()
+	promotion := models.Deployment{
+		ProjectID:            projectID,
+		CommitHash:           source.CommitHash,
+		CommitMessage:        fmt.Sprintf("Promotion of deployment #%d", source.ID),
+		CommitAuthor:         source.CommitAuthor,
+		Branch:               source.Branch,
+		Tag:                  source.Tag,
+		ImageTag:             source.ImageTag, // Replaced by the environment's own tag once it's deployed
+		Status:               models.DeploymentPending,
+		TriggeredBy:          triggerPromote,
+		TriggeredByID:        userID,
+		SourceDeploymentID:   &source.ID,
+		ProjectEnvironmentID: environmentID,
+		StartedAt:            &now,
+	}
+
+	if err := s.db.Create(&promotion).Error; err != nil {
+		return nil, fmt.Errorf("failed to create promotion deployment: %w", err)
+	}
+
+	s.Enqueue(promotion.ID, projectID)
+	promotion.QueuePosition = s.QueuePosition(promotion.ID)
+
+	return &promotion, nil
+}
+
+// executePromote starts the promoted image in the deployment's environment
+// The image is tagged into the environment's own repository first, so its
+// rollbacks and image pruning don't depend on the source environment
+func (s *DeploymentService) executePromote(ctx context.Context, deployment *models.Deployment, project *models.Project) error {
+	if project.BaaSType == models.BaaSPocketBase {
+		return ErrPromoteUnsupported
+	}
+
+	s.logBuild(deployment.ID, fmt.Sprintf("Promoting image %s (no rebuild)", deployment.ImageTag), "info")
+
+	imageRef := releaseImage(project, deployment)
+	if err := s.dockerService.TagImage(ctx, deployment.ImageTag, imageRef); err != nil {
+		return fmt.Errorf("failed to tag promoted image (it may have been pruned): %w", err)
+	}
+	deployment.ImageTag = imageRef
+	s.db.Model(deployment).Update("image_tag", imageRef)
+	s.logBuild(deployment.ID, fmt.Sprintf("✓ Release image tagged: %s", imageRef), "info")
+
+	deployment.Status = models.DeploymentDeploying
+	s.db.Save(&deployment)
+
+	// Environment variables are passed to the new container; values inlined
+	// into the build keep those of the source environment
+	s.logBuild(deployment.ID, fmt.Sprintf("Applying %d environment variable(s) of this environment", len(project.Environments)), "info")
+
+	// The environment may not have been deployed before
+	previous := livePorts{frontend: project.FrontendPort, backend: project.BackendPort}
+	if err := s.ensureAvailablePorts(project, deployment.ID); err != nil {
+		return fmt.Errorf("failed to ensure available ports: %w", err)
+	}
+	if err := s.ensureProjectDomain(project, deployment.ID); err != nil {
+		return fmt.Errorf("failed to ensure project domain: %w", err)
+	}
+
+	s.logBuild(deployment.ID, "Starting container from promoted image...", "info")
+	if err := s.swapContainer(ctx, deployment, project, imageRef, previous); err != nil {
+		return err
+	}
+
+	s.watchCertificates(project, deployment.ID)
+
+	s.logBuild(deployment.ID, "✓ Promotion complete", "info")
+	return nil
+}
+
+// sameEnvironment compares two environment IDs, nil standing for production
+// Previews have no environment ID either, so callers must rule them out first
+func sameEnvironment(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,309 @@
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// queuedDeployment is a deployment waiting for a free build slot
+type queuedDeployment struct {
+	ID            uint
+	ProjectID     uint
+	PreviewID     uint // 0 for deployments of the project itself
+	EnvironmentID uint // 0 for deployments to production
+}
+
+// newQueuedDeployment returns the queue entry of a deployment
+func newQueuedDeployment(deployment *models.Deployment) queuedDeployment {
+	item := queuedDeployment{ID: deployment.ID, ProjectID: deployment.ProjectID}
+	if deployment.PreviewID != nil {
+		item.PreviewID = *deployment.PreviewID
+	}
+	if deployment.ProjectEnvironmentID != nil {
+		item.EnvironmentID = *deployment.ProjectEnvironmentID
+	}
+	return item
+}
+
+// sameSite reports whether two deployments deploy the same site: the project's
+// own, or the same preview or environment of it
+func (item queuedDeployment) sameSite(other queuedDeployment) bool {
+	return item.ProjectID == other.ProjectID && item.PreviewID == other.PreviewID && item.EnvironmentID == other.EnvironmentID
+}
+
+// buildQueue is a FIFO of deployments waiting to be built
+// The database remains the source of truth: every queued deployment is a
+// "pending" row, so the queue can be rebuilt after a restart
+// Only one deployment per project is handed out at a time, since deployments
+// of the same project share a checkout directory and container names
+type buildQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []queuedDeployment
+	active map[uint]bool // projects with a deployment currently running
+}
+
+func newBuildQueue() *buildQueue {
+	q := &buildQueue{
+		active: make(map[uint]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push appends a deployment to the end of the queue
+func (q *buildQueue) push(item queuedDeployment) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, existing := range q.items {
+		if existing.ID == item.ID {
+			return
+		}
+	}
+
+	q.items = append(q.items, item)
+	q.cond.Broadcast()
+}
+
+// pop blocks until a deployment of an idle project is available, removes it
+// from the queue and marks its project as active until finish is called
+func (q *buildQueue) pop() queuedDeployment {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for i, item := range q.items {
+			if q.active[item.ProjectID] {
+				continue
+			}
+
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.active[item.ProjectID] = true
+			return item
+		}
+
+		q.cond.Wait()
+	}
+}
+
+// acquire blocks until no deployment of a project is running and holds the
+// project like a running deployment until finish is called
+func (q *buildQueue) acquire(projectID uint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.active[projectID] {
+		q.cond.Wait()
+	}
+	q.active[projectID] = true
+}
+
+// finish releases a project so its next queued deployment can run
+func (q *buildQueue) finish(projectID uint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.active, projectID)
+	q.cond.Broadcast()
+}
+
+// remove drops a deployment from the queue and reports whether it was queued
+func (q *buildQueue) remove(deploymentID uint) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.items {
+		if item.ID == deploymentID {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// removeOlder drops every queued deployment of the same site as newest, except
+// newest itself, and returns the removed deployments
+func (q *buildQueue) removeOlder(newest queuedDeployment) []queuedDeployment {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var removed []queuedDeployment
+	remaining := q.items[:0]
+	for _, item := range q.items {
+		if item.sameSite(newest) && item.ID != newest.ID {
+			removed = append(removed, item)
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	q.items = remaining
+
+	return removed
+}
+
+// position returns the 1-based queue position of a deployment, or 0 if it isn't queued
+func (q *buildQueue) position(deploymentID uint) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.items {
+		if item.ID == deploymentID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// snapshot returns a copy of the queued deployments in order
+func (q *buildQueue) snapshot() []queuedDeployment {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]queuedDeployment, len(q.items))
+	copy(items, q.items)
+	return items
+}
+
+// Start restores pending deployments from the database and starts the build workers
+// At most MAX_CONCURRENT_BUILDS deployments are built at the same time
+func (s *DeploymentService) Start() {
+	s.restoreQueue()
+
+	workers := s.cfg.MaxConcurrentBuilds
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+
+	log.Printf("✓ Build queue started (%d concurrent builds, %ds timeout)", workers, s.cfg.BuildTimeout)
+}
+
+// Enqueue adds a pending deployment to the build queue
+// Every trigger (manual, webhooks) goes through here so the project's
+// deployment policy is applied uniformly
+func (s *DeploymentService) Enqueue(deploymentID, projectID uint) {
+	item := queuedDeployment{ID: deploymentID, ProjectID: projectID}
+	var deployment models.Deployment
+	if err := s.db.Select("id", "project_id", "preview_id", "project_environment_id").First(&deployment, deploymentID).Error; err == nil {
+		item = newQueuedDeployment(&deployment)
+	}
+	s.queue.push(item)
+
+	var project models.Project
+	if err := s.db.Select("id", "deployment_policy").First(&project, projectID).Error; err != nil {
+		log.Printf("Warning: failed to load deployment policy for project %d: %v", projectID, err)
+	} else if project.DeploymentPolicy == models.DeploymentPolicySupersede {
+		s.supersedePending(item)
+	}
+
+	s.broadcastQueuePositions()
+}
+
+// supersedePending cancels older queued deployments of a project so only the newest commit gets built
+// A deployment that is already running is left alone and the newest one runs after it
+// Previews and environments are superseded by newer deployments of the same preview or environment only
+func (s *DeploymentService) supersedePending(newest queuedDeployment) {
+	for _, item := range s.queue.removeOlder(newest) {
+		now := time.Now()
+		result := s.db.Model(&models.Deployment{}).
+			Where("id = ? AND status = ?", item.ID, models.DeploymentPending).
+			Updates(map[string]interface{}{
+				"status":       models.DeploymentCancelled,
+				"completed_at": &now,
+			})
+		if result.Error != nil {
+			log.Printf("Warning: failed to supersede deployment %d: %v", item.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		s.logBuild(item.ID, fmt.Sprintf("Superseded by newer deployment #%d", newest.ID), "warning")
+		if s.wsHub != nil {
+			s.wsHub.BroadcastDeploymentStatus(item.ID, item.ProjectID, string(models.DeploymentCancelled), "")
+		}
+	}
+}
+
+// QueuePosition returns the 1-based queue position of a deployment, or 0 if it isn't waiting
+func (s *DeploymentService) QueuePosition(deploymentID uint) int {
+	return s.queue.position(deploymentID)
+}
+
+// worker builds queued deployments one at a time
+func (s *DeploymentService) worker() {
+	for {
+		item := s.queue.pop()
+		s.broadcastQueuePositions()
+
+		if err := s.Deploy(item.ID); err != nil {
+			if errors.Is(err, ErrDeploymentCancelled) {
+				log.Printf("Deployment %d was cancelled", item.ID)
+			} else if errors.Is(err, ErrDeploymentSkipped) {
+				log.Printf("Deployment %d was skipped by path filters", item.ID)
+			} else {
+				log.Printf("Deployment %d failed: %v", item.ID, err)
+			}
+		} else {
+			log.Printf("Deployment %d completed successfully (project %d)", item.ID, item.ProjectID)
+		}
+
+		s.queue.finish(item.ProjectID)
+	}
+}
+
+// restoreQueue re-queues pending deployments left over from a previous run
+// Deployments that were mid-build when the server stopped can't be resumed and are marked failed
+func (s *DeploymentService) restoreQueue() {
+	now := time.Now()
+	result := s.db.Model(&models.Deployment{}).
+		Where("status IN ?", []models.DeploymentStatus{models.DeploymentBuilding, models.DeploymentDeploying}).
+		Updates(map[string]interface{}{
+			"status":        models.DeploymentFailed,
+			"error_message": "Deployment interrupted by server restart",
+			"completed_at":  &now,
+		})
+	if result.Error != nil {
+		log.Printf("Warning: failed to mark interrupted deployments as failed: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Marked %d interrupted deployment(s) as failed", result.RowsAffected)
+	}
+
+	var pending []models.Deployment
+	if err := s.db.Select("id", "project_id", "preview_id", "project_environment_id").
+		Where("status = ?", models.DeploymentPending).
+		Order("created_at ASC").
+		Find(&pending).Error; err != nil {
+		log.Printf("Warning: failed to restore pending deployments: %v", err)
+		return
+	}
+
+	for i := range pending {
+		s.queue.push(newQueuedDeployment(&pending[i]))
+	}
+
+	if len(pending) > 0 {
+		log.Printf("Restored %d pending deployment(s) to the build queue", len(pending))
+	}
+}
+
+// broadcastQueuePositions notifies clients of the current position of every queued deployment
+func (s *DeploymentService) broadcastQueuePositions() {
+	if s.wsHub == nil {
+		return
+	}
+
+	for i, item := range s.queue.snapshot() {
+		s.wsHub.BroadcastQueuePosition(item.ID, item.ProjectID, i+1)
+	}
+}
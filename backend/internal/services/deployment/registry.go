@@ -0,0 +1,44 @@
+package deployment
+
+import (
+	"context"
+	"sync"
+)
+
+// deploymentRegistry tracks in-flight deployments so they can be cancelled
+type deploymentRegistry struct {
+	mu      sync.Mutex
+	cancels map[uint]context.CancelFunc
+}
+
+func newDeploymentRegistry() *deploymentRegistry {
+	return &deploymentRegistry{
+		cancels: make(map[uint]context.CancelFunc),
+	}
+}
+
+// register stores the cancel func for a running deployment
+func (r *deploymentRegistry) register(deploymentID uint, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[deploymentID] = cancel
+}
+
+// unregister removes a deployment once it has finished
+func (r *deploymentRegistry) unregister(deploymentID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, deploymentID)
+}
+
+// cancel aborts a running deployment and reports whether it was found
+func (r *deploymentRegistry) cancel(deploymentID uint) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[deploymentID]
+	r.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
@@ -0,0 +1,194 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+// triggerRollback marks deployments that restart a previous release instead of building
+const triggerRollback = "rollback"
+
+// ErrRollbackUnavailable is returned when a deployment has no retained image to roll back to
+var ErrRollbackUnavailable = errors.New("deployment has no image available for rollback")
+
+// imageRepository returns the repository holding a project's release images
+// For PocketBase projects only the frontend image is versioned; the PocketBase
+// backend keeps running across deployments and holds the project's data
+// Previews and environments build into repositories of their own
+func imageRepository(project *models.Project) string {
+	if project.Preview != nil {
+		return fmt.Sprintf("vps-panel/project-%d-pr-%d", project.ID, project.Preview.Number)
+	}
+	if project.ProjectEnvironment != nil {
+		return fmt.Sprintf("vps-panel/project-%d-env-%d", project.ID, project.ProjectEnvironment.ID)
+	}
+	if project.BaaSType == models.BaaSPocketBase {
+		return fmt.Sprintf("vps-panel/project-%d-frontend", project.ID)
+	}
+	return fmt.Sprintf("vps-panel/project-%d", project.ID)
+}
+
+// latestImage returns the mutable image reference a build writes to
+func latestImage(project *models.Project) string {
+	return imageRepository(project) + ":latest"
+}
+
+// releaseImage returns the immutable image reference for a deployment (commit hash + deployment ID)
+func releaseImage(project *models.Project, deployment *models.Deployment) string {
+	tag := fmt.Sprintf("deploy-%d", deployment.ID)
+	if len(deployment.CommitHash) >= 7 {
+		tag = fmt.Sprintf("%s-%d", deployment.CommitHash[:7], deployment.ID)
+	}
+	return fmt.Sprintf("%s:%s", imageRepository(project), tag)
+}
+
+// snapshotImage tags the freshly built image with an immutable tag and records it on the deployment
+func (s *DeploymentService) snapshotImage(ctx context.Context, deployment *models.Deployment, project *models.Project) {
+	imageRef := releaseImage(project, deployment)
+	if err := s.dockerService.TagImage(ctx, latestImage(project), imageRef); err != nil {
+		s.logBuild(deployment.ID, fmt.Sprintf("Warning: failed to tag release image (rollback to this deployment won't be possible): %v", err), "warning")
+		return
+	}
+
+	deployment.ImageTag = imageRef
+	s.db.Model(deployment).Update("image_tag", imageRef)
+	s.logBuild(deployment.ID, fmt.Sprintf("✓ Release image tagged: %s", imageRef), "info")
+}
+
+// pruneImages removes release images beyond the IMAGE_RETENTION newest ones for a project
+// (or the environment it was returned for by ForEnvironment)
+func (s *DeploymentService) pruneImages(ctx context.Context, project *models.Project) {
+	keep := s.cfg.ImageRetention
+	if keep < 1 {
+		keep = 1
+	}
+
+	var releases []models.Deployment
+	if err := s.db.Select("id", "image_tag").Scopes(deploymentsOf(project)).
+		Where("status = ? AND image_tag <> ''", models.DeploymentSuccess).
+		Order("created_at DESC").
+		Find(&releases).Error; err != nil {
+		log.Printf("Warning: failed to list release images for project %d: %v", project.ID, err)
+		return
+	}
+
+	// Rollbacks reuse their source image, so count distinct images
+	seen := make(map[string]bool)
+	var expired []string
+	for _, release := range releases {
+		if seen[release.ImageTag] {
+			continue
+		}
+		seen[release.ImageTag] = true
+		if len(seen) > keep {
+			expired = append(expired, release.ImageTag)
+		}
+	}
+
+	for _, imageRef := range expired {
+		if err := s.dockerService.RemoveImage(ctx, imageRef); err != nil {
+			log.Printf("Warning: failed to remove old release image %s: %v", imageRef, err)
+		}
+		s.db.Model(&models.Deployment{}).Scopes(deploymentsOf(project)).
+			Where("image_tag = ?", imageRef).
+			Update("image_tag", "")
+	}
+
+	if len(expired) > 0 {
+		log.Printf("Removed %d old release image(s) for project %d", len(expired), project.ID)
+	}
+}
+
+// Rollback queues a deployment that restarts the project from a previous successful deployment's image
+// Deployments of an environment are rolled back in that environment
+func (s *DeploymentService) Rollback(projectID, deploymentID, userID uint) (*models.Deployment, error) {
+	var source models.Deployment
+	if err := s.db.Where("id = ? AND project_id = ?", deploymentID, projectID).First(&source).Error; err != nil {
+		return nil, fmt.Errorf("failed to load deployment: %w", err)
+	}
+
+	if source.Status != models.DeploymentSuccess || source.ImageTag == "" {
+		return nil, ErrRollbackUnavailable
+	}
+
+	now := time.Now()
+	rollback := models.Deployment{
+		ProjectID:            projectID,
+		CommitHash:           source.CommitHash,
+		CommitMessage:        fmt.Sprintf("Rollback to deployment #%d", source.ID),
+		CommitAuthor:         source.CommitAuthor,
+		Branch:               source.Branch,
+		Tag:                  source.Tag,
+		ImageTag:             source.ImageTag,
+		Status:               models.DeploymentPending,
+		TriggeredBy:          triggerRollback,
+		TriggeredByID:        userID,
+		SourceDeploymentID:   &source.ID,
+		ProjectEnvironmentID: source.ProjectEnvironmentID,
+		StartedAt:            &now,
+	}
+
+	if err := s.db.Create(&rollback).Error; err != nil {
+		return nil, fmt.Errorf("failed to create rollback deployment: %w", err)
+	}
+
+	s.Enqueue(rollback.ID, projectID)
+	rollback.QueuePosition = s.QueuePosition(rollback.ID)
+
+	return &rollback, nil
+}
+
+// executeRollback restarts the project from a retained image without cloning or building
+func (s *DeploymentService) executeRollback(ctx context.Context, deployment *models.Deployment, project *models.Project) error {
+	s.logBuild(deployment.ID, fmt.Sprintf("Rolling back to image %s (no rebuild)", deployment.ImageTag), "info")
+
+	deployment.Status = models.DeploymentDeploying
+	s.db.Save(&deployment)
+
+	if project.BaaSType != models.BaaSPocketBase {
+		// The release image is started next to the running container, so it needs free ports
+		previous := livePorts{frontend: project.FrontendPort, backend: project.BackendPort}
+		if err := s.ensureAvailablePorts(project, deployment.ID); err != nil {
+			return fmt.Errorf("failed to ensure available ports: %w", err)
+		}
+
+		s.logBuild(deployment.ID, "Starting container from release image...", "info")
+		if err := s.swapContainer(ctx, deployment, project, deployment.ImageTag, previous); err != nil {
+			return err
+		}
+
+		s.logBuild(deployment.ID, "✓ Rollback complete", "info")
+		return nil
+	}
+
+	// Point the compose frontend image at the old release and restart only the frontend
+	if err := s.dockerService.TagImage(ctx, deployment.ImageTag, latestImage(project)); err != nil {
+		return fmt.Errorf("failed to restore release image: %w", err)
+	}
+
+	projectName := fmt.Sprintf("vps-panel-project-%d", project.ID)
+	workDir := filepath.Join(s.cfg.ProjectsDir, fmt.Sprintf("project-%d", project.ID))
+
+	s.logBuild(deployment.ID, "Restarting frontend container...", "info")
+	if err := s.dockerService.ComposeRestartService(ctx, workDir, projectName, "frontend"); err != nil {
+		return fmt.Errorf("failed to restart frontend: %w", err)
+	}
+
+	s.logBuild(deployment.ID, "Updating reverse proxy configuration...", "info")
+	if err := s.caddyService.GenerateConfigWithPocketBase(project); err != nil {
+		return fmt.Errorf("failed to generate Caddy config: %w", err)
+	}
+
+	if err := s.caddyService.Reload(); err != nil {
+		s.logBuild(deployment.ID, fmt.Sprintf("Warning: %v", err), "error")
+	}
+
+	s.logBuild(deployment.ID, "✓ Rollback complete", "info")
+	return nil
+}
@@ -0,0 +1,148 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/services/docker"
+)
+
+// livePorts are the host ports the currently serving container is bound to
+type livePorts struct {
+	frontend int
+	backend  int
+}
+
+// swapContainer replaces the project's container without downtime (blue/green)
+// The new container is started next to the live one on the ports allocated for this
+// deployment; Caddy is only pointed at it once it passes a health probe, and the
+// old container is removed last. If the new container never becomes healthy the
+// swap is aborted and the old container keeps serving traffic
+func (s *DeploymentService) swapContainer(ctx context.Context, deployment *models.Deployment, project *models.Project, imageName string, previous livePorts) error {
+	if !s.dockerService.IsContainerRunning(ctx, docker.ContainerName(project)) {
+		// Nothing is serving yet, so there is nothing to keep alive
+		return s.replaceContainer(ctx, deployment, project, imageName)
+	}
+
+	s.logBuild(deployment.ID, fmt.Sprintf("Starting new container alongside the running one (port %d)...", project.FrontendPort), "info")
+
+	standbyID, err := s.dockerService.CreateStandbyContainer(ctx, project, imageName)
+	if err != nil {
+		s.restorePorts(project, previous)
+		return portConflictError(project, err, "failed to create container")
+	}
+
+	// abort leaves the live container and Caddy untouched and discards the new container
+	abort := func(reason error) error {
+		if err := s.dockerService.RemoveContainer(context.Background(), standbyID); err != nil {
+			log.Printf("Warning: failed to remove standby container for project %d: %v", project.ID, err)
+		}
+		s.restorePorts(project, previous)
+		s.logBuild(deployment.ID, "Swap aborted - the previous version is still serving traffic", "warning")
+		return reason
+	}
+
+	if err := s.dockerService.StartContainer(ctx, standbyID); err != nil {
+		return abort(portConflictError(project, err, "failed to start container"))
+	}
+
+	s.logBuild(deployment.ID, "Waiting for new container to become healthy...", "info")
+	if err := s.waitForHealthy(ctx, deployment.ID, standbyID, project.FrontendPort, healthCheckFor(project)); err != nil {
+		if ctx.Err() == nil {
+			s.captureContainerLogs(deployment.ID, standbyID)
+		}
+		return abort(fmt.Errorf("new container failed health check: %w", err))
+	}
+	s.logBuild(deployment.ID, "✓ New container is healthy", "info")
+
+	// Switch traffic to the new container
+	s.logBuild(deployment.ID, "Switching reverse proxy to new container...", "info")
+	if err := s.caddyService.GenerateConfig(project); err != nil {
+		return abort(fmt.Errorf("failed to generate Caddy config: %w", err))
+	}
+
+	if err := s.caddyService.Reload(); err != nil {
+		// Reload restored the config routing to the old container, so it can keep serving
+		return abort(err)
+	}
+
+	// Only now is it safe to retire the old container
+	if err := s.dockerService.PromoteStandbyContainer(context.Background(), project, standbyID); err != nil {
+		s.logBuild(deployment.ID, fmt.Sprintf("Warning: %v", err), "warning")
+	}
+
+	s.logBuild(deployment.ID, "✓ Traffic switched to new container, previous container removed", "info")
+	return nil
+}
+
+// replaceContainer starts the project's container when no previous one is running
+func (s *DeploymentService) replaceContainer(ctx context.Context, deployment *models.Deployment, project *models.Project, imageName string) error {
+	containerID, err := s.dockerService.CreateContainer(ctx, project, imageName)
+	if err != nil {
+		return portConflictError(project, err, "failed to create container")
+	}
+
+	if err := s.dockerService.StartContainer(ctx, containerID); err != nil {
+		// Clean up the created container
+		s.dockerService.RemoveContainer(ctx, docker.ContainerName(project))
+		return portConflictError(project, err, "failed to start container")
+	}
+
+	s.logBuild(deployment.ID, "Waiting for container to become healthy...", "info")
+	if err := s.waitForHealthy(ctx, deployment.ID, containerID, project.FrontendPort, healthCheckFor(project)); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+
+		s.captureContainerLogs(deployment.ID, containerID)
+		if project.HealthCheckRollback {
+			s.restorePreviousImage(ctx, deployment, project)
+		}
+		return fmt.Errorf("container failed health check: %w", err)
+	}
+	s.logBuild(deployment.ID, "✓ Container is healthy", "info")
+
+	s.logBuild(deployment.ID, "Updating reverse proxy configuration...", "info")
+	if err := s.caddyService.GenerateConfig(project); err != nil {
+		return fmt.Errorf("failed to generate Caddy config: %w", err)
+	}
+
+	if err := s.caddyService.Reload(); err != nil {
+		s.logBuild(deployment.ID, fmt.Sprintf("Warning: %v", err), "error")
+	}
+
+	return nil
+}
+
+// restorePorts puts back the ports of the container that is still serving traffic
+func (s *DeploymentService) restorePorts(project *models.Project, previous livePorts) {
+	if project.FrontendPort == previous.frontend && project.BackendPort == previous.backend {
+		return
+	}
+
+	project.FrontendPort = previous.frontend
+	project.BackendPort = previous.backend
+	if err := s.savePorts(project); err != nil {
+		log.Printf("Warning: failed to restore ports for project %d: %v", project.ID, err)
+	}
+}
+
+// portConflictError turns "address already in use" errors into a message pointing at the project's ports
+func portConflictError(project *models.Project, err error, action string) error {
+	if !strings.Contains(err.Error(), "address already in use") {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+
+	portMsg := ""
+	if project.FrontendPort > 0 && project.BackendPort > 0 {
+		portMsg = fmt.Sprintf("frontend port %d or backend port %d", project.FrontendPort, project.BackendPort)
+	} else if project.FrontendPort > 0 {
+		portMsg = fmt.Sprintf("port %d", project.FrontendPort)
+	} else if project.BackendPort > 0 {
+		portMsg = fmt.Sprintf("port %d", project.BackendPort)
+	}
+	return fmt.Errorf("port conflict: %s is already in use. Please use a different port for your project", portMsg)
+}
@@ -0,0 +1,235 @@
+package dnscheck
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vps-panel/backend/internal/config"
+)
+
+// Resolver is the part of *net.Resolver the verifier uses, so tests can fake DNS
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+const (
+	// RecordLabel is prepended to a domain for the TXT record proving ownership
+	RecordLabel = "_vps-panel-verify"
+	valuePrefix = "vps-panel-verify="
+
+	lookupTimeout = 10 * time.Second
+)
+
+// Verifier checks that a domain belongs to the user and points at this server
+//
+// Ownership is proven with a TXT record holding the domain's token. DNS is
+// ready once every A/AAAA address of the domain is one of the server's, taken
+// from SERVER_IPS or, if unset, from the addresses of PANEL_DOMAIN.
+type Verifier struct {
+	resolver    Resolver
+	serverIPs   []string
+	panelDomain string
+}
+
+// NewVerifier creates a verifier using the system resolver
+func NewVerifier(cfg *config.Config) *Verifier {
+	return NewVerifierWithResolver(cfg, net.DefaultResolver)
+}
+
+// NewVerifierWithResolver creates a verifier that looks records up with resolver
+func NewVerifierWithResolver(cfg *config.Config, resolver Resolver) *Verifier {
+	v := &Verifier{
+		resolver:    resolver,
+		panelDomain: normalize(stripURL(cfg.PanelDomain)),
+	}
+	for _, ip := range strings.Split(cfg.ServerIPs, ",") {
+		if parsed := net.ParseIP(strings.TrimSpace(ip)); parsed != nil {
+			v.serverIPs = append(v.serverIPs, parsed.String())
+		}
+	}
+	return v
+}
+
+// Result is the outcome of a domain check
+type Result struct {
+	Domain            string   `json:"domain"`
+	Ownership         bool     `json:"ownership"` // TXT record matches the token
+	DNSReady          bool     `json:"dns_ready"` // All addresses point at this server
+	Addresses         []string `json:"addresses"`
+	CNAME             string   `json:"cname,omitempty"`
+	ExpectedAddresses []string `json:"expected_addresses"`
+	Errors            []string `json:"errors"`
+}
+
+// Verified reports whether the domain passed both checks
+func (r *Result) Verified() bool {
+	return r.Ownership && r.DNSReady
+}
+
+// Error summarizes the failed checks
+func (r *Result) Error() string {
+	return strings.Join(r.Errors, "; ")
+}
+
+// NewToken generates a verification token
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Record returns the name and value of the TXT record proving ownership of domain
+// Wildcard domains are verified on their base domain
+func Record(domain, token string) (name, value string) {
+	return RecordLabel + "." + baseDomain(domain), valuePrefix + token
+}
+
+// IsPanelSubdomain reports whether domain is a subdomain of the panel domain,
+// like the ones generated for projects without a custom domain
+func (v *Verifier) IsPanelSubdomain(domain string) bool {
+	return v.panelDomain != "" && strings.HasSuffix(normalize(domain), "."+v.panelDomain)
+}
+
+// CoversPanel reports whether a certificate name is the panel domain itself
+// or a wildcard for its subdomains, which belong to every project
+func (v *Verifier) CoversPanel(name string) bool {
+	name = normalize(name)
+	return v.panelDomain != "" && (name == v.panelDomain || name == "*."+v.panelDomain)
+}
+
+// Check verifies the ownership record and the DNS addresses of domain
+func (v *Verifier) Check(ctx context.Context, domain, token string) *Result {
+	result := v.CheckDNS(ctx, domain)
+
+	name, value := Record(domain, token)
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	records, err := v.resolver.LookupTXT(lookupCtx, name)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("TXT record %s not found: %v", name, lookupError(err)))
+		return result
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == value {
+			result.Ownership = true
+			return result
+		}
+	}
+	result.Errors = append(result.Errors, fmt.Sprintf("TXT record %s does not contain %s", name, value))
+	return result
+}
+
+// CheckDNS checks that the A/AAAA records of domain point at this server
+func (v *Verifier) CheckDNS(ctx context.Context, domain string) *Result {
+	host := baseDomain(domain)
+	result := &Result{
+		Domain:    domain,
+		Addresses: []string{},
+		Errors:    []string{},
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	if cname, err := v.resolver.LookupCNAME(lookupCtx, host); err == nil && normalize(cname) != host {
+		result.CNAME = normalize(cname)
+	}
+
+	addrs, err := v.resolver.LookupIPAddr(lookupCtx, host)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s does not resolve: %v", host, lookupError(err)))
+		return result
+	}
+	for _, addr := range addrs {
+		result.Addresses = append(result.Addresses, addr.IP.String())
+	}
+	sort.Strings(result.Addresses)
+
+	expected := v.serverAddresses(lookupCtx)
+	result.ExpectedAddresses = expected
+	if len(result.Addresses) == 0 {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s has no A or AAAA records", host))
+		return result
+	}
+	if len(expected) == 0 {
+		// Nothing to compare against; resolving at all is the best we can check
+		result.DNSReady = true
+		return result
+	}
+
+	ours := make(map[string]bool, len(expected))
+	for _, ip := range expected {
+		ours[ip] = true
+	}
+	var foreign []string
+	for _, ip := range result.Addresses {
+		if !ours[ip] {
+			foreign = append(foreign, ip)
+		}
+	}
+	if len(foreign) > 0 {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s points at %s instead of %s",
+			host, strings.Join(foreign, ", "), strings.Join(expected, ", ")))
+		return result
+	}
+
+	result.DNSReady = true
+	return result
+}
+
+// serverAddresses returns the public addresses of this server
+func (v *Verifier) serverAddresses(ctx context.Context) []string {
+	if len(v.serverIPs) > 0 || v.panelDomain == "" {
+		return v.serverIPs
+	}
+
+	addrs, err := v.resolver.LookupIPAddr(ctx, v.panelDomain)
+	if err != nil {
+		return nil
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// lookupError shortens resolver errors to what's useful to a user
+func lookupError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return "no such record"
+	}
+	return err.Error()
+}
+
+func baseDomain(domain string) string {
+	return strings.TrimPrefix(normalize(domain), "*.")
+}
+
+func normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// stripURL removes the scheme and port from a panel domain setting
+func stripURL(domain string) string {
+	domain = strings.TrimPrefix(domain, "http://")
+	domain = strings.TrimPrefix(domain, "https://")
+	if idx := strings.Index(domain, ":"); idx != -1 {
+		domain = domain[:idx]
+	}
+	return domain
+}
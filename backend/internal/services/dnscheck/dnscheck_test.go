@@ -0,0 +1,220 @@
+package dnscheck
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vps-panel/backend/internal/config"
+)
+
+// fakeResolver answers from fixed records; names without records don't exist
+type fakeResolver struct {
+	addrs  map[string][]string
+	cnames map[string]string
+	txt    map[string][]string
+	looked []string // names looked up, in order
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.looked = append(r.looked, "A "+host)
+	ips, ok := r.addrs[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func (r *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if cname, ok := r.cnames[host]; ok {
+		return cname, nil
+	}
+	return host + ".", nil
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.looked = append(r.looked, "TXT "+name)
+	records, ok := r.txt[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestCheckOwnership(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		want    bool
+		wantErr string
+	}{
+		{"matching record", []string{"vps-panel-verify=token"}, true, ""},
+		{"among other records", []string{"v=spf1 -all", " vps-panel-verify=token "}, true, ""},
+		{"other token", []string{"vps-panel-verify=other"}, false, "does not contain vps-panel-verify=token"},
+		{"no record", nil, false, "not found: no such record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{
+				addrs: map[string][]string{"app.example.com": {"203.0.113.10"}},
+				txt:   map[string][]string{},
+			}
+			if tt.records != nil {
+				resolver.txt["_vps-panel-verify.app.example.com"] = tt.records
+			}
+			v := NewVerifierWithResolver(&config.Config{ServerIPs: "203.0.113.10"}, resolver)
+
+			result := v.Check(context.Background(), "app.example.com", "token")
+			if result.Ownership != tt.want {
+				t.Errorf("Ownership = %v, want %v", result.Ownership, tt.want)
+			}
+			if result.Verified() != tt.want {
+				t.Errorf("Verified() = %v, want %v", result.Verified(), tt.want)
+			}
+			if tt.wantErr != "" && !strings.Contains(result.Error(), tt.wantErr) {
+				t.Errorf("Error() = %q, want it to contain %q", result.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDNSAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		addrs   []string
+		ready   bool
+		wantErr string
+	}{
+		{"all ours", []string{"203.0.113.10", "2001:db8::10"}, true, ""},
+		{"foreign address", []string{"203.0.113.10", "198.51.100.7"}, false, "points at 198.51.100.7 instead of"},
+		{"only foreign", []string{"198.51.100.7"}, false, "points at 198.51.100.7"},
+		{"no records", []string{}, false, "has no A or AAAA records"},
+		{"does not resolve", nil, false, "does not resolve: no such record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{addrs: map[string][]string{}}
+			if tt.addrs != nil {
+				resolver.addrs["app.example.com"] = tt.addrs
+			}
+			v := NewVerifierWithResolver(&config.Config{ServerIPs: "203.0.113.10, 2001:db8::10, not-an-ip"}, resolver)
+
+			result := v.CheckDNS(context.Background(), "app.example.com")
+			if result.DNSReady != tt.ready {
+				t.Errorf("DNSReady = %v, want %v (errors: %v)", result.DNSReady, tt.ready, result.Errors)
+			}
+			if tt.wantErr != "" && !strings.Contains(result.Error(), tt.wantErr) {
+				t.Errorf("Error() = %q, want it to contain %q", result.Error(), tt.wantErr)
+			}
+			// Unparseable SERVER_IPS entries are dropped
+			if want := []string{"203.0.113.10", "2001:db8::10"}; tt.addrs != nil && !reflect.DeepEqual(result.ExpectedAddresses, want) {
+				t.Errorf("ExpectedAddresses = %v, want %v", result.ExpectedAddresses, want)
+			}
+		})
+	}
+}
+
+func TestCheckWildcardUsesBaseDomain(t *testing.T) {
+	resolver := &fakeResolver{
+		addrs:  map[string][]string{"example.com": {"203.0.113.10"}},
+		cnames: map[string]string{"example.com": "lb.example.net."},
+		txt:    map[string][]string{"_vps-panel-verify.example.com": {"vps-panel-verify=token"}},
+	}
+	v := NewVerifierWithResolver(&config.Config{ServerIPs: "203.0.113.10"}, resolver)
+
+	result := v.Check(context.Background(), "*.Example.com.", "token")
+	if !result.Verified() {
+		t.Fatalf("wildcard not verified: %v", result.Errors)
+	}
+	if result.Domain != "*.Example.com." {
+		t.Errorf("Domain = %q, want the domain as given", result.Domain)
+	}
+	if result.CNAME != "lb.example.net" {
+		t.Errorf("CNAME = %q, want lb.example.net", result.CNAME)
+	}
+	for _, name := range resolver.looked {
+		if strings.Contains(name, "*") {
+			t.Errorf("looked up %q, want only the base domain", name)
+		}
+	}
+
+	if name, value := Record("*.example.com", "token"); name != "_vps-panel-verify.example.com" || value != "vps-panel-verify=token" {
+		t.Errorf("Record = %q, %q", name, value)
+	}
+}
+
+func TestServerAddressesFallBackToPanelDomain(t *testing.T) {
+	resolver := &fakeResolver{
+		addrs: map[string][]string{
+			"panel.example.com": {"203.0.113.20", "203.0.113.10"},
+			"app.example.com":   {"203.0.113.10"},
+			"other.example.com": {"198.51.100.7"},
+		},
+	}
+
+	// PANEL_DOMAIN may be set as a URL with scheme and port
+	v := NewVerifierWithResolver(&config.Config{PanelDomain: "https://Panel.example.com:8443"}, resolver)
+
+	result := v.CheckDNS(context.Background(), "app.example.com")
+	if !result.DNSReady {
+		t.Errorf("app.example.com not ready: %v", result.Errors)
+	}
+	if want := []string{"203.0.113.10", "203.0.113.20"}; !reflect.DeepEqual(result.ExpectedAddresses, want) {
+		t.Errorf("ExpectedAddresses = %v, want %v", result.ExpectedAddresses, want)
+	}
+
+	if result := v.CheckDNS(context.Background(), "other.example.com"); result.DNSReady {
+		t.Error("other.example.com is ready, want its foreign address refused")
+	}
+
+	// SERVER_IPS takes precedence over the panel domain's addresses
+	v = NewVerifierWithResolver(&config.Config{PanelDomain: "panel.example.com", ServerIPs: "198.51.100.7"}, resolver)
+	if result := v.CheckDNS(context.Background(), "other.example.com"); !result.DNSReady {
+		t.Errorf("other.example.com not ready with SERVER_IPS: %v", result.Errors)
+	}
+
+	// With neither set, resolving at all is enough
+	v = NewVerifierWithResolver(&config.Config{}, resolver)
+	if result := v.CheckDNS(context.Background(), "other.example.com"); !result.DNSReady || len(result.ExpectedAddresses) > 0 {
+		t.Errorf("other.example.com = %+v, want ready without expected addresses", result)
+	}
+}
+
+func TestPanelDomains(t *testing.T) {
+	v := NewVerifierWithResolver(&config.Config{PanelDomain: "http://panel.example.com"}, &fakeResolver{})
+
+	for domain, want := range map[string]bool{
+		"app.panel.example.com":  true,
+		"APP.panel.example.com.": true,
+		"panel.example.com":      false,
+		"app.example.com":        false,
+		"apppanel.example.com":   false,
+	} {
+		if got := v.IsPanelSubdomain(domain); got != want {
+			t.Errorf("IsPanelSubdomain(%q) = %v, want %v", domain, got, want)
+		}
+	}
+
+	for name, want := range map[string]bool{
+		"panel.example.com":     true,
+		"*.panel.example.com":   true,
+		"app.panel.example.com": false,
+		"*.example.com":         false,
+	} {
+		if got := v.CoversPanel(name); got != want {
+			t.Errorf("CoversPanel(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	if v := NewVerifierWithResolver(&config.Config{}, &fakeResolver{}); v.IsPanelSubdomain("app.panel.example.com") {
+		t.Error("IsPanelSubdomain without a panel domain = true")
+	}
+}
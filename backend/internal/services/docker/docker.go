@@ -3,6 +3,7 @@ package docker
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,10 +12,13 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 
 	"github.com/vps-panel/backend/internal/models"
@@ -64,6 +68,10 @@ func (s *DockerService) BuildImage(ctx context.Context, buildPath string, imageN
 
 	scanner := bufio.NewScanner(response.Body)
 	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		line := scanner.Text()
 
 		// Parse JSON to get the actual output
@@ -93,6 +101,22 @@ func (s *DockerService) BuildImage(ctx context.Context, buildPath string, imageN
 	return nil
 }
 
+// TagImage adds an additional tag (target) to an existing image (source)
+func (s *DockerService) TagImage(ctx context.Context, source, target string) error {
+	if err := s.client.ImageTag(ctx, source, target); err != nil {
+		return fmt.Errorf("failed to tag image %s as %s: %w", source, target, err)
+	}
+	return nil
+}
+
+// RemoveImage removes an image reference. If the image has other tags only this tag is removed
+func (s *DockerService) RemoveImage(ctx context.Context, imageRef string) error {
+	if _, err := s.client.ImageRemove(ctx, imageRef, image.RemoveOptions{PruneChildren: true}); err != nil {
+		return fmt.Errorf("failed to remove image %s: %w", imageRef, err)
+	}
+	return nil
+}
+
 // createTarArchive creates a tar archive from a directory
 func (s *DockerService) createTarArchive(srcPath string) (io.ReadCloser, error) {
 	pr, pw := io.Pipe()
@@ -151,9 +175,52 @@ func (s *DockerService) createTarArchive(srcPath string) (io.ReadCloser, error)
 	return pr, nil
 }
 
+// ContainerName returns the name of the container serving a single-container project
+func ContainerName(project *models.Project) string {
+	return fmt.Sprintf("vps-panel-%s-%d", project.Name, project.ID)
+}
+
+// StandbyContainerName returns the name used for a new container while it is being health checked
+func StandbyContainerName(project *models.Project) string {
+	return ContainerName(project) + "-next"
+}
+
+// CreateContainer replaces the project's container, removing the existing one first
 func (s *DockerService) CreateContainer(ctx context.Context, project *models.Project, imageName string) (string, error) {
-	containerName := fmt.Sprintf("vps-panel-%s-%d", project.Name, project.ID)
+	return s.createContainer(ctx, project, imageName, ContainerName(project))
+}
+
+// CreateStandbyContainer creates a container next to the live one without touching it
+// The caller promotes it with PromoteStandbyContainer once it is healthy
+func (s *DockerService) CreateStandbyContainer(ctx context.Context, project *models.Project, imageName string) (string, error) {
+	return s.createContainer(ctx, project, imageName, StandbyContainerName(project))
+}
+
+// PromoteStandbyContainer removes the live container and gives the standby container its name
+func (s *DockerService) PromoteStandbyContainer(ctx context.Context, project *models.Project, standbyID string) error {
+	if err := s.RemoveContainer(ctx, ContainerName(project)); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove previous container: %w", err)
+	}
+
+	if err := s.client.ContainerRename(ctx, standbyID, ContainerName(project)); err != nil {
+		return fmt.Errorf("failed to rename container: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveProjectContainers removes a project's container and the standby
+// container of an unfinished swap, if there is one
+func (s *DockerService) RemoveProjectContainers(ctx context.Context, project *models.Project) error {
+	for _, name := range []string{ContainerName(project), StandbyContainerName(project)} {
+		if err := s.RemoveContainer(ctx, name); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove container %s: %w", name, err)
+		}
+	}
+	return nil
+}
 
+func (s *DockerService) createContainer(ctx context.Context, project *models.Project, imageName, containerName string) (string, error) {
 	// Port bindings
 	// Container always uses port 3000 internally, map to assigned host port
 	portBindings := nat.PortMap{}
@@ -216,6 +283,27 @@ func (s *DockerService) GetContainerLogs(ctx context.Context, containerID string
 	})
 }
 
+// TailContainerLogs returns the last lines of a container's stdout and stderr
+func (s *DockerService) TailContainerLogs(ctx context.Context, containerRef string, lines int) (string, error) {
+	reader, err := s.client.ContainerLogs(ctx, containerRef, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       fmt.Sprintf("%d", lines),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get container logs: %w", err)
+	}
+	defer reader.Close()
+
+	// Containers run without a TTY, so stdout and stderr are multiplexed
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, reader); err != nil {
+		return "", fmt.Errorf("failed to read container logs: %w", err)
+	}
+
+	return output.String(), nil
+}
+
 func (s *DockerService) buildEnvVars(project *models.Project) []string {
 	envVars := []string{
 		"NODE_ENV=production",
@@ -304,6 +392,7 @@ func execCommand(ctx context.Context, workDir string, command string) error {
 	}
 
 	cmd.Dir = workDir
+	cmd.WaitDelay = 10 * time.Second
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
@@ -325,6 +414,9 @@ func execCommandWithOutput(ctx context.Context, workDir string, command string,
 
 	cmd.Dir = workDir
 
+	// Don't hang on pipes held open by grandchildren once the context is cancelled
+	cmd.WaitDelay = 10 * time.Second
+
 	// Capture stdout and stderr
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
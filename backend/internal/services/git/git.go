@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 )
 
@@ -22,24 +24,31 @@ func NewGitService(baseDir string) *GitService {
 type CloneOptions struct {
 	URL      string
 	Branch   string
+	Tag      string // Checked out instead of the head of Branch when set
 	Depth    int
 	Username string // For private repos
 	Token    string // Access token for private repos
 }
 
 func (s *GitService) Clone(projectName string, opts CloneOptions) (string, error) {
+	return s.CloneContext(context.Background(), projectName, opts)
+}
+
+// CloneContext clones (or pulls) a repository, aborting when ctx is cancelled
+func (s *GitService) CloneContext(ctx context.Context, projectName string, opts CloneOptions) (string, error) {
 	// Create project directory
 	repoPath := filepath.Join(s.baseDir, projectName)
 
 	// Check if directory already exists (redeployment scenario)
 	if _, err := os.Stat(repoPath); err == nil {
 		// Directory exists - check if it's a git repository
-		if _, err := git.PlainOpen(repoPath); err == nil {
+		// Tags are cloned afresh, and a checkout of a tag can't be pulled
+		if repo, err := git.PlainOpen(repoPath); err == nil && opts.Tag == "" && onBranch(repo) {
 			// It's a valid git repo - pull latest changes instead of cloning
-			return repoPath, s.Pull(repoPath, opts)
+			return repoPath, s.PullContext(ctx, repoPath, opts)
 		}
 
-		// Directory exists but not a git repo - remove it
+		// Directory exists but not a git repo (or not one we can pull) - remove it
 		if err := os.RemoveAll(repoPath); err != nil {
 			return "", fmt.Errorf("failed to remove existing directory: %w", err)
 		}
@@ -64,7 +73,11 @@ func (s *GitService) Clone(projectName string, opts CloneOptions) (string, error
 		}
 	}
 
-	if opts.Branch != "" {
+	switch {
+	case opts.Tag != "":
+		cloneOpts.ReferenceName = plumbing.NewTagReferenceName(opts.Tag)
+		cloneOpts.SingleBranch = true
+	case opts.Branch != "":
 		cloneOpts.ReferenceName = plumbing.NewBranchReferenceName(opts.Branch)
 		cloneOpts.SingleBranch = true
 	}
@@ -73,7 +86,7 @@ func (s *GitService) Clone(projectName string, opts CloneOptions) (string, error
 		cloneOpts.Depth = opts.Depth
 	}
 
-	_, err := git.PlainClone(repoPath, false, cloneOpts)
+	_, err := git.PlainCloneContext(ctx, repoPath, false, cloneOpts)
 	if err != nil {
 		return "", fmt.Errorf("failed to clone repository: %w", err)
 	}
@@ -82,6 +95,11 @@ func (s *GitService) Clone(projectName string, opts CloneOptions) (string, error
 }
 
 func (s *GitService) Pull(repoPath string, opts CloneOptions) error {
+	return s.PullContext(context.Background(), repoPath, opts)
+}
+
+// PullContext pulls the latest changes, aborting when ctx is cancelled
+func (s *GitService) PullContext(ctx context.Context, repoPath string, opts CloneOptions) error {
 	repo, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return fmt.Errorf("failed to open repository: %w", err)
@@ -139,7 +157,7 @@ func (s *GitService) Pull(repoPath string, opts CloneOptions) error {
 		pullOpts.ReferenceName = plumbing.NewBranchReferenceName(opts.Branch)
 	}
 
-	err = worktree.Pull(pullOpts)
+	err = worktree.PullContext(ctx, pullOpts)
 
 	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("failed to pull: %w", err)
@@ -148,6 +166,77 @@ func (s *GitService) Pull(repoPath string, opts CloneOptions) error {
 	return nil
 }
 
+// changedFilesDepth is how many commits ChangedFiles fetches when a shallow
+// clone doesn't contain the commit it compares against
+const changedFilesDepth = 200
+
+// ChangedFiles lists the files that differ between two commits of a clone,
+// with both names of renamed files. Shallow clones are deepened when they
+// don't contain from, e.g. the commit deployed before
+func (s *GitService) ChangedFiles(ctx context.Context, repoPath string, opts CloneOptions, from, to string) ([]string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	toCommit, err := repo.CommitObject(plumbing.NewHash(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", to, err)
+	}
+
+	fromCommit, err := repo.CommitObject(plumbing.NewHash(from))
+	if err != nil {
+		fetchOpts := &git.FetchOptions{
+			RemoteName: "origin",
+			Depth:      changedFilesDepth,
+		}
+		if opts.Username != "" && opts.Token != "" {
+			fetchOpts.Auth = &http.BasicAuth{
+				Username: opts.Username,
+				Password: opts.Token,
+			}
+		}
+		if err := repo.FetchContext(ctx, fetchOpts); err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, fmt.Errorf("failed to fetch history: %w", err)
+		}
+
+		if fromCommit, err = repo.CommitObject(plumbing.NewHash(from)); err != nil {
+			return nil, fmt.Errorf("commit %s isn't among the last %d commits: %w", from, changedFilesDepth, err)
+		}
+	}
+
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of %s: %w", from, err)
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of %s: %w", to, err)
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, fromTree, toTree, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commits: %w", err)
+	}
+
+	var files []string
+	for _, change := range changes {
+		if change.From.Name != "" {
+			files = append(files, change.From.Name)
+		}
+		if change.To.Name != "" && change.To.Name != change.From.Name {
+			files = append(files, change.To.Name)
+		}
+	}
+	return files, nil
+}
+
+// onBranch reports whether the repository's HEAD is a branch, not a detached commit such as a tag
+func onBranch(repo *git.Repository) bool {
+	head, err := repo.Head()
+	return err == nil && head.Name().IsBranch()
+}
+
 // forceRemoveAll forcefully removes a directory and its contents, handling permission issues
 func forceRemoveAll(path string) error {
 	// First try normal removal
@@ -0,0 +1,167 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated token is presented again
+	// The whole session is revoked since the token has most likely been stolen
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Device identifies the client a session was started from
+type Device struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Service stores refresh tokens and rotates them on use
+type Service struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewService creates a refresh token store; tokens expire after ttl
+func NewService(db *gorm.DB, ttl time.Duration) *Service {
+	return &Service{db: db, ttl: ttl}
+}
+
+// Start begins a new session for a user and returns its first refresh token
+func (s *Service) Start(userID uint, device Device) (string, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	// Expired tokens can't be used or replayed anymore, drop them while we're here
+	s.db.Where("user_id = ? AND expires_at < ?", userID, time.Now()).Delete(&models.RefreshToken{})
+
+	return s.issue(s.db, userID, familyID, device)
+}
+
+// Rotate exchanges a refresh token for a new one in the same session
+// The presented token can't be used again afterwards
+func (s *Service) Rotate(token string, device Device) (*models.RefreshToken, string, error) {
+	var current models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(token)).First(&current).Error; err != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if current.UsedAt != nil {
+		s.RevokeSession(current.UserID, current.FamilyID)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	var newToken string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Only one concurrent refresh can claim the token
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", current.ID).
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		newToken, err = s.issue(tx, current.UserID, current.FamilyID, device)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		s.RevokeSession(current.UserID, current.FamilyID)
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return &current, newToken, nil
+}
+
+// Revoke ends the session a refresh token belongs to
+func (s *Service) Revoke(token string) error {
+	var current models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(token)).First(&current).Error; err != nil {
+		return ErrInvalidRefreshToken
+	}
+	return s.RevokeSession(current.UserID, current.FamilyID)
+}
+
+// RevokeSession revokes every refresh token of one session
+func (s *Service) RevokeSession(userID uint, familyID string) error {
+	return s.revoke(s.db.Where("user_id = ? AND family_id = ?", userID, familyID))
+}
+
+// RevokeAll revokes every session of a user
+func (s *Service) RevokeAll(userID uint) error {
+	return s.revoke(s.db.Where("user_id = ?", userID))
+}
+
+func (s *Service) revoke(scope *gorm.DB) error {
+	now := time.Now()
+	if err := scope.Model(&models.RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", &now).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) issue(db *gorm.DB, userID uint, familyID string, device Device) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	record := models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		UserAgent: device.UserAgent,
+		IPAddress: device.IPAddress,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// hashToken returns the stored form of a refresh token
+// Tokens are random, so a fast hash is enough (unlike passwords)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -64,7 +64,7 @@ func (s *Service) createGitHubWebhook(project *models.Project, provider *models.
 	payload := map[string]interface{}{
 		"name":   "web",
 		"active": true,
-		"events": []string{"push"},
+		"events": []string{"push", "pull_request", "release"}, // Pull requests for preview deployments, releases for trigger rules
 		"config": map[string]interface{}{
 			"url":          webhookURL,
 			"content_type": "json",
@@ -136,6 +136,8 @@ func (s *Service) createGitLabWebhook(project *models.Project, provider *models.
 		"token":                  project.WebhookSecret,
 		"push_events":            true,
 		"push_events_branch_filter": project.AutoDeployBranch,
+		"merge_requests_events":  true, // Merge requests for preview deployments
+		"tag_push_events":        true, // Tags for trigger rules
 		"enable_ssl_verification": true,
 	}
 
@@ -194,7 +196,7 @@ func (s *Service) createGiteaWebhook(project *models.Project, provider *models.G
 	payload := map[string]interface{}{
 		"type":   "gitea",
 		"active": true,
-		"events": []string{"push"},
+		"events": []string{"push", "pull_request", "release"}, // Pull requests for preview deployments, releases for trigger rules
 		"config": map[string]interface{}{
 			"url":          webhookURL,
 			"content_type": "json",
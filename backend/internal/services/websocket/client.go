@@ -0,0 +1,314 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/vps-panel/backend/internal/models"
+)
+
+const (
+	// Time allowed to write a message to the client
+	writeWait = 10 * time.Second
+
+	// Connections are closed when nothing (not even a pong) is read for this long
+	idleTimeout = 60 * time.Second
+
+	// Protocol pings are sent at this interval, must be less than idleTimeout
+	pingPeriod = (idleTimeout * 9) / 10
+
+	// Maximum size of a command sent by the client
+	maxCommandSize = 4096
+
+	// Maximum number of log lines sent in one replay, clients page with sinceLogId
+	replayLimit = 500
+)
+
+// CommandType defines the commands a client can send over the socket
+type CommandType string
+
+const (
+	CommandSubscribe   CommandType = "subscribe"
+	CommandUnsubscribe CommandType = "unsubscribe"
+	CommandReplay      CommandType = "replay"
+	CommandPing        CommandType = "ping"
+)
+
+// Command is a JSON message sent by the client, e.g.
+//
+//	{"type": "subscribe", "projectId": 3}
+//	{"type": "subscribe", "deploymentId": 42}
+//	{"type": "replay", "deploymentId": 42, "sinceLogId": 1200}
+//	{"type": "ping"}
+type Command struct {
+	Type         CommandType `json:"type"`
+	ProjectID    uint        `json:"projectId,omitempty"`
+	DeploymentID uint        `json:"deploymentId,omitempty"`
+	SinceLogID   uint        `json:"sinceLogId,omitempty"`
+}
+
+// SubscriptionPayload confirms a subscribe or unsubscribe command
+type SubscriptionPayload struct {
+	ProjectID    uint `json:"projectId,omitempty"`
+	DeploymentID uint `json:"deploymentId,omitempty"`
+}
+
+// BuildLogReplayPayload contains the build logs written after the requested log ID
+type BuildLogReplayPayload struct {
+	DeploymentID uint              `json:"deploymentId"`
+	ProjectID    uint              `json:"projectId"`
+	Logs         []BuildLogPayload `json:"logs"`
+	HasMore      bool              `json:"hasMore"` // request again from the last log ID
+}
+
+// ErrorPayload reports a command that couldn't be handled
+type ErrorPayload struct {
+	Command CommandType `json:"command,omitempty"`
+	Error   string      `json:"error"`
+}
+
+// Client represents a WebSocket client
+type Client struct {
+	Conn   *websocket.Conn
+	UserID uint
+	Admin  bool
+	Global bool // admins only: without subscriptions, receives every user's events
+	Send   chan []byte
+	hub    *Hub
+
+	// Subscriptions; when both are empty the client receives all of its own projects
+	mu          sync.RWMutex
+	projects    map[uint]bool
+	deployments map[uint]bool
+}
+
+func newClient(h *Hub, conn *websocket.Conn, userID uint, admin, global bool) *Client {
+	return &Client{
+		Conn:        conn,
+		UserID:      userID,
+		Admin:       admin,
+		Global:      global,
+		Send:        make(chan []byte, 256),
+		hub:         h,
+		projects:    make(map[uint]bool),
+		deployments: make(map[uint]bool),
+	}
+}
+
+// shouldReceive determines if the client should receive a message for the given target
+func (c *Client) shouldReceive(projectID, deploymentID uint, hasTarget bool, owner uint, ownerKnown bool) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Explicit subscriptions were checked for access when they were made
+	if len(c.projects) > 0 || len(c.deployments) > 0 {
+		return hasTarget && (c.projects[projectID] || c.deployments[deploymentID])
+	}
+
+	// Admin global stream receives everything
+	if c.Global {
+		return true
+	}
+
+	// Otherwise only events of the user's own projects
+	return hasTarget && ownerKnown && owner == c.UserID
+}
+
+// canAccessProject reports whether a user may receive events of a project
+func (h *Hub) canAccessProject(userID uint, admin bool, projectID uint) bool {
+	owner, ok := h.projectOwner(projectID)
+	return ok && (admin || owner == userID)
+}
+
+// ReadPump reads commands from the WebSocket connection
+func (c *Client) ReadPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.Conn.Close()
+	}()
+
+	// Any message or pong keeps the connection alive
+	c.Conn.SetReadLimit(maxCommandSize)
+	c.Conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	})
+
+	for {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		var cmd Command
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			c.sendError("", "Invalid command")
+			continue
+		}
+		c.handleCommand(cmd)
+	}
+}
+
+// WritePump writes messages to the WebSocket connection and keeps it alive with pings
+func (c *Client) WritePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the channel
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Printf("Error writing WebSocket message: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) handleCommand(cmd Command) {
+	switch cmd.Type {
+	case CommandPing:
+		c.hub.send(c, &Message{Type: MessageTypePong})
+
+	case CommandSubscribe:
+		if !c.authorize(cmd) {
+			return
+		}
+		c.mu.Lock()
+		if cmd.ProjectID != 0 {
+			c.projects[cmd.ProjectID] = true
+		}
+		if cmd.DeploymentID != 0 {
+			c.deployments[cmd.DeploymentID] = true
+		}
+		c.mu.Unlock()
+		c.hub.send(c, &Message{
+			Type:    MessageTypeSubscribed,
+			Payload: SubscriptionPayload{ProjectID: cmd.ProjectID, DeploymentID: cmd.DeploymentID},
+		})
+
+	case CommandUnsubscribe:
+		if cmd.ProjectID == 0 && cmd.DeploymentID == 0 {
+			c.sendError(cmd.Type, "projectId or deploymentId is required")
+			return
+		}
+		c.mu.Lock()
+		delete(c.projects, cmd.ProjectID)
+		delete(c.deployments, cmd.DeploymentID)
+		c.mu.Unlock()
+		c.hub.send(c, &Message{
+			Type:    MessageTypeUnsubscribed,
+			Payload: SubscriptionPayload{ProjectID: cmd.ProjectID, DeploymentID: cmd.DeploymentID},
+		})
+
+	case CommandReplay:
+		if cmd.DeploymentID == 0 {
+			c.sendError(cmd.Type, "deploymentId is required")
+			return
+		}
+		if !c.authorize(cmd) {
+			return
+		}
+		c.replay(cmd.DeploymentID, cmd.SinceLogID)
+
+	default:
+		c.sendError(cmd.Type, "Unknown command")
+	}
+}
+
+// authorize checks that the client may access the project and deployment of a command
+func (c *Client) authorize(cmd Command) bool {
+	if cmd.ProjectID == 0 && cmd.DeploymentID == 0 {
+		c.sendError(cmd.Type, "projectId or deploymentId is required")
+		return false
+	}
+
+	if cmd.ProjectID != 0 && !c.hub.canAccessProject(c.UserID, c.Admin, cmd.ProjectID) {
+		c.sendError(cmd.Type, "Project not found")
+		return false
+	}
+
+	if cmd.DeploymentID != 0 {
+		projectID, ok := c.hub.deploymentProject(cmd.DeploymentID)
+		if !ok || !c.hub.canAccessProject(c.UserID, c.Admin, projectID) {
+			c.sendError(cmd.Type, "Deployment not found")
+			return false
+		}
+	}
+
+	return true
+}
+
+// replay sends the build logs of a deployment written after sinceLogID
+func (c *Client) replay(deploymentID, sinceLogID uint) {
+	db := c.hub.database()
+	projectID, ok := c.hub.deploymentProject(deploymentID)
+	if db == nil || !ok {
+		c.sendError(CommandReplay, "Deployment not found")
+		return
+	}
+
+	var logs []models.BuildLog
+	if err := db.Where("deployment_id = ? AND id > ?", deploymentID, sinceLogID).
+		Order("id ASC").
+		Limit(replayLimit + 1).
+		Find(&logs).Error; err != nil {
+		log.Printf("WebSocket: failed to load build logs for deployment %d: %v", deploymentID, err)
+		c.sendError(CommandReplay, "Failed to load build logs")
+		return
+	}
+
+	hasMore := len(logs) > replayLimit
+	if hasMore {
+		logs = logs[:replayLimit]
+	}
+
+	payload := BuildLogReplayPayload{
+		DeploymentID: deploymentID,
+		ProjectID:    projectID,
+		Logs:         make([]BuildLogPayload, 0, len(logs)),
+		HasMore:      hasMore,
+	}
+	for _, l := range logs {
+		payload.Logs = append(payload.Logs, BuildLogPayload{
+			LogID:        l.ID,
+			DeploymentID: deploymentID,
+			ProjectID:    projectID,
+			Message:      l.Log,
+			Level:        l.LogType,
+			Timestamp:    l.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	c.hub.send(c, &Message{Type: MessageTypeBuildLogReplay, Payload: payload})
+}
+
+func (c *Client) sendError(command CommandType, message string) {
+	c.hub.send(c, &Message{
+		Type:    MessageTypeError,
+		Payload: ErrorPayload{Command: command, Error: message},
+	})
+}
@@ -8,6 +8,9 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
 )
 
 // MessageType defines the type of WebSocket message
@@ -18,24 +21,39 @@ const (
 	MessageTypeBuildLog         MessageType = "build_log"
 	MessageTypeDeploymentStart  MessageType = "deployment_start"
 	MessageTypeDeploymentEnd    MessageType = "deployment_end"
+	MessageTypeCertificate      MessageType = "certificate_status"
+
+	// Replies to client commands (see client.go)
+	MessageTypeBuildLogReplay MessageType = "build_log_replay"
+	MessageTypeSubscribed     MessageType = "subscribed"
+	MessageTypeUnsubscribed   MessageType = "unsubscribed"
+	MessageTypePong           MessageType = "pong"
+	MessageTypeError          MessageType = "error"
 )
 
 // Message represents a WebSocket message
 type Message struct {
 	Type    MessageType `json:"type"`
 	Payload interface{} `json:"payload"`
+
+	// Owner of the message's project, resolved before the message is queued
+	// so Run never waits for the database
+	owner      uint
+	ownerKnown bool
 }
 
 // DeploymentStatusPayload contains deployment status update data
 type DeploymentStatusPayload struct {
-	DeploymentID uint   `json:"deploymentId"`
-	ProjectID    uint   `json:"projectId"`
-	Status       string `json:"status"`
-	Error        string `json:"error,omitempty"`
+	DeploymentID  uint   `json:"deploymentId"`
+	ProjectID     uint   `json:"projectId"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	QueuePosition int    `json:"queuePosition,omitempty"` // 1-based position while waiting for a build slot
 }
 
 // BuildLogPayload contains build log data
 type BuildLogPayload struct {
+	LogID        uint   `json:"logId"` // BuildLog ID, used to request a replay after reconnecting
 	DeploymentID uint   `json:"deploymentId"`
 	ProjectID    uint   `json:"projectId"`
 	Message      string `json:"message"`
@@ -43,13 +61,15 @@ type BuildLogPayload struct {
 	Timestamp    string `json:"timestamp"`
 }
 
-// Client represents a WebSocket client
-type Client struct {
-	Conn      *websocket.Conn
-	UserID    uint
-	ProjectID *uint // nil means subscribed to all projects
-	Send      chan []byte
-	hub       *Hub
+// CertificateStatusPayload contains the certificate state of a domain
+type CertificateStatusPayload struct {
+	DomainID  uint   `json:"domainId"`
+	ProjectID uint   `json:"projectId"`
+	Domain    string `json:"domain"`
+	Status    string `json:"status"`
+	Issuer    string `json:"issuer,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
 // Hub maintains active WebSocket connections and broadcasts messages
@@ -59,6 +79,11 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+
+	// Project ownership, used to deliver events only to the project's owner
+	db       *gorm.DB
+	owners   map[uint]uint // project ID -> user ID
+	ownersMu sync.RWMutex
 }
 
 // NewHub creates a new WebSocket hub
@@ -68,7 +93,96 @@ func NewHub() *Hub {
 		broadcast:  make(chan *Message, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		owners:     make(map[uint]uint),
+	}
+}
+
+// SetDatabase gives the hub access to project ownership
+// Without it, project events are only delivered to admin global streams
+func (h *Hub) SetDatabase(db *gorm.DB) {
+	h.ownersMu.Lock()
+	h.db = db
+	h.ownersMu.Unlock()
+}
+
+// database returns the database set with SetDatabase, if any
+func (h *Hub) database() *gorm.DB {
+	h.ownersMu.RLock()
+	defer h.ownersMu.RUnlock()
+	return h.db
+}
+
+// projectOwner returns the ID of the user owning a project
+// Owners never change, so lookups are cached until the project is deleted
+func (h *Hub) projectOwner(projectID uint) (uint, bool) {
+	h.ownersMu.RLock()
+	owner, ok := h.owners[projectID]
+	db := h.db
+	h.ownersMu.RUnlock()
+	if ok {
+		return owner, true
+	}
+	if db == nil {
+		return 0, false
+	}
+
+	// Unscoped so events of a project being deleted still reach its owner,
+	// but deleted projects aren't cached again once ForgetProject dropped them
+	var project models.Project
+	if err := db.Unscoped().Select("id", "user_id", "deleted_at").First(&project, projectID).Error; err != nil {
+		log.Printf("WebSocket: failed to look up owner of project %d: %v", projectID, err)
+		return 0, false
+	}
+
+	if !project.DeletedAt.Valid {
+		h.ownersMu.Lock()
+		h.owners[projectID] = project.UserID
+		h.ownersMu.Unlock()
+	}
+
+	return project.UserID, true
+}
+
+// ForgetProject drops the cached owner of a deleted project
+func (h *Hub) ForgetProject(projectID uint) {
+	h.ownersMu.Lock()
+	delete(h.owners, projectID)
+	h.ownersMu.Unlock()
+}
+
+// deploymentProject returns the project a deployment belongs to
+func (h *Hub) deploymentProject(deploymentID uint) (uint, bool) {
+	db := h.database()
+	if db == nil {
+		return 0, false
+	}
+
+	var deployment models.Deployment
+	if err := db.Unscoped().Select("id", "project_id").First(&deployment, deploymentID).Error; err != nil {
+		return 0, false
+	}
+	return deployment.ProjectID, true
+}
+
+// messageTarget returns the project and deployment a message belongs to
+func messageTarget(message *Message) (projectID, deploymentID uint, ok bool) {
+	switch payload := message.Payload.(type) {
+	case DeploymentStatusPayload:
+		return payload.ProjectID, payload.DeploymentID, true
+	case BuildLogPayload:
+		return payload.ProjectID, payload.DeploymentID, true
+	case CertificateStatusPayload:
+		return payload.ProjectID, 0, true
 	}
+	return 0, 0, false
+}
+
+// queue resolves the owner of a message's project and hands the message to Run
+func (h *Hub) queue(message *Message) {
+	if projectID, _, ok := messageTarget(message); ok {
+		message.owner, message.ownerKnown = h.projectOwner(projectID)
+	}
+	h.broadcast <- message
 }
 
 // Run starts the hub's main loop
@@ -79,8 +193,8 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
-			log.Printf("WebSocket client connected (UserID: %d, ProjectID: %v). Total clients: %d",
-				client.UserID, client.ProjectID, len(h.clients))
+			log.Printf("WebSocket client connected (UserID: %d, Global: %t). Total clients: %d",
+				client.UserID, client.Global, len(h.clients))
 
 		case client := <-h.unregister:
 			h.mu.Lock()
@@ -93,58 +207,77 @@ func (h *Hub) Run() {
 			h.mu.Unlock()
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
 			data, err := json.Marshal(message)
 			if err != nil {
 				log.Printf("Error marshaling WebSocket message: %v", err)
-				h.mu.RUnlock()
 				continue
 			}
 
+			// The owner was resolved by queue
+			projectID, deploymentID, hasTarget := messageTarget(message)
+
+			var slow []*Client
+			h.mu.RLock()
 			// Broadcast to all matching clients
 			for client := range h.clients {
 				// Check if client should receive this message
-				if h.shouldReceiveMessage(client, message) {
-					select {
-					case client.Send <- data:
-					default:
-						// Client's send buffer is full, disconnect them
-						close(client.Send)
-						delete(h.clients, client)
-						log.Printf("WebSocket client send buffer full, disconnecting (UserID: %d)", client.UserID)
-					}
+				if !client.shouldReceive(projectID, deploymentID, hasTarget, message.owner, message.ownerKnown) {
+					continue
+				}
+				select {
+				case client.Send <- data:
+				default:
+					slow = append(slow, client)
 				}
 			}
 			h.mu.RUnlock()
+
+			// Client's send buffer is full, disconnect them
+			for _, client := range slow {
+				h.drop(client)
+				log.Printf("WebSocket client send buffer full, disconnecting (UserID: %d)", client.UserID)
+			}
 		}
 	}
 }
 
-// shouldReceiveMessage determines if a client should receive a specific message
-func (h *Hub) shouldReceiveMessage(client *Client, message *Message) bool {
-	// If client is subscribed to all projects
-	if client.ProjectID == nil {
-		return true
+// drop unregisters a client and closes its send channel
+// The channel is only ever closed under the write lock, see send
+func (h *Hub) drop(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.Send)
 	}
+}
 
-	// Check if message is project-specific
-	switch message.Type {
-	case MessageTypeDeploymentStatus:
-		if payload, ok := message.Payload.(DeploymentStatusPayload); ok {
-			return payload.ProjectID == *client.ProjectID
-		}
-	case MessageTypeBuildLog:
-		if payload, ok := message.Payload.(BuildLogPayload); ok {
-			return payload.ProjectID == *client.ProjectID
-		}
+// send queues a message for a single client without blocking
+// It returns false if the client is gone or its buffer is full
+func (h *Hub) send(client *Client, message *Message) bool {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling WebSocket message: %v", err)
+		return false
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if _, ok := h.clients[client]; !ok {
+		return false
 	}
 
-	return true
+	select {
+	case client.Send <- data:
+		return true
+	default:
+		return false
+	}
 }
 
 // BroadcastDeploymentStatus broadcasts a deployment status update
 func (h *Hub) BroadcastDeploymentStatus(deploymentID, projectID uint, status string, errorMsg string) {
-	h.broadcast <- &Message{
+	h.queue(&Message{
 		Type: MessageTypeDeploymentStatus,
 		Payload: DeploymentStatusPayload{
 			DeploymentID: deploymentID,
@@ -152,55 +285,43 @@ func (h *Hub) BroadcastDeploymentStatus(deploymentID, projectID uint, status str
 			Status:       status,
 			Error:        errorMsg,
 		},
-	}
+	})
+}
+
+// BroadcastQueuePosition broadcasts the build queue position of a pending deployment
+func (h *Hub) BroadcastQueuePosition(deploymentID, projectID uint, position int) {
+	h.queue(&Message{
+		Type: MessageTypeDeploymentStatus,
+		Payload: DeploymentStatusPayload{
+			DeploymentID:  deploymentID,
+			ProjectID:     projectID,
+			Status:        "pending",
+			QueuePosition: position,
+		},
+	})
+}
+
+// BroadcastCertificateStatus broadcasts a change of a domain's certificate state
+func (h *Hub) BroadcastCertificateStatus(payload CertificateStatusPayload) {
+	h.queue(&Message{
+		Type:    MessageTypeCertificate,
+		Payload: payload,
+	})
 }
 
 // BroadcastBuildLog broadcasts a build log message
-func (h *Hub) BroadcastBuildLog(deploymentID, projectID uint, message, level, timestamp string) {
-	h.broadcast <- &Message{
+func (h *Hub) BroadcastBuildLog(logID, deploymentID, projectID uint, message, level, timestamp string) {
+	h.queue(&Message{
 		Type: MessageTypeBuildLog,
 		Payload: BuildLogPayload{
+			LogID:        logID,
 			DeploymentID: deploymentID,
 			ProjectID:    projectID,
 			Message:      message,
 			Level:        level,
 			Timestamp:    timestamp,
 		},
-	}
-}
-
-// ReadPump reads messages from the WebSocket connection
-func (c *Client) ReadPump() {
-	defer func() {
-		c.hub.unregister <- c
-		c.Conn.Close()
-	}()
-
-	for {
-		_, _, err := c.Conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
-		}
-		// Currently, we don't expect messages from clients
-		// In the future, we could handle client commands here
-	}
-}
-
-// WritePump writes messages to the WebSocket connection
-func (c *Client) WritePump() {
-	defer func() {
-		c.Conn.Close()
-	}()
-
-	for message := range c.Send {
-		if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("Error writing WebSocket message: %v", err)
-			return
-		}
-	}
+	})
 }
 
 // HandleWebSocket handles WebSocket upgrade and client management
@@ -211,12 +332,34 @@ func (h *Hub) HandleWebSocket(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized")
 	}
 
+	isAdmin := c.Locals("userRole") == "admin"
+
+	// Admins can opt into events for every user's projects with ?scope=all
+	global := false
+	switch c.Query("scope") {
+	case "":
+	case "all":
+		if !isAdmin {
+			return fiber.NewError(fiber.StatusForbidden, "Admin access required")
+		}
+		global = true
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid scope")
+	}
+
 	// Get optional projectID from query parameter
-	var projectID *uint
+	// More subscriptions can be added over the socket, see Client.handleCommand
+	var projectID uint
 	if projectIDStr := c.Query("projectId"); projectIDStr != "" {
-		if parsed, err := strconv.ParseUint(projectIDStr, 10, 32); err == nil {
-			pid := uint(parsed)
-			projectID = &pid
+		parsed, err := strconv.ParseUint(projectIDStr, 10, 32)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid project ID")
+		}
+		projectID = uint(parsed)
+
+		// Only the owner (or an admin) may subscribe to a project
+		if !h.canAccessProject(userID, isAdmin, projectID) {
+			return fiber.NewError(fiber.StatusNotFound, "Project not found")
 		}
 	}
 
@@ -227,12 +370,9 @@ func (h *Hub) HandleWebSocket(c *fiber.Ctx) error {
 
 	return websocket.New(func(conn *websocket.Conn) {
 		// Create new client
-		client := &Client{
-			Conn:      conn,
-			UserID:    userID,
-			ProjectID: projectID,
-			Send:      make(chan []byte, 256),
-			hub:       h,
+		client := newClient(h, conn, userID, isAdmin, global)
+		if projectID != 0 {
+			client.projects[projectID] = true
 		}
 
 		// Register client
@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/vps-panel/backend/internal/models"
+	"github.com/vps-panel/backend/internal/testutil"
+)
+
+// newTestHub creates a hub on an in-memory database holding one project of user 7
+func newTestHub(t *testing.T) (*Hub, *gorm.DB, *models.Project) {
+	t.Helper()
+
+	db := testutil.OpenDB(t, &models.Project{})
+
+	project := &models.Project{Name: "app", UserID: 7, GitURL: "https://example.com/app.git"}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	hub := NewHub()
+	hub.SetDatabase(db)
+	return hub, db, project
+}
+
+func TestQueueResolvesOwnerBeforeRun(t *testing.T) {
+	hub, _, project := newTestHub(t)
+
+	hub.BroadcastDeploymentStatus(1, project.ID, "building", "")
+	hub.BroadcastCertificateStatus(CertificateStatusPayload{ProjectID: 999})
+
+	if message := <-hub.broadcast; !message.ownerKnown || message.owner != 7 {
+		t.Errorf("owner = %d (known %t), want 7", message.owner, message.ownerKnown)
+	}
+	if message := <-hub.broadcast; message.ownerKnown {
+		t.Errorf("owner of a missing project known: %d", message.owner)
+	}
+}
+
+func TestForgetProject(t *testing.T) {
+	hub, db, project := newTestHub(t)
+
+	if owner, ok := hub.projectOwner(project.ID); !ok || owner != 7 {
+		t.Fatalf("projectOwner = %d, %t", owner, ok)
+	}
+	if _, ok := hub.owners[project.ID]; !ok {
+		t.Fatal("owner not cached")
+	}
+
+	if err := db.Delete(project).Error; err != nil {
+		t.Fatal(err)
+	}
+	hub.ForgetProject(project.ID)
+	if _, ok := hub.owners[project.ID]; ok {
+		t.Fatal("owner still cached after ForgetProject")
+	}
+
+	// Late events of the deleted project still reach its owner, without caching it again
+	if owner, ok := hub.projectOwner(project.ID); !ok || owner != 7 {
+		t.Errorf("projectOwner of the deleted project = %d, %t", owner, ok)
+	}
+	if _, ok := hub.owners[project.ID]; ok {
+		t.Error("deleted project cached again")
+	}
+}
@@ -0,0 +1,6 @@
+-- Add deployment policy to projects
+-- Controls how concurrent deployments of the same project are handled:
+--   queue     - every deployment runs, one at a time, in order
+--   supersede - older pending deployments are cancelled so only the newest commit is built
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS deployment_policy VARCHAR(20) DEFAULT 'queue';
@@ -0,0 +1,8 @@
+-- Add release image tracking to deployments
+-- image_tag holds the immutable image reference built by a deployment (cleared once pruned)
+-- source_deployment_id links a rollback to the deployment it restored
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS image_tag VARCHAR(255) DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS source_deployment_id INTEGER REFERENCES deployments(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_deployments_source_deployment_id ON deployments(source_deployment_id);
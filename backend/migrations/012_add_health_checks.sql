@@ -0,0 +1,10 @@
+-- Add per-project health check settings
+-- Checked after a container starts; a deployment only succeeds once the check passes
+-- Zero values fall back to the defaults in the deployment service (path "/", 5s timeout, 30 retries)
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS health_check_path VARCHAR(255) DEFAULT '';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS health_check_expected_status INTEGER DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS health_check_timeout INTEGER DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS health_check_retries INTEGER DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS health_check_start_period INTEGER DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS health_check_rollback BOOLEAN DEFAULT false;
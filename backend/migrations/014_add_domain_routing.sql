@@ -0,0 +1,10 @@
+-- Add per-domain routing settings
+-- Redirect-to-primary domains send every request to the project's primary domain,
+-- canonical picks www or apex and redirects the other, and rules hold path redirects
+-- and rewrites as a JSON array of {type, path, to, code}
+
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS is_primary BOOLEAN DEFAULT false;
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS redirect_to_primary BOOLEAN DEFAULT false;
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS redirect_code INTEGER DEFAULT 0;
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS canonical VARCHAR(10) DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS rules TEXT;
@@ -0,0 +1,36 @@
+-- Create access_policies and access_users tables
+-- A policy restricts a project's site (domain_id NULL) or one of its domains with
+-- IP allow/deny lists (JSON arrays) and basic auth users. Only bcrypt hashes of
+-- the passwords are stored, and they are written into the Caddy site block as is
+CREATE TABLE IF NOT EXISTS access_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+
+    project_id INTEGER NOT NULL,
+    domain_id INTEGER,
+    allow_cidrs TEXT,
+    deny_cidrs TEXT,
+
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_policies_project_id ON access_policies(project_id);
+CREATE INDEX IF NOT EXISTS idx_access_policies_domain_id ON access_policies(domain_id);
+CREATE INDEX IF NOT EXISTS idx_access_policies_deleted_at ON access_policies(deleted_at);
+
+CREATE TABLE IF NOT EXISTS access_users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+    policy_id INTEGER NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+
+    FOREIGN KEY (policy_id) REFERENCES access_policies(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_users_policy_id ON access_users(policy_id);
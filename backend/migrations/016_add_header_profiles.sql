@@ -0,0 +1,9 @@
+-- Add per-project response header settings
+-- header_profile selects the built-in security headers ('' keeps the previous
+-- behavior, 'strict', 'relaxed' or 'custom' for none); custom_headers and
+-- csp_directives are JSON arrays applied on top of the profile
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS header_profile VARCHAR(20) DEFAULT '';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS custom_headers TEXT;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS csp_directives TEXT;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS csp_report_only BOOLEAN DEFAULT false;
@@ -0,0 +1,9 @@
+-- Add domain ownership verification
+-- New custom domains start as 'pending' with a token the owner publishes in a
+-- _vps-panel-verify.<domain> TXT record; only 'verified' domains are served by Caddy.
+-- Existing domains keep working, so the column defaults to 'verified'
+
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS verification_status VARCHAR(20) DEFAULT 'verified';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS verification_token VARCHAR(64) DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS verification_error TEXT DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS verified_at DATETIME;
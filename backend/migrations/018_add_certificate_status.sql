@@ -0,0 +1,9 @@
+-- Add certificate status per domain
+-- Recorded by the certificate monitor, which connects to each served HTTPS domain
+-- after deployments and periodically (CERT_CHECK_INTERVAL)
+
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS cert_status VARCHAR(20) DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS cert_issuer VARCHAR(255) DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS cert_expires_at DATETIME;
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS cert_error TEXT DEFAULT '';
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS cert_checked_at DATETIME;
@@ -0,0 +1,28 @@
+-- Create certificates table
+-- Uploaded TLS certificates served instead of ACME ones, for one domain (domain_id)
+-- or shared by the project's domains they cover (domain_id NULL, e.g. wildcards).
+-- The PEM chain and key are encrypted at rest; names, issuer and validity are
+-- parsed from the leaf on upload
+CREATE TABLE IF NOT EXISTS certificates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+
+    project_id INTEGER NOT NULL,
+    domain_id INTEGER,
+    certificate_pem TEXT NOT NULL,
+    private_key_pem TEXT NOT NULL,
+    names TEXT,
+    issuer VARCHAR(255) DEFAULT '',
+    not_before DATETIME,
+    not_after DATETIME,
+    fingerprint VARCHAR(64) DEFAULT '',
+
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_certificates_project_id ON certificates(project_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_domain_id ON certificates(domain_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_deleted_at ON certificates(deleted_at);
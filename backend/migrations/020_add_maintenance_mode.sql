@@ -0,0 +1,28 @@
+-- Add maintenance mode
+-- While on (manually, or during a scheduled window) Caddy serves a 503 page with
+-- Retry-After instead of the app, except to maintenance_allow_cidrs (JSON array)
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS maintenance_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS maintenance_message TEXT DEFAULT '';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS maintenance_page TEXT DEFAULT '';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS maintenance_retry_after INTEGER DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS maintenance_allow_cidrs TEXT;
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+
+    project_id INTEGER NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    message TEXT DEFAULT '',
+
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_project_id ON maintenance_windows(project_id);
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_starts_at ON maintenance_windows(starts_at);
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_ends_at ON maintenance_windows(ends_at);
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_deleted_at ON maintenance_windows(deleted_at);
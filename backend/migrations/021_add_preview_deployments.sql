@@ -0,0 +1,37 @@
+-- Add preview deployments
+-- With preview_deployments on, every open pull/merge request is deployed to a
+-- container and subdomain of its own; domains and deployments of a preview
+-- point to it with preview_id
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS preview_deployments BOOLEAN DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS previews (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+
+    project_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    title TEXT DEFAULT '',
+    url TEXT DEFAULT '',
+    branch VARCHAR(255) DEFAULT '',
+    commit_hash VARCHAR(255) DEFAULT '',
+    author VARCHAR(255) DEFAULT '',
+    status VARCHAR(20) DEFAULT 'pending',
+    last_deployed DATETIME,
+    closed_at DATETIME,
+    frontend_port INTEGER DEFAULT 0,
+    backend_port INTEGER DEFAULT 0,
+
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_previews_project_number ON previews(project_id, number);
+CREATE INDEX IF NOT EXISTS idx_previews_deleted_at ON previews(deleted_at);
+
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS preview_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_domains_preview_id ON domains(preview_id);
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS preview_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_deployments_preview_id ON deployments(preview_id);
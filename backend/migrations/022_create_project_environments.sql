@@ -0,0 +1,33 @@
+-- Add environments besides production (the project itself), e.g. staging
+-- Each has its own branch, ports, domains, environment variables and
+-- deployments, which point to it with project_environment_id
+
+CREATE TABLE IF NOT EXISTS project_environments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+
+    project_id INTEGER NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    git_branch VARCHAR(255) NOT NULL,
+    auto_deploy BOOLEAN DEFAULT TRUE,
+    frontend_port INTEGER DEFAULT 0,
+    backend_port INTEGER DEFAULT 0,
+    status VARCHAR(20) DEFAULT 'pending',
+    last_deployed DATETIME,
+
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_environments_project_id ON project_environments(project_id);
+CREATE INDEX IF NOT EXISTS idx_project_environments_deleted_at ON project_environments(deleted_at);
+
+ALTER TABLE domains ADD COLUMN IF NOT EXISTS project_environment_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_domains_project_environment_id ON domains(project_environment_id);
+
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS project_environment_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_environments_project_environment_id ON environments(project_environment_id);
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS project_environment_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_deployments_project_environment_id ON deployments(project_environment_id);
@@ -0,0 +1,8 @@
+-- Add tag and release triggers
+-- trigger_rules holds a project's rules as JSON: tags matching a rule's glob
+-- or semver range are deployed when pushed or released; deployments record
+-- the tag they checked out
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS trigger_rules TEXT;
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS tag VARCHAR(255) DEFAULT '';
@@ -0,0 +1,12 @@
+-- Add monorepo path filters
+-- Pushes are only deployed when they change a file matching include_paths (any
+-- file when empty) and not exclude_paths, both JSON lists of globs; others are
+-- recorded as skipped deployments with skip_reason. check_paths marks
+-- deployments whose push payload didn't list every changed file, which are
+-- compared with the last deployed commit once cloned
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS include_paths TEXT;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS exclude_paths TEXT;
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS skip_reason TEXT;
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS check_paths BOOLEAN DEFAULT FALSE;
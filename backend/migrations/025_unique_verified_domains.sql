@@ -0,0 +1,6 @@
+-- Make domain names unique among verified domains only
+-- Any project may claim an unverified name; the first to verify it gets it, so
+-- a pending claim can no longer block the owner of a domain
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domains_verified_domain ON domains (domain)
+    WHERE verification_status = 'verified' AND deleted_at IS NULL;
+DROP INDEX IF EXISTS idx_domains_domain;
@@ -36,6 +36,18 @@ export const authAPI = {
 		return api.post<AuthResponse>('/auth/register', data, { requiresAuth: false });
 	},
 
+	async refresh(refreshToken: string): Promise<AuthResponse> {
+		return api.post<AuthResponse>('/auth/refresh', { refresh_token: refreshToken }, { requiresAuth: false });
+	},
+
+	async logout(refreshToken: string): Promise<{ message: string }> {
+		return api.post<{ message: string }>('/auth/logout', { refresh_token: refreshToken }, { requiresAuth: false });
+	},
+
+	async logoutAll(): Promise<{ message: string }> {
+		return api.post<{ message: string }>('/auth/logout-all', {});
+	},
+
 	async getCurrentUser(): Promise<User> {
 		return api.get<User>('/users/me');
 	},
@@ -1,7 +1,24 @@
 // WebSocket store using Svelte 5 runes
 import { browser } from '$app/environment';
 
-export type MessageType = 'deployment_status' | 'build_log' | 'deployment_start' | 'deployment_end';
+export type MessageType =
+	| 'deployment_status'
+	| 'build_log'
+	| 'deployment_start'
+	| 'deployment_end'
+	| 'certificate_status'
+	| 'build_log_replay'
+	| 'subscribed'
+	| 'unsubscribed'
+	| 'pong'
+	| 'error';
+
+export interface WebSocketCommand {
+	type: 'subscribe' | 'unsubscribe' | 'replay' | 'ping';
+	projectId?: number;
+	deploymentId?: number;
+	sinceLogId?: number;
+}
 
 export interface WebSocketMessage {
 	type: MessageType;
@@ -13,9 +30,11 @@ export interface DeploymentStatusPayload {
 	projectId: number;
 	status: string;
 	error?: string;
+	queuePosition?: number;
 }
 
 export interface BuildLogPayload {
+	logId: number;
 	deploymentId: number;
 	projectId: number;
 	message: string;
@@ -23,6 +42,23 @@ export interface BuildLogPayload {
 	timestamp: string;
 }
 
+export interface CertificateStatusPayload {
+	domainId: number;
+	projectId: number;
+	domain: string;
+	status: 'pending' | 'valid' | 'expiring' | 'error';
+	issuer?: string;
+	expiresAt?: string;
+	error?: string;
+}
+
+export interface BuildLogReplayPayload {
+	deploymentId: number;
+	projectId: number;
+	logs: BuildLogPayload[];
+	hasMore: boolean;
+}
+
 type MessageHandler = (message: WebSocketMessage) => void;
 
 class WebSocketStore {
@@ -195,9 +231,9 @@ class WebSocketStore {
 	}
 
 	/**
-	 * Send a message through WebSocket (currently not used, but available for future)
+	 * Send a command through WebSocket
 	 */
-	send(message: any) {
+	send(message: WebSocketCommand) {
 		if (this.ws?.readyState === WebSocket.OPEN) {
 			this.ws.send(JSON.stringify(message));
 		} else {
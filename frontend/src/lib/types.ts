@@ -37,7 +37,8 @@ export type DeploymentStatus =
 	| 'deploying'
 	| 'success'
 	| 'failed'
-	| 'cancelled';
+	| 'cancelled'
+	| 'skipped';
 
 export interface Project {
 	id: number;
@@ -48,6 +49,8 @@ export interface Project {
 	git_branch: string;
 	git_username?: string;
 	root_directory?: string;
+	include_paths?: string[] | null;
+	exclude_paths?: string[] | null;
 	framework: FrameworkType;
 	baas_type: BaaSType;
 	build_command: string;
@@ -57,6 +60,24 @@ export interface Project {
 	frontend_port: number;
 	backend_port: number;
 	auto_deploy: boolean;
+	deployment_policy?: 'queue' | 'supersede';
+	preview_deployments?: boolean;
+	trigger_rules?: TriggerRule[] | null;
+	health_check_path?: string;
+	health_check_expected_status?: number;
+	health_check_timeout?: number;
+	health_check_retries?: number;
+	health_check_start_period?: number;
+	health_check_rollback?: boolean;
+	header_profile?: HeaderProfile;
+	custom_headers?: CustomHeader[] | null;
+	csp_directives?: CSPDirective[] | null;
+	csp_report_only?: boolean;
+	maintenance_enabled?: boolean;
+	maintenance_message?: string;
+	maintenance_page?: string;
+	maintenance_retry_after?: number;
+	maintenance_allow_cidrs?: string[] | null;
 	deployment_path: string;
 	status: 'pending' | 'deploying' | 'active' | 'failed';
 	last_deployed?: string;
@@ -65,6 +86,24 @@ export interface Project {
 	deployments?: Deployment[];
 	environments?: Environment[];
 	domains?: Domain[];
+	project_environments?: ProjectEnvironment[];
+}
+
+export interface TriggerRule {
+	event: 'tag' | 'release';
+	pattern: string; // glob (v*) or semver range (semver:>=1.4.0 <2.0.0)
+}
+
+export type HeaderProfile = '' | 'strict' | 'relaxed' | 'custom';
+
+export interface CustomHeader {
+	name: string;
+	value: string; // empty removes the header
+}
+
+export interface CSPDirective {
+	name: string;
+	sources: string[];
 }
 
 export interface CreateProjectRequest {
@@ -75,6 +114,8 @@ export interface CreateProjectRequest {
 	git_username?: string;
 	git_token?: string;
 	root_directory?: string;
+	include_paths?: string[];
+	exclude_paths?: string[];
 	framework: FrameworkType;
 	baas_type?: BaaSType;
 	build_command?: string;
@@ -84,6 +125,8 @@ export interface CreateProjectRequest {
 	frontend_port?: number;
 	backend_port?: number;
 	auto_deploy?: boolean;
+	preview_deployments?: boolean;
+	trigger_rules?: TriggerRule[];
 }
 
 export interface Deployment {
@@ -93,13 +136,20 @@ export interface Deployment {
 	commit_message: string;
 	commit_author: string;
 	branch: string;
+	tag?: string;
 	status: DeploymentStatus;
 	started_at?: string;
 	completed_at?: string;
 	duration: number;
 	error_message?: string;
-	triggered_by: 'manual' | 'webhook' | 'api';
+	skip_reason?: string;
+	triggered_by: 'manual' | 'webhook' | 'api' | 'rollback' | 'promote';
 	triggered_by_id: number;
+	queue_position?: number;
+	image_tag?: string;
+	source_deployment_id?: number;
+	preview_id?: number;
+	project_environment_id?: number;
 	created_at: string;
 	updated_at: string;
 	build_logs?: BuildLog[];
@@ -108,6 +158,7 @@ export interface Deployment {
 export interface Environment {
 	id: number;
 	project_id: number;
+	project_environment_id?: number;
 	key: string;
 	value: string;
 	is_secret: boolean;
@@ -121,6 +172,131 @@ export interface Domain {
 	domain: string;
 	is_active: boolean;
 	ssl_enabled: boolean;
+	is_primary: boolean;
+	redirect_to_primary: boolean;
+	redirect_code: number;
+	canonical: CanonicalHost;
+	rules: DomainRule[] | null;
+	verification_status: 'pending' | 'failed' | 'verified';
+	verification_token?: string;
+	verification_error?: string;
+	verified_at?: string;
+	cert_status: '' | 'pending' | 'valid' | 'expiring' | 'error';
+	cert_issuer?: string;
+	cert_expires_at?: string;
+	cert_error?: string;
+	cert_checked_at?: string;
+	preview_id?: number;
+	project_environment_id?: number;
+	created_at: string;
+	updated_at: string;
+}
+
+export interface DomainCheck {
+	domain: string;
+	ownership: boolean;
+	dns_ready: boolean;
+	addresses: string[];
+	cname?: string;
+	expected_addresses: string[] | null;
+	errors: string[];
+}
+
+export type CanonicalHost = '' | 'www' | 'apex';
+
+export interface DomainRule {
+	type: 'redirect' | 'rewrite';
+	path: string;
+	to: string;
+	code?: number;
+}
+
+export interface MaintenanceWindow {
+	id: number;
+	project_id: number;
+	starts_at: string;
+	ends_at: string;
+	message?: string;
+	created_at: string;
+	updated_at: string;
+}
+
+// GET /projects/:id/maintenance
+export interface MaintenanceStatus {
+	active: boolean;
+	current_window: MaintenanceWindow | null;
+	enabled: boolean;
+	message: string;
+	page: string;
+	retry_after: number;
+	allow_cidrs: string[] | null;
+	windows: MaintenanceWindow[] | null;
+}
+
+// An environment besides production (the project itself)
+export interface ProjectEnvironment {
+	id: number;
+	project_id: number;
+	name: string;
+	git_branch: string;
+	auto_deploy: boolean;
+	frontend_port: number;
+	backend_port: number;
+	status: 'pending' | 'active' | 'failed';
+	last_deployed?: string;
+	domains?: Domain[];
+	created_at: string;
+	updated_at: string;
+}
+
+export interface Preview {
+	id: number;
+	project_id: number;
+	number: number;
+	title: string;
+	url: string;
+	branch: string;
+	commit_hash: string;
+	author: string;
+	status: 'pending' | 'active' | 'failed' | 'closed';
+	last_deployed?: string;
+	closed_at?: string;
+	frontend_port: number;
+	backend_port: number;
+	domains?: Domain[];
+	created_at: string;
+	updated_at: string;
+}
+
+export interface AccessPolicy {
+	id: number;
+	project_id: number;
+	domain_id: number | null;
+	allow_cidrs: string[] | null;
+	deny_cidrs: string[] | null;
+	users: AccessUser[];
+	created_at: string;
+	updated_at: string;
+}
+
+export interface AccessUser {
+	id: number;
+	policy_id: number;
+	username: string;
+	created_at: string;
+	updated_at: string;
+}
+
+// Uploaded TLS certificate; domain_id null shares it with the project's domains it covers
+export interface Certificate {
+	id: number;
+	project_id: number;
+	domain_id: number | null;
+	names: string[];
+	issuer: string;
+	not_before: string;
+	not_after: string;
+	fingerprint: string;
 	created_at: string;
 	updated_at: string;
 }